@@ -0,0 +1,252 @@
+// Command deckctl pilote un serveur de decks depuis le terminal, pour scripter des parties.
+//
+//	deckctl [-server URL] [-o table|json] <commande> [arguments]
+//
+//	new [--count N] [--jokers] [--shuffle] [--seed S] [--cards AS,KH] [--draw N]  cree un deck
+//	draw <deck_id> [-n N]                      pige N cartes de la pioche
+//	shuffle <deck_id>                          melange la pioche et les piles
+//	pile add <deck_id> <pile> AS,KH            ajoute des cartes tirees a une pile
+//	pile draw <deck_id> <pile> [-n N]          pige N cartes d'une pile
+//	pile list <deck_id> [pile]                 liste les piles, et les cartes de pile
+//	return <deck_id> [--pile P] [AS,KH]        remet des cartes dans la pioche
+//
+// Le serveur est lu dans -server ou DECK_SERVER (http://localhost:8080 par defaut).
+// Les options peuvent suivre les arguments: deckctl draw abc -n 5.
+package main
+
+import (
+	"context"
+	"deckofcards/api"
+	"deckofcards/client"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// usageError erreur de ligne de commande, l'aide est affichee
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// usagef retourne une usageError formatee
+func usagef(format string, args ...interface{}) error {
+	return usageError(fmt.Sprintf(format, args...))
+}
+
+func main() {
+	global := flag.NewFlagSet("deckctl", flag.ContinueOnError)
+	server := global.String("server", envOr("DECK_SERVER", "http://localhost:8080"), "url du serveur")
+	output := global.String("o", "table", "format de sortie: table ou json")
+	timeout := global.Duration("timeout", 10*time.Second, "delai maximal d'une commande")
+	global.Usage = usage(global)
+	if err := global.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "deckctl: format de sortie inconnu %q\n", *output)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	resp, err := run(ctx, client.New(*server), global.Args())
+	var usageErr usageError
+	switch {
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "deckctl: %v\n", err)
+		global.Usage()
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "deckctl: %v\n", err)
+		os.Exit(1)
+	}
+	if err := printResponse(os.Stdout, resp, *output == "json"); err != nil {
+		fmt.Fprintf(os.Stderr, "deckctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run execute la commande args et retourne la reponse du serveur
+func run(ctx context.Context, c *client.Client, args []string) (*api.Response, error) {
+	if len(args) == 0 {
+		return nil, usagef("commande manquante")
+	}
+	cmd, args := args[0], args[1:]
+
+	switch cmd {
+	case "new":
+		fs := flag.NewFlagSet("new", flag.ContinueOnError)
+		count := fs.Int("count", 1, "nombre de paquets")
+		jokers := fs.Bool("jokers", false, "ajoute deux jokers par paquet")
+		shuffle := fs.Bool("shuffle", false, "melange le deck")
+		seed := fs.Int64("seed", 0, "graine pour un melange reproductible")
+		cards := fs.String("cards", "", "deck personnalise, codes separes par des virgules")
+		draw := fs.Int("draw", 0, "cartes tirees apres la creation")
+		if _, err := parseArgs(fs, args, 0); err != nil {
+			return nil, err
+		}
+		opts := client.NewDeckOptions{Jokers: *jokers, Shuffle: *shuffle, Draw: *draw}
+		if *cards != "" {
+			opts.Cards = splitCodes(*cards)
+		} else {
+			opts.DeckCount = *count
+		}
+		if isSet(fs, "seed") {
+			opts.Seed = seed
+		}
+		return c.NewDeck(ctx, opts)
+
+	case "draw":
+		fs := flag.NewFlagSet("draw", flag.ContinueOnError)
+		n := fs.Int("n", 1, "nombre de cartes")
+		pos, err := parseArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return c.Draw(ctx, pos[0], *n)
+
+	case "shuffle":
+		pos, err := parseArgs(flag.NewFlagSet("shuffle", flag.ContinueOnError), args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return c.Shuffle(ctx, pos[0])
+
+	case "return":
+		fs := flag.NewFlagSet("return", flag.ContinueOnError)
+		pile := fs.String("pile", "", "remet les cartes de cette pile plutot que les cartes tirees")
+		pos, err := parseArgs(fs, args, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		var codes []string
+		if len(pos) == 2 {
+			codes = splitCodes(pos[1])
+		}
+		return c.Return(ctx, pos[0], *pile, codes...)
+
+	case "pile":
+		return runPile(ctx, c, args)
+	}
+	return nil, usagef("commande inconnue %q", cmd)
+}
+
+// runPile execute les sous-commandes de pile
+func runPile(ctx context.Context, c *client.Client, args []string) (*api.Response, error) {
+	if len(args) == 0 {
+		return nil, usagef("pile: sous-commande manquante")
+	}
+	sub, args := args[0], args[1:]
+
+	switch sub {
+	case "add":
+		pos, err := parseArgs(flag.NewFlagSet("pile add", flag.ContinueOnError), args, 3)
+		if err != nil {
+			return nil, err
+		}
+		return c.AddToPile(ctx, pos[0], pos[1], splitCodes(pos[2])...)
+
+	case "draw":
+		fs := flag.NewFlagSet("pile draw", flag.ContinueOnError)
+		n := fs.Int("n", 1, "nombre de cartes")
+		pos, err := parseArgs(fs, args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return c.DrawFromPile(ctx, pos[0], pos[1], *n)
+
+	case "list":
+		pos, err := parseArgs(flag.NewFlagSet("pile list", flag.ContinueOnError), args, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		if len(pos) == 2 {
+			return c.GetPile(ctx, pos[0], pos[1])
+		}
+		return c.ListPiles(ctx, pos[0])
+	}
+	return nil, usagef("pile: sous-commande inconnue %q", sub)
+}
+
+// parseArgs lit les options de fs ou qu'elles soient dans args et retourne les
+// arguments positionnels, dont le nombre doit etre entre least et most (least si absent)
+func parseArgs(fs *flag.FlagSet, args []string, least int, most ...int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, usagef("%s: %v", fs.Name(), err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	limit := least
+	if len(most) > 0 {
+		limit = most[0]
+	}
+	if len(pos) < least || len(pos) > limit {
+		return nil, usagef("%s: nombre d'arguments invalide", fs.Name())
+	}
+	return pos, nil
+}
+
+// isSet indique si l'option name a ete fournie
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// splitCodes separe une liste de codes AS,kh en codes en majuscules
+func splitCodes(list string) []string {
+	var codes []string
+	for _, code := range strings.Split(list, ",") {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// envOr retourne la variable d'environnement key, def si elle est vide
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// usage affiche l'aide de la commande
+func usage(global *flag.FlagSet) func() {
+	return func() {
+		out := global.Output()
+		fmt.Fprint(out, `usage: deckctl [-server URL] [-o table|json] <commande> [arguments]
+
+  new [--count N] [--jokers] [--shuffle] [--seed S] [--cards AS,KH] [--draw N]
+  draw <deck_id> [-n N]
+  shuffle <deck_id>
+  pile add <deck_id> <pile> AS,KH
+  pile draw <deck_id> <pile> [-n N]
+  pile list <deck_id> [pile]
+  return <deck_id> [--pile P] [AS,KH]
+
+options:
+`)
+		global.PrintDefaults()
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"deckofcards/api"
+	"deckofcards/client"
+	"deckofcards/database"
+	"deckofcards/utils"
+	"errors"
+	"flag"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		least int
+		most  []int
+		want  []string
+		n     int
+		err   bool
+	}{
+		{"option after positional", []string{"abc", "-n", "5"}, 1, nil, []string{"abc"}, 5, false},
+		{"option before positional", []string{"-n", "5", "abc"}, 1, nil, []string{"abc"}, 5, false},
+		{"interleaved", []string{"abc", "-n=3", "hand"}, 2, nil, []string{"abc", "hand"}, 3, false},
+		{"default option", []string{"abc"}, 1, nil, []string{"abc"}, 1, false},
+		{"optional argument given", []string{"abc", "hand"}, 1, []int{2}, []string{"abc", "hand"}, 1, false},
+		{"optional argument missing", []string{"abc"}, 1, []int{2}, []string{"abc"}, 1, false},
+		{"missing argument", []string{"-n", "2"}, 1, nil, nil, 0, true},
+		{"too many arguments", []string{"abc", "def"}, 1, nil, nil, 0, true},
+		{"above most", []string{"a", "b", "c"}, 1, []int{2}, nil, 0, true},
+		{"unknown option", []string{"abc", "--pile", "x"}, 1, nil, nil, 0, true},
+		{"bad value", []string{"abc", "-n", "many"}, 1, nil, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("draw", flag.ContinueOnError)
+			n := fs.Int("n", 1, "")
+			pos, err := parseArgs(fs, tt.args, tt.least, tt.most...)
+			var usageErr usageError
+			if tt.err {
+				if !errors.As(err, &usageErr) {
+					t.Errorf("parseArgs(%v) error = %v, want a usage error", tt.args, err)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(pos, tt.want) || *n != tt.n {
+				t.Errorf("parseArgs(%v) = %v, n=%d, %v; want %v, n=%d", tt.args, pos, *n, err, tt.want, tt.n)
+			}
+		})
+	}
+}
+
+func TestSplitCodes(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{"AS,KH", []string{"AS", "KH"}},
+		{" as , kh ", []string{"AS", "KH"}},
+		{"10h,,ZR,", []string{"10H", "ZR"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := splitCodes(tt.list); !slices.Equal(got, tt.want) {
+			t.Errorf("splitCodes(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestGlyph(t *testing.T) {
+	tests := map[string]string{
+		"AS":  "A♠",
+		"KH":  "K♥",
+		"10D": "10♦",
+		"2C":  "2♣",
+		"ZR":  "🃏R",
+		"ZB":  "🃏B",
+		"AX":  "AX",
+		"A":   "A",
+	}
+	for code, want := range tests {
+		if got := glyph(code); got != want {
+			t.Errorf("glyph(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestPrintResponse(t *testing.T) {
+	shuffled := true
+	seed := int64(7)
+	resp := &api.Response{
+		Success:   true,
+		DeckId:    "abc",
+		Remaining: 50,
+		Shuffled:  &shuffled,
+		Seed:      &seed,
+		Cards:     []api.CardResponse{{Code: "AS"}, {Code: "10H"}},
+		Piles: map[string]api.PileResponse{
+			"table": {Remaining: 0},
+			"hand":  {Remaining: 1, Cards: []api.CardResponse{{Code: "ZR"}}},
+		},
+	}
+
+	var table bytes.Buffer
+	if err := printResponse(&table, resp, false); err != nil {
+		t.Fatalf("printResponse table: %v", err)
+	}
+	for _, want := range []string{"DECK       abc", "RESTANTES  50", "MELANGE    true", "GRAINE     7", "CARTES     A♠ 10♥", "hand   1       🃏R"} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("table output missing %q:\n%s", want, table.String())
+		}
+	}
+	// Les piles sont triees par nom
+	if strings.Index(table.String(), "hand") > strings.Index(table.String(), "table") {
+		t.Errorf("piles not sorted:\n%s", table.String())
+	}
+
+	var out bytes.Buffer
+	if err := printResponse(&out, resp, true); err != nil {
+		t.Fatalf("printResponse json: %v", err)
+	}
+	if !strings.Contains(out.String(), `"deck_id": "abc"`) {
+		t.Errorf("json output = %s", out.String())
+	}
+}
+
+func TestRun_Game(t *testing.T) {
+	handler, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	cfg := utils.DefaultConfig()
+	wp := database.Init(handler, cfg)
+	t.Cleanup(func() {
+		wp.Close()
+		_ = handler.Close()
+	})
+	// La meme partie passe par l'api servie par chaque stockage
+	backends := map[string]database.Backend{"sqlite": wp, "memory": database.NewMemoryStore(cfg)}
+	for name, store := range backends {
+		t.Run(name, func(t *testing.T) { testRunGame(t, store, cfg) })
+	}
+}
+
+func testRunGame(t *testing.T, store database.Backend, cfg *utils.Config) {
+	srv := httptest.NewServer(api.NewHandler(store, cfg))
+	defer srv.Close()
+	c := client.New(srv.URL)
+	ctx := context.Background()
+
+	deck, err := run(ctx, c, []string{"new", "--shuffle", "--seed", "42", "--draw", "2"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if deck.Remaining != 50 || len(deck.Cards) != 2 || deck.Seed == nil || *deck.Seed != 42 {
+		t.Fatalf("new = %+v, want 2 cards drawn from a seeded deck", deck)
+	}
+	id := deck.DeckId
+
+	drawn, err := run(ctx, c, []string{"draw", id, "-n", "3"})
+	if err != nil || len(drawn.Cards) != 3 || drawn.Remaining != 47 {
+		t.Fatalf("draw = %+v, %v", drawn, err)
+	}
+	codes := drawn.Cards[0].Code + "," + strings.ToLower(drawn.Cards[1].Code)
+	if _, err := run(ctx, c, []string{"pile", "add", id, "hand", codes}); err != nil {
+		t.Fatalf("pile add: %v", err)
+	}
+	pile, err := run(ctx, c, []string{"pile", "list", id, "hand"})
+	if err != nil || pile.Piles["hand"].Remaining != 2 {
+		t.Fatalf("pile list = %+v, %v", pile, err)
+	}
+	if _, err := run(ctx, c, []string{"pile", "draw", id, "hand", "-n", "1"}); err != nil {
+		t.Fatalf("pile draw: %v", err)
+	}
+	back, err := run(ctx, c, []string{"return", id, "--pile", "hand"})
+	if err != nil || back.Remaining != 48 {
+		t.Fatalf("return = %+v, %v; want 48 remaining", back, err)
+	}
+
+	var usageErr usageError
+	if _, err := run(ctx, c, []string{"deal", id}); !errors.As(err, &usageErr) {
+		t.Errorf("unknown command error = %v, want a usage error", err)
+	}
+	if _, err := run(ctx, c, []string{"draw", "unknown"}); err == nil || errors.As(err, &usageErr) {
+		t.Errorf("draw on unknown deck error = %v, want a server error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"deckofcards/api"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// suitGlyphs symboles des couleurs selon la derniere lettre du code
+var suitGlyphs = map[byte]string{
+	'S': "♠",
+	'H': "♥",
+	'D': "♦",
+	'C': "♣",
+}
+
+// glyph retourne une carte lisible dans le terminal: AS -> A♠, 10H -> 10♥, ZR -> 🃏R
+func glyph(code string) string {
+	if len(code) < 2 {
+		return code
+	}
+	rank, suit := code[:len(code)-1], code[len(code)-1]
+	if rank == "Z" {
+		return "🃏" + string(suit)
+	}
+	if g, ok := suitGlyphs[suit]; ok {
+		return rank + g
+	}
+	return code
+}
+
+// glyphs retourne les cartes lisibles separees par des espaces
+func glyphs(cards []api.CardResponse) string {
+	s := make([]string, len(cards))
+	for i, card := range cards {
+		s[i] = glyph(card.Code)
+	}
+	return strings.Join(s, " ")
+}
+
+// printResponse ecrit la reponse en json ou sous forme de tableau
+func printResponse(w io.Writer, resp *api.Response, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "DECK\t%s\n", resp.DeckId)
+	fmt.Fprintf(tw, "RESTANTES\t%d\n", resp.Remaining)
+	if resp.Shuffled != nil {
+		fmt.Fprintf(tw, "MELANGE\t%t\n", *resp.Shuffled)
+	}
+	if resp.Seed != nil {
+		fmt.Fprintf(tw, "GRAINE\t%d\n", *resp.Seed)
+	}
+	if len(resp.Cards) > 0 {
+		fmt.Fprintf(tw, "CARTES\t%s\n", glyphs(resp.Cards))
+	}
+
+	if len(resp.Piles) > 0 {
+		names := make([]string, 0, len(resp.Piles))
+		for name := range resp.Piles {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "PILE\tCARTES\tCONTENU")
+		for _, name := range names {
+			pile := resp.Piles[name]
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", name, pile.Remaining, glyphs(pile.Cards))
+		}
+	}
+	return tw.Flush()
+}
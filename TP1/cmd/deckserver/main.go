@@ -0,0 +1,154 @@
+// Command deckserver demarre le serveur http de l'api de decks de cartes.
+//
+// La configuration est chargee dans l'ordre suivant, chaque source remplacant
+// la precedente: valeurs par defaut, fichier json (-config ou DECK_CONFIG),
+// variables d'environnement DECK_*, options en ligne de commande.
+//
+//	-addr              DECK_ADDR             adresse d'ecoute (:8080)
+//	-db                DECK_DB               chemin de la base sqlite (DATABASE/cards.db), :memory: pour
+//	                                         garder les decks en memoire, perdus a l'arret
+//	-workers           DECK_WORKERS          nombre de workers de base de donnees
+//	-static            DECK_STATIC           dossier des fichiers statiques (static)
+//	-index             DECK_INDEX            page d'accueil (index.html)
+//	-public-url        DECK_PUBLIC_URL       url publique des images, deduite de la requete si vide
+//	-trust-proxy       DECK_TRUST_PROXY      lire les en-tetes X-Forwarded-* du proxy pour l'url publique
+//	-allowed-origins   DECK_ALLOWED_ORIGINS  origines autorisees des tables websocket, separees par des virgules
+//	-deck-ttl          DECK_TTL              inactivite avant expiration d'un deck (0 = jamais)
+//	-shutdown-timeout                        delai maximal d'arret gracieux (15s)
+package main
+
+import (
+	"context"
+	"deckofcards/api"
+	"deckofcards/database"
+	"deckofcards/utils"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	configPath := flag.String("config", os.Getenv("DECK_CONFIG"), "fichier de configuration json")
+	addr := flag.String("addr", "", "adresse d'ecoute du serveur")
+	dbPath := flag.String("db", "", "chemin de la base de donnees sqlite, :memory: pour garder les decks en memoire")
+	workers := flag.Int("workers", 0, "nombre de workers de base de donnees")
+	staticDir := flag.String("static", "", "dossier des fichiers statiques")
+	indexPath := flag.String("index", "", "chemin de la page d'accueil")
+	publicURL := flag.String("public-url", "", "url publique utilisee pour les images des cartes")
+	trustProxy := flag.Bool("trust-proxy", false, "lire les en-tetes X-Forwarded-* du proxy pour l'url publique")
+	allowedOrigins := flag.String("allowed-origins", "", "origines autorisees pour les tables websocket, separees par des virgules")
+	deckTTL := flag.Duration("deck-ttl", 0, "duree d'inactivite avant expiration d'un deck, 0 = jamais")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 15*time.Second, "delai maximal d'arret gracieux")
+	flag.Parse()
+
+	cfg, err := utils.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Seules les options fournies explicitement remplacent la configuration chargee
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.ListenAddr = *addr
+		case "db":
+			cfg.DBPath = *dbPath
+		case "workers":
+			cfg.WorkerAmount = *workers
+		case "static":
+			cfg.StaticDir = *staticDir
+		case "index":
+			cfg.IndexPath = *indexPath
+		case "public-url":
+			cfg.PublicURL = *publicURL
+		case "trust-proxy":
+			cfg.TrustProxy = *trustProxy
+		case "allowed-origins":
+			cfg.AllowedOrigins = utils.SplitList(*allowedOrigins)
+		case "deck-ttl":
+			cfg.DeckTTL = utils.Duration{Duration: *deckTTL}
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := run(cfg, *shutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run demarre le serveur et bloque jusqu'a SIGTERM/SIGINT puis arrete proprement
+// le serveur http et le stockage des decks
+func run(cfg *utils.Config, shutdownTimeout time.Duration) error {
+	store, closeStore, err := openBackend(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	api.RegisterHandlers(store, cfg)
+
+	server := &http.Server{Addr: cfg.ListenAddr}
+	// Shutdown n'attend pas les flux d'evenements ouverts, ils sont fermes ici
+	server.RegisterOnShutdown(store.CloseSubscriptions)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	store.StartJanitor(ctx, cfg.JanitorInterval.Duration, cfg.JanitorBatchSize)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("serveur en ecoute sur %s", cfg.ListenAddr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+	stop()
+	log.Printf("arret en cours...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("arret du serveur http: %v", err)
+	}
+	if err := store.Drain(shutdownCtx); err != nil {
+		log.Printf("vidange du stockage des decks: %v", err)
+	}
+	return nil
+}
+
+// openBackend ouvre le stockage des decks: un MemoryStore si cfg.DBPath vaut
+// utils.MemoryDBPath, sinon la base sqlite servie par un pool de workers
+// La fonction retournee arrete le stockage puis ferme la base
+func openBackend(cfg *utils.Config) (database.Backend, func(), error) {
+	if cfg.DBPath == utils.MemoryDBPath {
+		store := database.NewMemoryStore(cfg)
+		return store, store.Close, nil
+	}
+	handler, err := database.NewDB(cfg.DBPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	workerPool := database.Init(handler, cfg)
+	closeStore := func() {
+		workerPool.Close()
+		if err := handler.Close(); err != nil {
+			log.Printf("fermeture de la base de donnees: %v", err)
+		}
+	}
+	return workerPool, closeStore, nil
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"deckofcards/database"
+	"deckofcards/utils"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultLogLimit = 100  //< actions retournees sans ?limit=
+	maxLogLimit     = 1000 //< limite maximale d'une page du journal
+	maxActorLength  = 64   //< longueur maximale d'un acteur
+)
+
+// / Retourne le journal des actions d'un deck, page par page avec ?after= et ?limit=
+func actionLog(store database.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		q := r.URL.Query()
+
+		var after int64
+		if q.Has("after") {
+			id, err := strconv.ParseInt(q.Get("after"), 10, 64)
+			if err != nil || id < 0 {
+				writeError(w, ErrInvalidParameter, deckId)
+				return
+			}
+			after = id
+		}
+		limit := defaultLogLimit
+		if q.Has("limit") {
+			n, err := strconv.Atoi(q.Get("limit"))
+			if err != nil {
+				writeError(w, ErrInvalidParameter, deckId)
+				return
+			}
+			if n <= 0 || n > maxLogLimit {
+				writeError(w, ErrParameterOutOfRange, deckId)
+				return
+			}
+			limit = n
+		}
+
+		actions, err := store.ActionLog(deckId, after, limit)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(LogResponse{
+			Success: true,
+			DeckId:  deckId,
+			Actions: actions,
+		})
+	}
+}
+
+// / Rejoue le journal d'un deck jusqu'a l'action action_id et retourne la pioche et les piles
+func replayDeck(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+
+		actionId, err := strconv.ParseInt(r.PathValue("action_id"), 10, 64)
+		if err != nil || actionId <= 0 {
+			writeError(w, ErrInvalidParameter, deckId)
+			return
+		}
+		state, err := store.Replay(deckId, actionId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		baseURL := publicURL(r, cfg)
+		resp := ReplayResponse{
+			Success: true,
+			DeckId:  deckId,
+			Action:  state.Action,
+			Cards:   cardResponses(baseURL, state.Cards),
+			Piles:   make(map[string]PileResponse, len(state.Piles)),
+		}
+		for name, codes := range state.Piles {
+			resp.Piles[name] = PileResponse{
+				Cards:     cardResponses(baseURL, codes),
+				Remaining: len(codes),
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// parseActor lit l'acteur d'une requete dans l'en-tete X-Actor-Id, ou value s'il est absent
+func parseActor(r *http.Request, value string) (string, error) {
+	actor := r.Header.Get("X-Actor-Id")
+	if actor == "" {
+		actor = value
+	}
+	if len(actor) > maxActorLength {
+		return "", ErrInvalidParameter
+	}
+	return actor, nil
+}
+
+// storeAs retourne la vue de store qui inscrit au journal l'acteur de l'en-tete X-Actor-Id,
+// les handlers qui modifient un deck la substituent a store
+func storeAs(r *http.Request, store database.Backend) (database.Backend, error) {
+	actor, err := parseActor(r, "")
+	if err != nil {
+		return nil, err
+	}
+	return store.As(actor), nil
+}
@@ -5,149 +5,195 @@ import (
 	"deckofcards/models"
 	"deckofcards/utils"
 	"encoding/json"
-	"fmt"
-	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 )
 
-// /RegisterHandlers Enregistre les endpoints de l'api
-func RegisterHandlers(workerPool *database.WorkerPool) {
-	http.HandleFunc("GET /api/deck/new/{$}", newDeck(workerPool))
-	http.HandleFunc("GET /api/deck/new/draw/{$}", newDeckDraw(workerPool))
-	http.HandleFunc("GET /api/deck/new/shuffle/{$}", newDeckShuffled(workerPool))
-	http.HandleFunc("GET /api/deck/{deck_id}/shuffle/{$}", shuffleDeck(workerPool))
-	http.HandleFunc("GET /api/deck/{deck_id}/draw/{$}", drawCards(workerPool))
-	http.HandleFunc("GET /api/deck/{deck_id}/pile/{pile_name}/add/{$}", addToPile(workerPool))
-	http.HandleFunc("GET /api/deck/{deck_id}/pile/{pile_name}/list/{$}", listPiles(workerPool))
-	http.HandleFunc("GET /api/deck/{deck_id}/pile/{pile_name}/shuffle/{$}", shufflePile(workerPool))
-
-	http.HandleFunc("/api/deck/{deck_id}/pile/{pile_name}/draw/{$}", drawPile(workerPool, "top"))
-	http.HandleFunc("/api/deck/{deck_id}/pile/{pile_name}/draw/bottom/{$}", drawPile(workerPool, "bottom"))
-	http.HandleFunc("/api/deck/{deck_id}/pile/{pile_name}/draw/random/{$}", drawPile(workerPool, "random"))
-	http.HandleFunc("/api/deck/{deck_id}/return/{$}", returnCardsHandler(workerPool))
-	http.HandleFunc("/api/deck/{deck_id}/pile/{pile_name}/return/{$}", returnCardsHandler(workerPool))
-
-	http.HandleFunc("GET /static/img/{filename}", serveCardImage)
-	http.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
-			return
-		}
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		http.ServeFile(w, r, "index.html")
-	})
+// route endpoint de l'api: un motif http.ServeMux et son handler
+type route struct {
+	pattern string
+	handler http.HandlerFunc
 }
 
-// serveCardImage Retourne les images svg des cartes
-func serveCardImage(w http.ResponseWriter, r *http.Request) {
-	filename := r.PathValue("filename")
+// /RegisterHandlers Enregistre les endpoints de l'api
+func RegisterHandlers(store database.Backend, cfg *utils.Config) {
+	for _, rt := range routes(store, cfg) {
+		http.HandleFunc(rt.pattern, rt.handler)
+	}
+}
 
-	if strings.Contains(filename, "..") || strings.Contains(filename, "/") || strings.Contains(filename, "\\") {
-		http.Error(w, "Invalid filename", http.StatusBadRequest)
-		return
+// NewHandler retourne un http.Handler servant tous les endpoints de l'api sans passer
+// par http.DefaultServeMux, pour plusieurs serveurs dans un meme processus
+func NewHandler(store database.Backend, cfg *utils.Config) http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range routes(store, cfg) {
+		mux.HandleFunc(rt.pattern, rt.handler)
 	}
+	return mux
+}
 
-	if !strings.HasSuffix(filename, ".svg") {
-		http.Error(w, "Only SVG files are allowed", http.StatusBadRequest)
-		return
+// routes retourne tous les endpoints du serveur, chacun doit etre decrit dans operations
+func routes(store database.Backend, cfg *utils.Config) []route {
+	rs := []route{
+		{"GET /api/deck/new/{$}", newDeck(store, cfg)},
+		{"GET /api/deck/new/draw/{$}", newDeckDraw(store, cfg)},
+		{"GET /api/deck/new/shuffle/{$}", newDeckShuffled(store, cfg)},
+		{"GET /api/deck/{deck_id}/shuffle/{$}", shuffleDeck(store)},
+		{"GET /api/deck/{deck_id}/draw/{$}", drawCards(store, cfg, "top")},
+		{"GET /api/deck/{deck_id}/draw/bottom/{$}", drawCards(store, cfg, "bottom")},
+		{"GET /api/deck/{deck_id}/draw/random/{$}", drawCards(store, cfg, "random")},
+		{"GET /api/deck/{deck_id}/pile/{pile_name}/add/{$}", addToPile(store)},
+		{"GET /api/deck/{deck_id}/pile/{pile_name}/list/{$}", listPiles(store, cfg)},
+		{"GET /api/deck/{deck_id}/pile/{pile_name}/shuffle/{$}", shufflePile(store)},
+		{"POST /api/deck/{deck_id}/deal/{$}", deal(store, cfg)},
+		{"POST /api/deck/{deck_id}/batch/{$}", batch(store, cfg)},
+		{"POST /api/deck/{deck_id}/pile/{pile_name}/move/{to_pile}/{$}", movePileCards(store, cfg)},
+		{"GET /api/deck/{deck_id}/peek/{$}", peekDeck(store, cfg)},
+		{"GET /api/deck/{deck_id}/pile/{pile_name}/peek/{$}", peekPile(store, cfg)},
+		{"GET /api/deck/{deck_id}/events/{$}", deckEvents(store)},
+		{"POST /api/deck/{deck_id}/undo/{$}", travelDeck(store, cfg, true)},
+		{"POST /api/deck/{deck_id}/redo/{$}", travelDeck(store, cfg, false)},
+		{"GET /api/deck/{deck_id}/log/{$}", actionLog(store)},
+		{"GET /api/deck/{deck_id}/log/{action_id}/{$}", replayDeck(store, cfg)},
+		{"POST /api/deck/{deck_id}/snapshot/{$}", snapshotDeck(store)},
+		{"POST /api/deck/{deck_id}/fork/{$}", forkDeck(store)},
+		{"POST /api/deck/restore/{$}", restoreDeck(store, cfg)},
+		{"GET /api/deck/{deck_id}/export/{$}", exportDeck(store)},
+		{"POST /api/deck/import/{$}", importDeck(store, cfg)},
+
+		{"/api/deck/{deck_id}/pile/{pile_name}/draw/{$}", drawPile(store, cfg, "top")},
+		{"/api/deck/{deck_id}/pile/{pile_name}/draw/bottom/{$}", drawPile(store, cfg, "bottom")},
+		{"/api/deck/{deck_id}/pile/{pile_name}/draw/random/{$}", drawPile(store, cfg, "random")},
+		{"/api/deck/{deck_id}/return/{$}", returnCardsHandler(store)},
+		{"/api/deck/{deck_id}/pile/{pile_name}/return/{$}", returnCardsHandler(store)},
+		{"GET /api/deck/{deck_id}/{$}", deckState(store, cfg)},
+		{"DELETE /api/deck/{deck_id}/{$}", deleteDeck(store)},
+		{"DELETE /api/deck/{deck_id}/pile/{pile_name}/{$}", deletePile(store)},
 	}
+	rs = append(rs, v2Routes(store, cfg)...)
+	rs = append(rs,
+		route{"GET /ws/deck/{deck_id}", deckTable(store, cfg)},
+		route{"GET /static/img/{filename}", serveCardImage(cfg.StaticDir)},
+		route{"GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			http.ServeFile(w, r, cfg.IndexPath)
+		}},
+	)
+
+	patterns := make([]string, len(rs), len(rs)+1)
+	for i, rt := range rs {
+		patterns[i] = rt.pattern
+	}
+	patterns = append(patterns, openAPIPattern)
+	return append(rs, route{openAPIPattern, serveOpenAPI(patterns)})
+}
 
-	filePath := filepath.Join("static", "img", filename)
+// serveCardImage Retourne les images svg des cartes
+func serveCardImage(staticDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filename := r.PathValue("filename")
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		http.Error(w, "Card image not found", http.StatusNotFound)
-		return
-	}
+		if strings.Contains(filename, "..") || strings.Contains(filename, "/") || strings.Contains(filename, "\\") {
+			http.Error(w, "Invalid filename", http.StatusBadRequest)
+			return
+		}
 
-	w.Header().Set("Content-Type", "image/svg+xml")
-	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+		if !strings.HasSuffix(filename, ".svg") {
+			http.Error(w, "Only SVG files are allowed", http.StatusBadRequest)
+			return
+		}
 
-	http.ServeFile(w, r, filePath)
+		filePath := filepath.Join(staticDir, "img", filename)
+
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			http.Error(w, "Card image not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		http.ServeFile(w, r, filePath)
+	}
 }
 
 // / Retourne les cartes dans le deck
-func returnCardsHandler(workerPool *database.WorkerPool) http.HandlerFunc {
+func returnCardsHandler(store database.Backend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		deckId := r.PathValue("deck_id")
 		pileName := r.PathValue("pile_name")
-		cardsParam := r.URL.Query().Get("img")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		// "img" est l'ancien nom du parametre, garde pour compatibilite
+		cardsParam := r.URL.Query().Get("cards")
+		if cardsParam == "" {
+			cardsParam = r.URL.Query().Get("img")
+		}
 
 		var requested []string
 		if cardsParam != "" {
 			for _, c := range strings.Split(cardsParam, ",") {
 				c = strings.TrimSpace(c)
-				if c != "" {
-					requested = append(requested, c)
+				if c == "" {
+					continue
 				}
+				// Les doublons sont permis, un deck de plusieurs paquets contient plusieurs exemplaires
+				if !models.CodeValid(c) {
+					writeError(w, ErrInvalidCardCode, deckId)
+					return
+				}
+				requested = append(requested, c)
 			}
 			if len(requested) == 0 {
-				_ = json.NewEncoder(w).Encode(Response{
-					Success: false, DeckId: deckId, Shuffled: nil, Remaining: 0,
-					Piles: map[string]PileResponse{},
-				})
+				writeError(w, ErrInvalidParameter, deckId)
 				return
 			}
 		}
 
-		var err error
+		pos, err := parsePosition(r)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
 		if pileName != "" {
 			if len(requested) > 0 {
-				for _, code := range requested {
-					_, err = workerPool.ReturnSpecificFromPile(deckId, pileName, code)
-					if err != nil {
-						_ = json.NewEncoder(w).Encode(Response{
-							Success: false, DeckId: deckId, Error: err.Error(),
-							Piles: map[string]PileResponse{},
-						})
-						return
-					}
-				}
+				err = store.ReturnSpecificFromPileMany(deckId, pileName, requested, pos)
 			} else {
-				if err = workerPool.ReturnAllFromPile(deckId, pileName); err != nil {
-					_ = json.NewEncoder(w).Encode(Response{
-						Success: false, DeckId: deckId, Error: err.Error(),
-						Piles: map[string]PileResponse{},
-					})
-					return
-				}
+				err = store.ReturnAllFromPile(deckId, pileName, pos)
 			}
 		} else {
 			if len(requested) > 0 {
-				for _, code := range requested {
-					if _, err = workerPool.ReturnSpecificDrawn(deckId, code); err != nil {
-						_ = json.NewEncoder(w).Encode(Response{
-							Success: false, DeckId: deckId, Error: err.Error(),
-							Piles: map[string]PileResponse{},
-						})
-						return
-					}
-				}
+				err = store.ReturnSpecificDrawnMany(deckId, requested, pos)
 			} else {
 				// Return all drawn img
-				if err = workerPool.ReturnAllDrawn(deckId); err != nil {
-					_ = json.NewEncoder(w).Encode(Response{
-						Success: false, DeckId: deckId, Error: err.Error(),
-						Piles: map[string]PileResponse{},
-					})
-					return
-				}
+				err = store.ReturnAllDrawn(deckId, pos)
 			}
 		}
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
 
 		// success - build response
-		deckRemaining, _ := workerPool.CardsInDeck(deckId)
+		deckRemaining, _ := store.CardsInDeck(deckId)
 
 		pilesResp := make(map[string]PileResponse)
 		if pileName != "" {
-			pcount, _ := workerPool.CardsInPile(deckId, pileName)
+			pcount, _ := store.CardsInPile(deckId, pileName)
 			pilesResp[pileName] = PileResponse{Remaining: int(pcount)}
 		}
 
@@ -161,64 +207,39 @@ func returnCardsHandler(workerPool *database.WorkerPool) http.HandlerFunc {
 	}
 }
 
-func shufflePile(workerPool *database.WorkerPool) http.HandlerFunc {
+func shufflePile(store database.Backend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		deckId := r.PathValue("deck_id")
 		pileName := r.PathValue("pile_name")
-
-		// 1. Get img in the requested pile
-		codes, _, err := workerPool.GetPileCards(deckId, pileName)
+		store, err := storeAs(r, store)
 		if err != nil {
-			_ = json.NewEncoder(w).Encode(Response{
-				Success: false,
-				DeckId:  deckId,
-				Error:   err.Error(),
-			})
+			writeError(w, err, deckId)
 			return
 		}
 
-		// 2. Shuffle them
-		rand.Seed(time.Now().UnixNano())
-		for i := range codes {
-			j := rand.Intn(i + 1)
-			codes[i], codes[j] = codes[j], codes[i]
-		}
-
-		// 3. Persist new order
-		if err := workerPool.UpdatePileOrder(deckId, pileName, codes); err != nil {
-			_ = json.NewEncoder(w).Encode(Response{
-				Success: false,
-				DeckId:  deckId,
-				Error:   err.Error(),
-			})
+		// 1. Shuffle the pile in the database
+		if _, err := store.ShufflePile(deckId, pileName); err != nil {
+			writeError(w, err, deckId)
 			return
 		}
 
-		// 4. Get remaining img in **this pile only**
-		pileRemaining, err := workerPool.CardsInPile(deckId, pileName)
+		// 2. Get remaining img in **this pile only**
+		pileRemaining, err := store.CardsInPile(deckId, pileName)
 		if err != nil {
-			_ = json.NewEncoder(w).Encode(Response{
-				Success: false,
-				DeckId:  deckId,
-				Error:   err.Error(),
-			})
+			writeError(w, err, deckId)
 			return
 		}
 
-		// 5. Get deck remaining (img not in any pile)
-		deckRemaining, err := workerPool.CardsInDeck(deckId)
+		// 3. Get deck remaining (img not in any pile)
+		deckRemaining, err := store.CardsInDeck(deckId)
 		if err != nil {
-			_ = json.NewEncoder(w).Encode(Response{
-				Success: false,
-				DeckId:  deckId,
-				Error:   err.Error(),
-			})
+			writeError(w, err, deckId)
 			return
 		}
 
-		// 6. Return response with only the shuffled pile
+		// 4. Return response with only the shuffled pile
 		resp := Response{
 			Success:   true,
 			DeckId:    deckId,
@@ -231,7 +252,7 @@ func shufflePile(workerPool *database.WorkerPool) http.HandlerFunc {
 	}
 }
 
-func listPiles(workerPool *database.WorkerPool) http.HandlerFunc {
+func listPiles(store database.Backend, cfg *utils.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
@@ -239,38 +260,21 @@ func listPiles(workerPool *database.WorkerPool) http.HandlerFunc {
 		requestedPile := r.PathValue("pile_name")
 
 		// 1. Get all pile names and their counts
-		allPiles, err := workerPool.ListPiles(deckId)
+		allPiles, err := store.ListPiles(deckId)
 		if err != nil {
-			_ = json.NewEncoder(w).Encode(Response{
-				Success: false,
-				DeckId:  deckId,
-				Error:   err.Error(),
-			})
+			writeError(w, err, deckId)
 			return
 		}
 
 		// 2. Get img for the requested pile only
 		var cards []CardResponse
 		if requestedPile != "" {
-			codes, _, err := workerPool.GetPileCards(deckId, requestedPile)
+			codes, _, err := store.GetPileCards(deckId, requestedPile)
 			if err != nil {
-				_ = json.NewEncoder(w).Encode(Response{
-					Success: false,
-					DeckId:  deckId,
-					Error:   err.Error(),
-				})
+				writeError(w, err, deckId)
 				return
 			}
-			for _, code := range codes {
-				value, _ := models.GetValue(code)
-				suit, _ := models.GetSuit(code)
-				cards = append(cards, CardResponse{
-					Code:  code,
-					Image: fmt.Sprintf(utils.SERVER_PATH+"/static/img/%s.svg", code),
-					Value: value,
-					Suit:  suit,
-				})
-			}
+			cards = cardResponses(publicURL(r, cfg), codes)
 		}
 
 		// 3. Build pile map
@@ -286,13 +290,9 @@ func listPiles(workerPool *database.WorkerPool) http.HandlerFunc {
 		}
 
 		// 4. Compute remaining img in deck not in piles
-		deckRemaining, err := workerPool.CardsInDeck(deckId)
+		deckRemaining, err := store.CardsInDeck(deckId)
 		if err != nil {
-			_ = json.NewEncoder(w).Encode(Response{
-				Success: false,
-				DeckId:  deckId,
-				Error:   err.Error(),
-			})
+			writeError(w, err, deckId)
 			return
 		}
 
@@ -307,11 +307,16 @@ func listPiles(workerPool *database.WorkerPool) http.HandlerFunc {
 	}
 }
 
-func addToPile(workerPool *database.WorkerPool) http.HandlerFunc {
+func addToPile(store database.Backend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		deckId := r.PathValue("deck_id")
 		pileName := r.PathValue("pile_name")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
 		cardsParam := r.URL.Query().Get("cards")
 
 		if cardsParam == "" {
@@ -339,17 +344,9 @@ func addToPile(workerPool *database.WorkerPool) http.HandlerFunc {
 			seen[card] = true
 		}
 
-		inserted, err := workerPool.InsertIntoPile(pileName, deckId, cardsArray)
+		inserted, err := store.InsertIntoPile(pileName, deckId, cardsArray)
 		if err != nil {
-			if strings.Contains(err.Error(), "non trouvee") || strings.Contains(err.Error(), "not found") {
-				writeError(w, ErrCardNotInDeck, deckId)
-				return
-			}
-			if strings.Contains(err.Error(), "non pigée") || strings.Contains(err.Error(), "not drawn") {
-				writeError(w, ErrCardNotInDeck, deckId)
-				return
-			}
-			writeError(w, ErrDatabase, deckId)
+			writeError(w, err, deckId)
 			return
 		}
 
@@ -367,29 +364,47 @@ func addToPile(workerPool *database.WorkerPool) http.HandlerFunc {
 		})
 	}
 }
-func drawCards(workerPool *database.WorkerPool) http.HandlerFunc {
+
+// / Pige des cartes de la pioche selon method (top, bottom, random),
+// ou les cartes demandees par ?cards=AS,10H ou qu'elles soient dans la pioche
+func drawCards(store database.Backend, cfg *utils.Config, method string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		deckId := r.PathValue("deck_id")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
 
-		count := 1
-		if r.URL.Query().Has("count") {
-			c, err := strconv.Atoi(r.URL.Query().Get("count"))
-			if err != nil || c <= 0 {
-				writeError(w, ErrInvalidParameter, deckId)
+		var cards []string
+		var remaining int
+		if r.URL.Query().Has("cards") {
+			codes, err := parseCodes(r.URL.Query().Get("cards"))
+			if err != nil {
+				writeError(w, err, deckId)
 				return
 			}
-			count = c
-		}
-
-		cards, remaining, err := workerPool.DrawCards(deckId, count)
-		if err != nil {
-			if strings.Contains(err.Error(), "deck inexistant") {
-				writeError(w, ErrDeckNotFound, deckId)
+			cards, remaining, err = store.DrawSpecificFromDeck(deckId, codes)
+			if err != nil {
+				writeError(w, err, deckId)
+				return
+			}
+		} else {
+			count, err := parseCount(r)
+			if err != nil {
+				writeError(w, err, deckId)
+				return
+			}
+			if method == "top" {
+				cards, remaining, err = store.DrawCards(deckId, count)
+			} else {
+				cards, remaining, err = store.DrawCardsFrom(deckId, method, count)
+			}
+			if err != nil {
+				writeError(w, err, deckId)
 				return
 			}
-			writeError(w, ErrDatabase, deckId)
-			return
 		}
 
 		if len(cards) == 0 {
@@ -397,17 +412,7 @@ func drawCards(workerPool *database.WorkerPool) http.HandlerFunc {
 			return
 		}
 
-		responses := make([]CardResponse, len(cards))
-		for idx, card := range cards {
-			value, _ := models.GetValue(card)
-			suit, _ := models.GetSuit(card)
-			responses[idx] = CardResponse{
-				Code:  card,
-				Image: fmt.Sprintf(utils.SERVER_PATH+"/static/img/%s.svg", card),
-				Value: value,
-				Suit:  suit,
-			}
-		}
+		responses := cardResponses(publicURL(r, cfg), cards)
 
 		w.WriteHeader(http.StatusOK)
 		_ = json.NewEncoder(w).Encode(Response{
@@ -420,74 +425,42 @@ func drawCards(workerPool *database.WorkerPool) http.HandlerFunc {
 }
 
 // Updated drawPile handler
-func drawPile(workerPool *database.WorkerPool, method string) http.HandlerFunc {
+func drawPile(store database.Backend, cfg *utils.Config, method string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		deckId := r.PathValue("deck_id")
 		pileName := r.PathValue("pile_name")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
 
 		var drawn []string
 		cardsParam := r.URL.Query().Get("cards")
 
 		if cardsParam != "" {
-			// Check for duplicates
-			codes := strings.Split(cardsParam, ",")
-			seen := make(map[string]bool)
-			for _, code := range codes {
-				code = strings.TrimSpace(code)
-				if code == "" {
-					continue
-				}
-				if seen[code] {
-					writeError(w, ErrDuplicateCards, deckId)
-					return
-				}
-				seen[code] = true
-
-				cardCode, err := workerPool.DrawSpecificFromPile(deckId, pileName, code)
-				if err != nil {
-					if strings.Contains(err.Error(), "not in pile") {
-						writeError(w, ErrCardNotInPile, deckId)
-						return
-					}
-					if strings.Contains(err.Error(), "pile") && strings.Contains(err.Error(), "not found") {
-						writeError(w, ErrPileNotFound, deckId)
-						return
-					}
-					writeError(w, ErrDatabase, deckId)
-					return
-				}
-				drawn = append(drawn, cardCode)
+			codes, err := parseCodes(cardsParam)
+			if err != nil {
+				writeError(w, err, deckId)
+				return
 			}
+			if err := store.DrawSpecificFromPileMany(deckId, pileName, codes); err != nil {
+				writeError(w, err, deckId)
+				return
+			}
+			drawn = codes
 		} else {
-			count := 1
-			if r.URL.Query().Has("count") {
-				c, err := strconv.Atoi(r.URL.Query().Get("count"))
-				if err != nil || c <= 0 {
-					writeError(w, ErrInvalidParameter, deckId)
-					return
-				}
-				count = c
-			}
-
-			for i := 0; i < count; i++ {
-				card, err := workerPool.DrawFromPile(deckId, pileName, method)
-				if err != nil {
-					if strings.Contains(err.Error(), "empty") {
-						writeError(w, ErrPileEmpty, deckId)
-						return
-					}
-					if strings.Contains(err.Error(), "not found") {
-						writeError(w, ErrPileNotFound, deckId)
-						return
-					}
-					writeError(w, ErrDatabase, deckId)
-					return
-				}
-				if card == "" {
-					break
-				}
-				drawn = append(drawn, card)
+			count, err := parseCount(r)
+			if err != nil {
+				writeError(w, err, deckId)
+				return
+			}
+
+			drawn, err = store.DrawFromPileN(deckId, pileName, method, count)
+			if err != nil {
+				writeError(w, err, deckId)
+				return
 			}
 		}
 
@@ -496,20 +469,10 @@ func drawPile(workerPool *database.WorkerPool, method string) http.HandlerFunc {
 			return
 		}
 
-		pileRemaining, _ := workerPool.CardsInPile(deckId, pileName)
-		deckRemaining, _ := workerPool.CardsInDeck(deckId)
+		pileRemaining, _ := store.CardsInPile(deckId, pileName)
+		deckRemaining, _ := store.CardsInDeck(deckId)
 
-		cardResponses := make([]CardResponse, len(drawn))
-		for i, code := range drawn {
-			value, _ := models.GetValue(code)
-			suit, _ := models.GetSuit(code)
-			cardResponses[i] = CardResponse{
-				Code:  code,
-				Value: value,
-				Suit:  suit,
-				Image: fmt.Sprintf(utils.SERVER_PATH+"/static/img/%s.svg", code),
-			}
-		}
+		responses := cardResponses(publicURL(r, cfg), drawn)
 
 		w.WriteHeader(http.StatusOK)
 		_ = json.NewEncoder(w).Encode(Response{
@@ -519,72 +482,82 @@ func drawPile(workerPool *database.WorkerPool, method string) http.HandlerFunc {
 			Piles: map[string]PileResponse{
 				pileName: {Remaining: int(pileRemaining)},
 			},
-			Cards: cardResponses,
+			Cards: responses,
 		})
 	}
 }
-func newDeckDraw(workerPool *database.WorkerPool) http.HandlerFunc {
+func newDeckDraw(store database.Backend, cfg *utils.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
 		shuffled := true
+
+		count, err := parseCount(r)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+		seed, err := parseSeed(r)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+
 		deck := models.NewMultiDeck(1, false)
+		deck.Seed = seed
 		deck.Shuffle()
-		id, err := workerPool.InsertDeck(deck)
-		resp := Response{}
+		id, cards, remaining, err := store.InsertDeckAndDraw(deck, count)
 		if err != nil {
-			resp.Success = false
-			resp.Error = err.Error()
-		} else {
-			resp.Success = true
-			resp.Shuffled = &shuffled
-			resp.DeckId = id
-			count := 1
-			if r.URL.Query().Has("count") {
-				count, _ = strconv.Atoi(r.URL.Query().Get("count"))
-			}
-			cards, remaining, err := workerPool.DrawCards(id, count)
-			if err != nil {
-				resp.Success = false
-				resp.Error = err.Error()
-			} else {
-				responses := make([]CardResponse, len(cards))
-				for idx, card := range cards {
-					value, _ := models.GetValue(card)
-					suit, _ := models.GetSuit(card)
-					responses[idx] = CardResponse{
-						Code:  card,
-						Image: fmt.Sprintf(utils.SERVER_PATH+"/static/img/%s.svg", card),
-						Value: value,
-						Suit:  suit,
-					}
-				}
-				var errMessage string
-				if len(responses) <= 0 {
-					errMessage = "Plus de cartes dans le deck"
-				}
-				resp.Cards = responses
-				resp.Remaining = remaining
-				resp.Error = errMessage
-				resp.Success = len(cards) > 0
-			}
+			writeError(w, err, "")
+			return
 		}
-		_ = json.NewEncoder(w).Encode(resp)
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success:   true,
+			DeckId:    id,
+			Cards:     cardResponses(publicURL(r, cfg), cards),
+			Remaining: remaining,
+			Shuffled:  &shuffled,
+			Seed:      seed,
+		})
 	}
 }
 
-func shuffleDeck(workerPool *database.WorkerPool) http.HandlerFunc {
+func shuffleDeck(store database.Backend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		deckID := r.PathValue("deck_id")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckID)
+			return
+		}
 		wantRemainingOnly := r.URL.Query().Get("remaining") == "true"
 
-		deck, err := workerPool.ShuffleDeck(deckID)
+		seed, err := parseSeed(r)
 		if err != nil {
-			if strings.Contains(err.Error(), "inexistant") || strings.Contains(err.Error(), "not found") {
-				writeError(w, ErrDeckNotFound, deckID)
-				return
-			}
-			writeError(w, ErrDatabase, deckID)
+			writeError(w, err, deckID)
+			return
+		}
+
+		// La pioche et les piles sont melangees ensemble, un seul undo annule le tout
+		var deck *models.Deck
+		var piles map[string]int
+		switch {
+		case !wantRemainingOnly:
+			deck, piles, err = store.ShuffleDeckAndPiles(deckID, seed)
+		case seed != nil:
+			deck, err = store.ShuffleDeckSeeded(deckID, *seed)
+		default:
+			deck, err = store.ShuffleDeck(deckID)
+		}
+		if err != nil {
+			writeError(w, err, deckID)
 			return
 		}
 
@@ -593,21 +566,13 @@ func shuffleDeck(workerPool *database.WorkerPool) http.HandlerFunc {
 			Success:   true,
 			DeckId:    deckID,
 			Shuffled:  &shuffled,
+			Seed:      deck.Seed,
 			Remaining: len(deck.Cards),
 		}
-
-		if !wantRemainingOnly {
-			piles, err := workerPool.ShuffleAllPiles(deckID)
-			if err != nil {
-				writeError(w, ErrDatabase, deckID)
-				return
-			}
-
-			if len(piles) > 0 {
-				resp.Piles = make(map[string]PileResponse, len(piles))
-				for name, count := range piles {
-					resp.Piles[name] = PileResponse{Remaining: count}
-				}
+		if len(piles) > 0 {
+			resp.Piles = make(map[string]PileResponse, len(piles))
+			for name, count := range piles {
+				resp.Piles[name] = PileResponse{Remaining: count}
 			}
 		}
 
@@ -616,17 +581,27 @@ func shuffleDeck(workerPool *database.WorkerPool) http.HandlerFunc {
 	}
 }
 
-func newDeck(workerPool *database.WorkerPool) http.HandlerFunc {
+func newDeck(store database.Backend, cfg *utils.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
 		shuffled := false
 		var deck *models.Deck
+		seed, err := parseSeed(r)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
 
 		if r.URL.Query().Has("cards") {
 			cards := r.URL.Query().Get("cards")
 			cardsArray := strings.Split(cards, ",")
 
-			if len(cards) > utils.CUSTOM_DECK_CARDS_LIMIT {
+			if len(cards) > cfg.CustomDeckCardsLimit {
 				writeError(w, ErrParameterOutOfRange, "")
 				return
 			}
@@ -662,7 +637,7 @@ func newDeck(workerPool *database.WorkerPool) http.HandlerFunc {
 					writeError(w, ErrInvalidParameter, "")
 					return
 				}
-				if i > utils.MAX_DECKS {
+				if i > cfg.MaxDecks {
 					writeError(w, ErrParameterOutOfRange, "")
 					return
 				}
@@ -671,11 +646,12 @@ func newDeck(workerPool *database.WorkerPool) http.HandlerFunc {
 			deck = models.NewMultiDeck(nbDecks, jokers)
 		}
 
+		deck.Seed = seed
 		remaining := len(deck.Cards)
-		deckId, err := workerPool.InsertDeck(deck)
+		deckId, err := store.InsertDeck(deck)
 
 		if err != nil {
-			writeError(w, ErrDatabase, deckId)
+			writeError(w, err, deckId)
 			return
 		}
 
@@ -684,43 +660,38 @@ func newDeck(workerPool *database.WorkerPool) http.HandlerFunc {
 			Success:   true,
 			DeckId:    deckId,
 			Shuffled:  &shuffled,
+			Seed:      seed,
 			Remaining: remaining,
 		})
 	}
 }
 
-func newDeckShuffled(workerPool *database.WorkerPool) http.HandlerFunc {
+func newDeckShuffled(store database.Backend, cfg *utils.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
 		shuffled := true
 		var deck *models.Deck
+		seed, err := parseSeed(r)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
 		if r.URL.Query().Has("cards") {
 			cards := r.URL.Query().Get("cards")
 			cardsArray := strings.Split(cards, ",")
-			if len(cards) > utils.CUSTOM_DECK_CARDS_LIMIT {
-				_ = json.NewEncoder(w).Encode(Response{
-					Success:   false,
-					DeckId:    "",
-					Piles:     nil,
-					Cards:     nil,
-					Shuffled:  &shuffled,
-					Remaining: 0,
-					Error:     "Depassement de la limite de cartes",
-				})
+			if len(cards) > cfg.CustomDeckCardsLimit {
+				writeError(w, ErrParameterOutOfRange, "")
 				return
 			}
 			var err error
 			deck, err = models.NewCustomDeck(cardsArray)
 			if err != nil {
-				_ = json.NewEncoder(w).Encode(Response{
-					Success:   false,
-					DeckId:    "",
-					Piles:     nil,
-					Cards:     nil,
-					Shuffled:  &shuffled,
-					Remaining: 0,
-					Error:     "Code de carte invalide",
-				})
+				writeError(w, ErrInvalidCardCode, "")
 				return
 			}
 		} else {
@@ -730,27 +701,446 @@ func newDeckShuffled(workerPool *database.WorkerPool) http.HandlerFunc {
 			nbDecks := 1
 			if v := q.Get("deck_count"); v != "" {
 				if i, err := strconv.Atoi(v); err == nil && i > 0 {
-					nbDecks = min(i, utils.MAX_DECKS)
+					nbDecks = min(i, cfg.MaxDecks)
 				}
 			}
 			deck = models.NewMultiDeck(nbDecks, jokers)
 		}
 
+		deck.Seed = seed
 		deck.Shuffle()
 		remaining := len(deck.Cards)
 
-		deckId, err := workerPool.InsertDeck(deck)
-		resp := Response{
-			Success:   err == nil,
+		deckId, err := store.InsertDeck(deck)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success:   true,
 			DeckId:    deckId,
-			Piles:     nil,
-			Cards:     nil,
 			Shuffled:  &shuffled,
+			Seed:      seed,
+			Remaining: remaining,
+		})
+	}
+}
+
+// / Retourne l'etat d'un deck sans tirer de carte, ?reveal=true ajoute l'ordre de la pioche
+func deckState(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+
+		reveal := false
+		if v := r.URL.Query().Get("reveal"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				writeError(w, ErrInvalidParameter, deckId)
+				return
+			}
+			reveal = b
+		}
+
+		state, err := store.DeckState(deckId, reveal)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(stateResponse(publicURL(r, cfg), state, reveal))
+	}
+}
+
+// stateResponse convertit l'etat d'un deck, avec l'ordre de la pioche si reveal
+func stateResponse(baseURL string, state *database.DeckState, reveal bool) DeckStateResponse {
+	resp := DeckStateResponse{
+		Success:   true,
+		DeckId:    state.DeckId,
+		Remaining: state.Remaining,
+		Shuffled:  state.Shuffled,
+		Seed:      state.Seed,
+		Drawn:     state.Drawn,
+		Piles:     make(map[string]PileResponse, len(state.Piles)),
+		Entries:   make(map[string]EntryResponse, len(state.Entries)),
+		LastEvent: state.LastEvent,
+	}
+	for name, count := range state.Piles {
+		resp.Piles[name] = PileResponse{Remaining: count}
+	}
+	for code, entry := range state.Entries {
+		resp.Entries[code] = EntryResponse(entry)
+	}
+	if reveal {
+		resp.Cards = cardResponses(baseURL, state.Cards)
+	}
+	return resp
+}
+
+// / Retourne les cartes du dessus de la pioche sans les tirer
+func peekDeck(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+
+		count, err := parseCount(r)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		cards, remaining, err := store.PeekDeck(deckId, count)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success:   true,
+			DeckId:    deckId,
+			Cards:     cardResponses(publicURL(r, cfg), cards),
 			Remaining: remaining,
+		})
+	}
+}
+
+// / Retourne les cartes du dessus (?from=top) ou du dessous (?from=bottom) d'une pile sans les tirer
+func peekPile(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		pileName := r.PathValue("pile_name")
+
+		count, err := parseCount(r)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		var fromBottom bool
+		switch r.URL.Query().Get("from") {
+		case "", "top":
+		case "bottom":
+			fromBottom = true
+		default:
+			writeError(w, ErrInvalidParameter, deckId)
+			return
+		}
+
+		cards, pileRemaining, err := store.PeekPile(deckId, pileName, count, fromBottom)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		deckRemaining, err := store.CardsInDeck(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success:   true,
+			DeckId:    deckId,
+			Remaining: int(deckRemaining),
+			Piles: map[string]PileResponse{
+				pileName: {Remaining: pileRemaining},
+			},
+			Cards: cardResponses(publicURL(r, cfg), cards),
+		})
+	}
+}
+
+// / Deplace des cartes d'une pile vers une autre, ?cards=AS,KH ou ?count=N&from=top|bottom
+func movePileCards(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		fromPile := r.PathValue("pile_name")
+		toPile := r.PathValue("to_pile")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var codes []string
+		if r.URL.Query().Has("cards") {
+			var err error
+			if codes, err = parseCodes(r.URL.Query().Get("cards")); err != nil {
+				writeError(w, err, deckId)
+				return
+			}
+		}
+		count, err := parseCount(r)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
 		}
+		var fromBottom bool
+		switch r.URL.Query().Get("from") {
+		case "", "top":
+		case "bottom":
+			fromBottom = true
+		default:
+			writeError(w, ErrInvalidParameter, deckId)
+			return
+		}
+
+		moved, err := store.MovePileCards(deckId, fromPile, toPile, codes, count, fromBottom)
 		if err != nil {
-			resp.Error = "Echec d'insertion de deck: " + err.Error()
+			writeError(w, err, deckId)
+			return
+		}
+
+		piles, err := store.ListPiles(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		deckRemaining, err := store.CardsInDeck(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success:   true,
+			DeckId:    deckId,
+			Remaining: int(deckRemaining),
+			Piles: map[string]PileResponse{
+				fromPile: {Remaining: piles[fromPile]},
+				toPile:   {Remaining: piles[toPile]},
+			},
+			Cards: cardResponses(publicURL(r, cfg), moved),
+		})
+	}
+}
+
+// / Distribue ?count=N cartes a chacune des ?piles=p1,p2, ?mode=roundrobin (defaut) ou block
+func deal(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var piles []string
+		seen := make(map[string]bool)
+		for _, name := range strings.Split(r.URL.Query().Get("piles"), ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if seen[name] {
+				writeError(w, ErrInvalidParameter, deckId)
+				return
+			}
+			seen[name] = true
+			piles = append(piles, name)
 		}
+		if len(piles) == 0 {
+			writeError(w, ErrInvalidParameter, deckId)
+			return
+		}
+		count, err := parseCount(r)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = "roundrobin"
+		}
+
+		dealt, remaining, err := store.Deal(deckId, piles, count, mode)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		totals, err := store.ListPiles(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		baseURL := publicURL(r, cfg)
+		resp := Response{
+			Success:   true,
+			DeckId:    deckId,
+			Remaining: remaining,
+			Piles:     make(map[string]PileResponse, len(dealt)),
+		}
+		for name, codes := range dealt {
+			resp.Piles[name] = PileResponse{
+				Cards:     cardResponses(baseURL, codes),
+				Remaining: totals[name],
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
 		_ = json.NewEncoder(w).Encode(resp)
 	}
 }
+
+// / Annule (undo) ou retablit la derniere operation annulee d'un deck et retourne son nouvel etat
+func travelDeck(store database.Backend, cfg *utils.Config, undo bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		travel := store.Redo
+		if undo {
+			travel = store.Undo
+		}
+		op, err := travel(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		state, err := store.DeckState(deckId, false)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(HistoryResponse{
+			Success: true,
+			DeckId:  deckId,
+			Op:      op,
+			State:   stateResponse(publicURL(r, cfg), state, false),
+		})
+	}
+}
+
+// / Supprime un deck et toutes ses piles
+func deleteDeck(store database.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+
+		if err := store.DeleteDeck(deckId); err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success: true,
+			DeckId:  deckId,
+		})
+	}
+}
+
+// / Supprime une pile, ses cartes redeviennent pigees
+func deletePile(store database.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		pileName := r.PathValue("pile_name")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		if _, err := store.DeletePile(deckId, pileName); err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		deckRemaining, err := store.CardsInDeck(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success:   true,
+			DeckId:    deckId,
+			Remaining: int(deckRemaining),
+		})
+	}
+}
+
+// parseCount lit le parametre optionnel ?count=, 1 par defaut, qui doit etre positif
+func parseCount(r *http.Request) (int, error) {
+	if !r.URL.Query().Has("count") {
+		return 1, nil
+	}
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count <= 0 {
+		return 0, ErrInvalidParameter
+	}
+	return count, nil
+}
+
+// parseCodes lit une liste de codes de cartes separes par des virgules
+// Les codes invalides sont refuses; un code repete tire plusieurs exemplaires d'un deck multi-paquets
+func parseCodes(param string) ([]string, error) {
+	var codes []string
+	for _, code := range strings.Split(param, ",") {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		if !models.CodeValid(code) {
+			return nil, ErrInvalidCardCode
+		}
+		codes = append(codes, code)
+	}
+	if len(codes) == 0 {
+		return nil, ErrInvalidParameter
+	}
+	return codes, nil
+}
+
+// parsePosition lit le parametre optionnel ?position=top|bottom|random|N ou les cartes
+// remises sont inserees dans la pioche, N etant un index depuis le dessus
+func parsePosition(r *http.Request) (database.Position, error) {
+	return parsePositionValue(r.URL.Query().Get("position"))
+}
+
+// parsePositionValue convertit top, bottom, random ou un index en database.Position
+func parsePositionValue(v string) (database.Position, error) {
+	switch v {
+	case "", "top":
+		return database.PositionTop, nil
+	case "bottom":
+		return database.PositionBottom, nil
+	case "random":
+		return database.PositionRandom, nil
+	default:
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, ErrInvalidParameter
+		}
+		return database.Position(n), nil
+	}
+}
+
+// parseSeed lit le parametre optionnel ?seed= qui rend les melanges reproductibles
+func parseSeed(r *http.Request) (*int64, error) {
+	if !r.URL.Query().Has("seed") {
+		return nil, nil
+	}
+	seed, err := strconv.ParseInt(r.URL.Query().Get("seed"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidParameter
+	}
+	return &seed, nil
+}
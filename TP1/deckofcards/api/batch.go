@@ -0,0 +1,120 @@
+package api
+
+import (
+	"deckofcards/database"
+	"deckofcards/models"
+	"deckofcards/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// maxBatchOps nombre maximal d'operations dans un lot
+const maxBatchOps = 100
+
+// batchOpRequest operation d'un lot telle que recue en json
+type batchOpRequest struct {
+	Op       string   `json:"op"`
+	Pile     string   `json:"pile,omitempty"`
+	Cards    []string `json:"cards,omitempty"`
+	Count    int      `json:"count,omitempty"`
+	Method   string   `json:"method,omitempty"`
+	Position string   `json:"position,omitempty"`
+	Seed     *int64   `json:"seed,omitempty"`
+}
+
+// toBatchOp valide une operation et la convertit pour le Backend
+func (o batchOpRequest) toBatchOp() (database.BatchOp, error) {
+	op := database.BatchOp{Op: o.Op, Pile: o.Pile, Cards: o.Cards, Count: o.Count, Method: o.Method, Seed: o.Seed}
+	switch o.Op {
+	case "draw", "drawPile", "return", "shuffle", "addToPile":
+	default:
+		return op, fmt.Errorf("op %q: %w", o.Op, ErrInvalidMethod)
+	}
+	if (o.Op == "addToPile" || o.Op == "drawPile") && o.Pile == "" {
+		return op, fmt.Errorf("%s sans pile: %w", o.Op, ErrInvalidParameter)
+	}
+	if o.Op == "addToPile" && len(o.Cards) == 0 {
+		return op, fmt.Errorf("addToPile sans cartes: %w", ErrInvalidParameter)
+	}
+	if o.Seed != nil && (o.Op != "shuffle" || o.Pile != "") {
+		return op, fmt.Errorf("seed seulement pour shuffle de la pioche: %w", ErrInvalidParameter)
+	}
+	if o.Count < 0 {
+		return op, fmt.Errorf("count %d: %w", o.Count, ErrInvalidParameter)
+	}
+	if o.Count == 0 {
+		op.Count = 1
+	}
+	for _, code := range o.Cards {
+		if !models.CodeValid(code) {
+			return op, fmt.Errorf("%s: %w", code, ErrInvalidCardCode)
+		}
+	}
+	pos, err := parsePositionValue(o.Position)
+	if err != nil {
+		return op, err
+	}
+	op.Position = pos
+	return op, nil
+}
+
+// / Execute une liste d'operations json en une seule transaction, tout est annule a la premiere erreur
+// L'en-tete X-Actor-Id donne le joueur inscrit au journal des actions
+//
+//	[{"op":"draw","count":2},{"op":"addToPile","pile":"hand","cards":["AS"]},
+//	 {"op":"drawPile","pile":"hand","method":"bottom"},{"op":"return","position":"bottom"},
+//	 {"op":"shuffle","pile":"hand"}]
+func batch(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		actor, err := parseActor(r, "")
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var requests []batchOpRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&requests); err != nil || len(requests) == 0 {
+			writeError(w, ErrInvalidParameter, deckId)
+			return
+		}
+		if len(requests) > maxBatchOps {
+			writeError(w, ErrParameterOutOfRange, deckId)
+			return
+		}
+
+		ops := make([]database.BatchOp, len(requests))
+		for i, req := range requests {
+			op, err := req.toBatchOp()
+			if err != nil {
+				writeError(w, &database.BatchError{Index: i, Op: req.Op, Err: err}, deckId)
+				return
+			}
+			ops[i] = op
+		}
+
+		results, remaining, err := store.BatchAs(deckId, actor, ops)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		baseURL := publicURL(r, cfg)
+		resp := BatchResponse{
+			Success:   true,
+			DeckId:    deckId,
+			Remaining: remaining,
+			Results:   make([]BatchResultResponse, len(results)),
+		}
+		for i, res := range results {
+			resp.Results[i] = BatchResultResponse{Op: ops[i].Op, Cards: cardResponses(baseURL, res.Cards)}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
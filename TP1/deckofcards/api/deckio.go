@@ -0,0 +1,55 @@
+package api
+
+import (
+	"deckofcards/database"
+	"deckofcards/deckio"
+	"deckofcards/utils"
+	"net/http"
+)
+
+// / Exporte un deck, ses piles et ses cartes tirees dans un fichier json portable
+func exportDeck(store database.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+
+		snap, err := store.Snapshot(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="deck-`+deckId+`.json"`)
+		w.WriteHeader(http.StatusOK)
+		_ = deckio.Encode(w, deckio.New(snap))
+	}
+}
+
+// / Importe un fichier de deck exporte par un serveur et le cree sous un nouveau deck
+func importDeck(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+
+		file, err := deckio.Decode(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+		req := restoreRequest{Snapshot: file.Deck}
+		if err := req.validate(cfg); err != nil {
+			writeError(w, err, "")
+			return
+		}
+		deckId, err := store.RestoreSnapshot(&req.Snapshot)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+		writeRestored(w, deckId, &req.Snapshot)
+	}
+}
@@ -1,24 +1,40 @@
 package api
 
 import (
+	"deckofcards/database"
+	"deckofcards/deckio"
 	"encoding/json"
 	"errors"
 	"net/http"
 )
 
 // Error types for consistent error handling
+// Les erreurs de la base de donnees sont reprises telles quelles pour que
+// errors.Is fonctionne sur les erreurs enveloppees retournees par le Backend
 var (
-	ErrDeckNotFound   = errors.New("deck not found")
-	ErrNotEnoughCards = errors.New("not enough cards remaining")
+	ErrDeckNotFound   = database.ErrDeckNotFound
+	ErrDeckExpired    = database.ErrDeckExpired
+	ErrNotEnoughCards = database.ErrNotEnoughCards
 	ErrDeckEmpty      = errors.New("deck is empty")
 
 	ErrInvalidCardCode = errors.New("invalid card code")
-	ErrCardNotInPile   = errors.New("card not found in pile")
+	ErrCardNotInPile   = database.ErrCardNotInPile
 	ErrDuplicateCards  = errors.New("duplicate cards in request")
-	ErrCardNotInDeck   = errors.New("card not found in deck")
+	ErrCardNotInDeck   = database.ErrCardNotInDeck
+	ErrCardNotDrawn    = database.ErrCardNotDrawn
 
-	ErrPileNotFound = errors.New("pile not found")
-	ErrPileEmpty    = errors.New("pile is empty")
+	ErrPileNotFound = database.ErrPileNotFound
+	ErrPileEmpty    = database.ErrPileEmpty
+	ErrSamePile     = database.ErrSamePile
+
+	ErrNothingToUndo = database.ErrNothingToUndo
+	ErrNothingToRedo = database.ErrNothingToRedo
+	ErrLogIncomplete = database.ErrLogIncomplete
+
+	ErrInvalidSnapshot = database.ErrInvalidSnapshot
+	ErrInvalidDeckFile = deckio.ErrInvalidFile
+	ErrDeckChecksum    = deckio.ErrChecksum
+	ErrDeckFileCode    = deckio.ErrInvalidCode
 
 	ErrDatabase       = errors.New("database error")
 	ErrRequestTimeout = errors.New("request timeout")
@@ -26,13 +42,27 @@ var (
 
 	ErrInvalidParameter    = errors.New("invalid parameter")
 	ErrParameterOutOfRange = errors.New("parameter out of range")
+	ErrInvalidMethod       = database.ErrInvalidMethod
+	ErrInvalidPosition     = database.ErrInvalidPosition
 )
 
+// publicErrors erreurs dont le message est expose tel quel aux clients
+var publicErrors = []error{
+	ErrDeckNotFound, ErrDeckExpired, ErrNotEnoughCards, ErrDeckEmpty,
+	ErrInvalidCardCode, ErrCardNotInPile, ErrDuplicateCards, ErrCardNotInDeck, ErrCardNotDrawn,
+	ErrPileNotFound, ErrPileEmpty, ErrSamePile,
+	ErrNothingToUndo, ErrNothingToRedo, ErrLogIncomplete,
+	ErrInvalidSnapshot, ErrInvalidDeckFile, ErrDeckChecksum, ErrDeckFileCode,
+	ErrRequestTimeout, ErrConcurrentMod,
+	ErrInvalidParameter, ErrParameterOutOfRange, ErrInvalidMethod, ErrInvalidPosition,
+}
+
 // ErrorResponse represents structured error information
 type ErrorResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
-	DeckId  string `json:"deck_id,omitempty"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error"`
+	DeckId    string `json:"deck_id,omitempty"`
+	Operation *int   `json:"operation,omitempty"` //< index de l'operation en echec d'un lot
 }
 
 // getHTTPStatus returns the appropriate HTTP status code for an error
@@ -40,6 +70,8 @@ func getHTTPStatus(err error) int {
 	switch {
 	case errors.Is(err, ErrDeckNotFound):
 		return http.StatusNotFound
+	case errors.Is(err, ErrDeckExpired):
+		return http.StatusGone
 	case errors.Is(err, ErrPileNotFound):
 		return http.StatusNotFound
 	case errors.Is(err, ErrCardNotInDeck):
@@ -55,15 +87,39 @@ func getHTTPStatus(err error) int {
 		return http.StatusBadRequest
 	case errors.Is(err, ErrParameterOutOfRange):
 		return http.StatusBadRequest
+	case errors.Is(err, ErrInvalidMethod):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrInvalidPosition):
+		return http.StatusBadRequest
 	case errors.Is(err, ErrNotEnoughCards):
 		return http.StatusBadRequest
 	case errors.Is(err, ErrDeckEmpty):
 		return http.StatusBadRequest
 	case errors.Is(err, ErrPileEmpty):
 		return http.StatusBadRequest
+	case errors.Is(err, ErrSamePile):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrInvalidSnapshot):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrInvalidDeckFile):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrDeckChecksum):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrDeckFileCode):
+		return http.StatusBadRequest
 
+	case errors.Is(err, ErrCardNotDrawn):
+		return http.StatusConflict
+	case errors.Is(err, ErrNothingToUndo):
+		return http.StatusConflict
+	case errors.Is(err, ErrNothingToRedo):
+		return http.StatusConflict
+	case errors.Is(err, ErrLogIncomplete):
+		return http.StatusConflict
 	case errors.Is(err, ErrRequestTimeout):
 		return http.StatusServiceUnavailable
+	case errors.Is(err, database.ErrPoolClosed):
+		return http.StatusServiceUnavailable
 	case errors.Is(err, ErrConcurrentMod):
 		return http.StatusConflict
 
@@ -75,6 +131,34 @@ func getHTTPStatus(err error) int {
 	}
 }
 
+// publicError retourne l'erreur connue correspondant a err, ErrDatabase sinon
+// afin de ne pas exposer le detail des erreurs internes
+func publicError(err error) error {
+	for _, known := range publicErrors {
+		if errors.Is(err, known) {
+			return known
+		}
+	}
+	if errors.Is(err, database.ErrPoolClosed) {
+		return ErrRequestTimeout
+	}
+	return ErrDatabase
+}
+
+// ErrorFromMessage retourne l'erreur publique dont le message est msg, tel qu'ecrit dans
+// ErrorResponse.Error, ou nil si le message est inconnu
+func ErrorFromMessage(msg string) error {
+	for _, known := range publicErrors {
+		if known.Error() == msg {
+			return known
+		}
+	}
+	if msg == ErrDatabase.Error() {
+		return ErrDatabase
+	}
+	return nil
+}
+
 // writeError writes a standardized error response
 func writeError(w http.ResponseWriter, err error, deckId string) {
 	status := getHTTPStatus(err)
@@ -87,7 +171,11 @@ func writeError(w http.ResponseWriter, err error, deckId string) {
 	response := ErrorResponse{
 		Success: false,
 		DeckId:  deckId,
-		Error:   err.Error(),
+		Error:   publicError(err).Error(),
+	}
+	var batchErr *database.BatchError
+	if errors.As(err, &batchErr) {
+		response.Operation = &batchErr.Index
 	}
 
 	_ = json.NewEncoder(w).Encode(response)
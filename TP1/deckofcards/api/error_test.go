@@ -0,0 +1,35 @@
+package api
+
+import (
+	"deckofcards/database"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGetHTTPStatus_WrappedDatabaseErrors(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantPublic error
+	}{
+		{fmt.Errorf("deck abc: %w", database.ErrDeckNotFound), http.StatusNotFound, ErrDeckNotFound},
+		{fmt.Errorf("deck abc: %w", database.ErrDeckExpired), http.StatusGone, ErrDeckExpired},
+		{fmt.Errorf("pile hand: %w", database.ErrPileNotFound), http.StatusNotFound, ErrPileNotFound},
+		{fmt.Errorf("pile hand: %w", database.ErrPileEmpty), http.StatusBadRequest, ErrPileEmpty},
+		{fmt.Errorf("card AS: %w", database.ErrCardNotInPile), http.StatusNotFound, ErrCardNotInPile},
+		{fmt.Errorf("card AS: %w", database.ErrCardNotInDeck), http.StatusNotFound, ErrCardNotInDeck},
+		{fmt.Errorf("card AS: %w", database.ErrCardNotDrawn), http.StatusConflict, ErrCardNotDrawn},
+		{database.ErrPoolClosed, http.StatusServiceUnavailable, ErrRequestTimeout},
+		{errors.New("sqlite: disk I/O error"), http.StatusInternalServerError, ErrDatabase},
+	}
+	for _, tt := range tests {
+		if got := getHTTPStatus(tt.err); got != tt.wantStatus {
+			t.Errorf("getHTTPStatus(%v) = %d, want %d", tt.err, got, tt.wantStatus)
+		}
+		if got := publicError(tt.err); got != tt.wantPublic {
+			t.Errorf("publicError(%v) = %v, want %v", tt.err, got, tt.wantPublic)
+		}
+	}
+}
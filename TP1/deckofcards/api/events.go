@@ -0,0 +1,123 @@
+package api
+
+import (
+	"deckofcards/database"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second //< delai entre deux commentaires envoyes pour garder un flux inactif ouvert
+	eventPageSize     = 200              //< evenements manques lus a la fois lors d'une reprise
+)
+
+// / Diffuse les evenements d'un deck en Server-Sent Events
+// Le flux reprend apres l'en-tete Last-Event-ID, ou ?last_event_id, sinon seuls les
+// evenements a venir sont envoyes
+func deckEvents(store database.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+
+		lastId := r.Header.Get("Last-Event-ID")
+		if lastId == "" {
+			lastId = r.URL.Query().Get("last_event_id")
+		}
+		var afterId int64 = -1
+		if lastId != "" {
+			id, err := strconv.ParseInt(lastId, 10, 64)
+			if err != nil || id < 0 {
+				writeError(w, ErrInvalidParameter, deckId)
+				return
+			}
+			afterId = id
+		}
+
+		// Abonnement avant la lecture de l'historique pour ne rien manquer entre les deux
+		events, cancel := store.Subscribe(deckId)
+		defer cancel()
+
+		var backlog []database.Event
+		var err error
+		if afterId >= 0 {
+			backlog, err = store.Events(deckId, afterId, eventPageSize)
+		} else {
+			_, err = store.CardsInDeck(deckId)
+		}
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Time{})
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		send := func(ev database.Event) error {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Id, ev.Type, data); err != nil {
+				return err
+			}
+			afterId = ev.Id
+			return nil
+		}
+		// Les evenements manques sont envoyes page par page, sans garder tout l'historique
+		for {
+			for _, ev := range backlog {
+				if send(ev) != nil {
+					return
+				}
+			}
+			if len(backlog) < eventPageSize {
+				break
+			}
+			if backlog, err = store.Events(deckId, afterId, eventPageSize); err != nil {
+				return
+			}
+		}
+		if _, err := fmt.Fprint(w, ": ok\n\n"); err != nil || rc.Flush() != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					// Deck supprime apres deck_deleted, abonne trop lent ou arret du serveur:
+					// dans les deux derniers cas le client reprend avec Last-Event-ID
+					return
+				}
+				if ev.Id <= afterId {
+					continue
+				}
+				if send(ev) != nil {
+					return
+				}
+			case <-heartbeat.C:
+				// Un deck observe n'expire pas; le flux se termine s'il a ete supprime
+				if store.TouchDeck(deckId) != nil {
+					return
+				}
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+			}
+			if rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
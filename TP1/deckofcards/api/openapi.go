@@ -0,0 +1,564 @@
+package api
+
+import (
+	"deckofcards/database"
+	"deckofcards/deckio"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// openAPIPattern route de la specification openapi
+const openAPIPattern = "GET /api/openapi.json"
+
+// param parametre de requete d'un endpoint
+type param struct {
+	name string
+	typ  string //< string, integer ou boolean
+	desc string
+}
+
+// operation documentation d'un endpoint pour la specification openapi
+type operation struct {
+	summary     string
+	query       []param
+	body        interface{} //< corps json attendu, nil si aucun
+	response    interface{} //< corps json retourne en cas de succes
+	status      int         //< statut en cas de succes, 200 par defaut
+	contentType string      //< type de la reponse si elle n'est pas json
+	errors      []error     //< erreurs propres a l'endpoint, en plus des erreurs communes
+}
+
+// Parametres de requete communs a plusieurs endpoints
+var (
+	countParam     = param{"count", "integer", "nombre de cartes, 1 par defaut"}
+	cardsParam     = param{"cards", "string", "codes de cartes separes par des virgules"}
+	seedParam      = param{"seed", "integer", "graine pour un melange reproductible"}
+	deckCountParam = param{"deck_count", "integer", "nombre de paquets, 1 par defaut"}
+	actorParam     = param{"actor", "string", "joueur inscrit au journal pour les commandes de la connexion"}
+	jokersParam    = param{"jokers_enabled", "boolean", "ajoute deux jokers par paquet"}
+	positionParam  = param{"position", "string", "top (defaut), bottom, random ou un index depuis le dessus"}
+	fromParam      = param{"from", "string", "top (defaut) ou bottom"}
+)
+
+// Erreurs communes aux groupes d'endpoints
+var (
+	codeErrors   = []error{ErrInvalidCardCode, ErrInvalidParameter}
+	returnErrors = []error{ErrInvalidCardCode, ErrInvalidParameter, ErrCardNotDrawn, ErrCardNotInDeck}
+)
+
+// operations documentation de chaque motif retourne par routes
+var operations = map[string]operation{
+	"GET /api/deck/new/{$}": {
+		summary:  "Cree un deck standard ou personnalise, non melange",
+		query:    []param{cardsParam, deckCountParam, jokersParam, seedParam},
+		response: Response{},
+		errors:   []error{ErrInvalidCardCode, ErrDuplicateCards, ErrInvalidParameter, ErrParameterOutOfRange},
+	},
+	"GET /api/deck/new/draw/{$}": {
+		summary:  "Cree un deck melange et pige des cartes",
+		query:    []param{countParam, seedParam},
+		response: Response{},
+		errors:   []error{ErrInvalidParameter},
+	},
+	"GET /api/deck/new/shuffle/{$}": {
+		summary:  "Cree un deck melange",
+		query:    []param{cardsParam, deckCountParam, jokersParam, seedParam},
+		response: Response{},
+		errors:   []error{ErrInvalidCardCode, ErrParameterOutOfRange, ErrInvalidParameter},
+	},
+	"GET /api/deck/{deck_id}/shuffle/{$}": {
+		summary:  "Melange la pioche et les piles",
+		query:    []param{{"remaining", "boolean", "ne melange que la pioche"}, seedParam},
+		response: Response{},
+		errors:   []error{ErrInvalidParameter},
+	},
+	"GET /api/deck/{deck_id}/draw/{$}": {
+		summary:  "Pige des cartes du dessus de la pioche, ou les cartes demandees",
+		query:    []param{countParam, cardsParam},
+		response: Response{},
+		errors:   append([]error{ErrDeckEmpty, ErrCardNotInDeck}, codeErrors...),
+	},
+	"GET /api/deck/{deck_id}/draw/bottom/{$}": {
+		summary:  "Pige des cartes du dessous de la pioche",
+		query:    []param{countParam, cardsParam},
+		response: Response{},
+		errors:   append([]error{ErrDeckEmpty, ErrCardNotInDeck}, codeErrors...),
+	},
+	"GET /api/deck/{deck_id}/draw/random/{$}": {
+		summary:  "Pige des cartes au hasard dans la pioche",
+		query:    []param{countParam, cardsParam},
+		response: Response{},
+		errors:   append([]error{ErrDeckEmpty, ErrCardNotInDeck}, codeErrors...),
+	},
+	"GET /api/deck/{deck_id}/pile/{pile_name}/add/{$}": {
+		summary:  "Ajoute des cartes tirees sur le dessus d'une pile",
+		query:    []param{cardsParam},
+		response: Response{},
+		errors:   append([]error{ErrCardNotDrawn, ErrCardNotInDeck, ErrDuplicateCards}, codeErrors...),
+	},
+	"GET /api/deck/{deck_id}/pile/{pile_name}/list/{$}": {
+		summary:  "Liste les piles et les cartes de la pile demandee",
+		response: Response{},
+		errors:   []error{ErrPileNotFound},
+	},
+	"GET /api/deck/{deck_id}/pile/{pile_name}/shuffle/{$}": {
+		summary:  "Melange une pile",
+		response: Response{},
+		errors:   []error{ErrPileNotFound},
+	},
+	"POST /api/deck/{deck_id}/deal/{$}": {
+		summary: "Distribue des cartes de la pioche a plusieurs piles",
+		query: []param{
+			{"piles", "string", "noms des piles separes par des virgules"},
+			countParam,
+			{"mode", "string", "roundrobin (defaut) ou block"},
+		},
+		response: Response{},
+		errors:   []error{ErrInvalidParameter, ErrInvalidMethod, ErrNotEnoughCards},
+	},
+	"POST /api/deck/{deck_id}/batch/{$}": {
+		summary:  "Execute une liste d'operations en une seule transaction",
+		body:     []batchOpRequest{},
+		response: BatchResponse{},
+		errors: []error{
+			ErrInvalidParameter, ErrParameterOutOfRange, ErrInvalidMethod, ErrInvalidCardCode,
+			ErrDeckEmpty, ErrPileNotFound, ErrPileEmpty, ErrCardNotInDeck, ErrCardNotInPile, ErrCardNotDrawn,
+		},
+	},
+	"POST /api/deck/{deck_id}/pile/{pile_name}/move/{to_pile}/{$}": {
+		summary:  "Deplace des cartes d'une pile vers une autre",
+		query:    []param{cardsParam, countParam, fromParam},
+		response: Response{},
+		errors:   append([]error{ErrPileNotFound, ErrPileEmpty, ErrCardNotInPile, ErrSamePile}, codeErrors...),
+	},
+	"GET /api/deck/{deck_id}/peek/{$}": {
+		summary:  "Retourne les cartes du dessus de la pioche sans les tirer",
+		query:    []param{countParam},
+		response: Response{},
+		errors:   []error{ErrInvalidParameter},
+	},
+	"GET /api/deck/{deck_id}/pile/{pile_name}/peek/{$}": {
+		summary:  "Retourne les cartes d'une pile sans les tirer",
+		query:    []param{countParam, fromParam},
+		response: Response{},
+		errors:   []error{ErrInvalidParameter, ErrPileNotFound},
+	},
+	"GET /api/deck/{deck_id}/events/{$}": {
+		summary:     "Flux Server-Sent Events des modifications du deck (drawn, shuffled, pile_added, pile_drawn, pile_deleted, returned, undone, redone, deck_deleted)",
+		query:       []param{{"last_event_id", "integer", "reprend apres cet evenement, comme l'en-tete Last-Event-ID"}},
+		contentType: "text/event-stream",
+		errors:      []error{ErrInvalidParameter},
+	},
+	"POST /api/deck/{deck_id}/undo/{$}": {
+		summary:  "Annule la derniere operation du deck",
+		response: HistoryResponse{},
+		errors:   []error{ErrNothingToUndo, ErrLogIncomplete},
+	},
+	"POST /api/deck/{deck_id}/redo/{$}": {
+		summary:  "Retablit la derniere operation annulee du deck",
+		response: HistoryResponse{},
+		errors:   []error{ErrNothingToRedo, ErrLogIncomplete},
+	},
+	"GET /api/deck/{deck_id}/log/{$}": {
+		summary: "Journal des actions du deck, dans l'ordre",
+		query: []param{
+			{"after", "integer", "actions d'id superieur seulement"},
+			{"limit", "integer", "nombre maximal d'actions, 100 par defaut"},
+		},
+		response: LogResponse{},
+		errors:   []error{ErrInvalidParameter, ErrParameterOutOfRange},
+	},
+	"GET /api/deck/{deck_id}/log/{action_id}/{$}": {
+		summary:  "Pioche et piles du deck apres l'action action_id, reconstruites depuis le journal",
+		response: ReplayResponse{},
+		errors:   []error{ErrInvalidParameter, ErrLogIncomplete},
+	},
+	"POST /api/deck/{deck_id}/snapshot/{$}": {
+		summary:  "Position de jeu du deck (pioche, piles et inventaire) en json versionne",
+		response: database.Snapshot{},
+	},
+	"POST /api/deck/{deck_id}/fork/{$}": {
+		summary:  "Copie la position de jeu du deck sous un nouveau deck",
+		response: Response{},
+		status:   http.StatusCreated,
+	},
+	"POST /api/deck/restore/{$}": {
+		summary:  "Recree la position de jeu d'un snapshot sous un nouveau deck",
+		body:     database.Snapshot{},
+		response: Response{},
+		status:   http.StatusCreated,
+		errors:   []error{ErrInvalidSnapshot, ErrInvalidParameter, ErrParameterOutOfRange},
+	},
+	"GET /api/deck/{deck_id}/export/{$}": {
+		summary:  "Exporte le deck, ses piles et ses cartes tirees dans un fichier json portable",
+		response: deckio.File{},
+	},
+	"POST /api/deck/import/{$}": {
+		summary:  "Importe un fichier de deck sous un nouveau deck",
+		body:     deckio.File{},
+		response: Response{},
+		status:   http.StatusCreated,
+		errors:   []error{ErrInvalidDeckFile, ErrDeckChecksum, ErrDeckFileCode, ErrInvalidSnapshot, ErrParameterOutOfRange},
+	},
+	"/api/deck/{deck_id}/pile/{pile_name}/draw/{$}": {
+		summary:  "Pige des cartes du dessus d'une pile, ou les cartes demandees",
+		query:    []param{countParam, cardsParam},
+		response: Response{},
+		errors:   append([]error{ErrPileNotFound, ErrPileEmpty, ErrCardNotInPile}, codeErrors...),
+	},
+	"/api/deck/{deck_id}/pile/{pile_name}/draw/bottom/{$}": {
+		summary:  "Pige des cartes du dessous d'une pile",
+		query:    []param{countParam, cardsParam},
+		response: Response{},
+		errors:   append([]error{ErrPileNotFound, ErrPileEmpty, ErrCardNotInPile}, codeErrors...),
+	},
+	"/api/deck/{deck_id}/pile/{pile_name}/draw/random/{$}": {
+		summary:  "Pige des cartes au hasard dans une pile",
+		query:    []param{countParam, cardsParam},
+		response: Response{},
+		errors:   append([]error{ErrPileNotFound, ErrPileEmpty, ErrCardNotInPile}, codeErrors...),
+	},
+	"/api/deck/{deck_id}/return/{$}": {
+		summary:  "Remet des cartes tirees dans la pioche, toutes si cards est absent",
+		query:    []param{cardsParam, {"img", "string", "ancien nom de cards"}, positionParam},
+		response: Response{},
+		errors:   returnErrors,
+	},
+	"/api/deck/{deck_id}/pile/{pile_name}/return/{$}": {
+		summary:  "Remet des cartes d'une pile dans la pioche, toutes si cards est absent",
+		query:    []param{cardsParam, {"img", "string", "ancien nom de cards"}, positionParam},
+		response: Response{},
+		errors:   append([]error{ErrPileNotFound, ErrCardNotInPile}, returnErrors...),
+	},
+	"GET /api/deck/{deck_id}/{$}": {
+		summary:  "Retourne l'etat d'un deck sans tirer de carte",
+		query:    []param{{"reveal", "boolean", "ajoute l'ordre de la pioche"}},
+		response: DeckStateResponse{},
+		errors:   []error{ErrInvalidParameter},
+	},
+	"DELETE /api/deck/{deck_id}/{$}": {
+		summary:  "Supprime un deck et toutes ses piles",
+		response: Response{},
+	},
+	"DELETE /api/deck/{deck_id}/pile/{pile_name}/{$}": {
+		summary:  "Supprime une pile, ses cartes redeviennent tirees",
+		response: Response{},
+		errors:   []error{ErrPileNotFound},
+	},
+
+	"POST /api/v2/deck/{$}": {
+		summary:  "Cree un deck standard ou personnalise, melange et pige au besoin",
+		body:     newDeckRequest{},
+		response: Response{},
+		status:   http.StatusCreated,
+		errors:   []error{ErrInvalidParameter, ErrParameterOutOfRange, ErrInvalidCardCode, ErrDuplicateCards},
+	},
+	"GET /api/v2/deck/{deck_id}/{$}": {
+		summary:  "Retourne l'etat d'un deck sans tirer de carte",
+		query:    []param{{"reveal", "boolean", "ajoute l'ordre de la pioche"}},
+		response: DeckStateResponse{},
+		errors:   []error{ErrInvalidParameter},
+	},
+	"POST /api/v2/deck/{deck_id}/undo/{$}": {
+		summary:  "Annule la derniere operation du deck",
+		response: HistoryResponse{},
+		errors:   []error{ErrNothingToUndo, ErrLogIncomplete},
+	},
+	"POST /api/v2/deck/{deck_id}/redo/{$}": {
+		summary:  "Retablit la derniere operation annulee du deck",
+		response: HistoryResponse{},
+		errors:   []error{ErrNothingToRedo, ErrLogIncomplete},
+	},
+	"DELETE /api/v2/deck/{deck_id}/{$}": {
+		summary:  "Supprime un deck et toutes ses piles",
+		response: Response{},
+	},
+	"POST /api/v2/deck/{deck_id}/draw/{$}": {
+		summary:  "Pige des cartes de la pioche",
+		body:     drawRequest{},
+		response: Response{},
+		errors:   append([]error{ErrInvalidMethod, ErrDeckEmpty, ErrCardNotInDeck}, codeErrors...),
+	},
+	"POST /api/v2/deck/{deck_id}/shuffle/{$}": {
+		summary:  "Melange la pioche, et les piles sauf si remaining_only",
+		body:     shuffleRequest{},
+		response: Response{},
+		errors:   []error{ErrInvalidParameter},
+	},
+	"POST /api/v2/deck/{deck_id}/return/{$}": {
+		summary:  "Remet des cartes tirees dans la pioche, toutes si cards est vide",
+		body:     returnRequest{},
+		response: Response{},
+		errors:   returnErrors,
+	},
+	"POST /api/v2/deck/{deck_id}/deal/{$}": {
+		summary:  "Distribue des cartes de la pioche a plusieurs piles",
+		body:     dealRequest{},
+		response: Response{},
+		errors:   []error{ErrInvalidParameter, ErrInvalidMethod, ErrNotEnoughCards},
+	},
+	"POST /api/v2/deck/{deck_id}/batch/{$}": {
+		summary:  "Execute une liste d'operations en une seule transaction",
+		body:     []batchOpRequest{},
+		response: BatchResponse{},
+		errors: []error{
+			ErrInvalidParameter, ErrParameterOutOfRange, ErrInvalidMethod, ErrInvalidCardCode,
+			ErrDeckEmpty, ErrPileNotFound, ErrPileEmpty, ErrCardNotInDeck, ErrCardNotInPile, ErrCardNotDrawn,
+		},
+	},
+	"GET /api/v2/deck/{deck_id}/peek/{$}": {
+		summary:  "Retourne les cartes du dessus de la pioche sans les tirer",
+		query:    []param{countParam},
+		response: Response{},
+		errors:   []error{ErrInvalidParameter},
+	},
+	"GET /api/v2/deck/{deck_id}/piles/{$}": {
+		summary:  "Liste les piles d'un deck",
+		response: Response{},
+	},
+	"GET /api/v2/deck/{deck_id}/piles/{pile_name}/{$}": {
+		summary:  "Liste les piles et les cartes de la pile demandee",
+		response: Response{},
+		errors:   []error{ErrPileNotFound},
+	},
+	"PATCH /api/v2/deck/{deck_id}/piles/{pile_name}/{$}": {
+		summary:  "Ajoute des cartes tirees sur le dessus d'une pile, creee au besoin",
+		body:     addToPileRequest{},
+		response: Response{},
+		errors:   append([]error{ErrCardNotDrawn, ErrCardNotInDeck, ErrDuplicateCards}, codeErrors...),
+	},
+	"DELETE /api/v2/deck/{deck_id}/piles/{pile_name}/{$}": {
+		summary:  "Supprime une pile, ses cartes redeviennent tirees",
+		response: Response{},
+		errors:   []error{ErrPileNotFound},
+	},
+	"GET /api/v2/deck/{deck_id}/piles/{pile_name}/peek/{$}": {
+		summary:  "Retourne les cartes d'une pile sans les tirer",
+		query:    []param{countParam, fromParam},
+		response: Response{},
+		errors:   []error{ErrInvalidParameter, ErrPileNotFound},
+	},
+	"POST /api/v2/deck/{deck_id}/piles/{pile_name}/draw/{$}": {
+		summary:  "Pige des cartes d'une pile",
+		body:     drawRequest{},
+		response: Response{},
+		errors:   append([]error{ErrInvalidMethod, ErrPileNotFound, ErrPileEmpty, ErrCardNotInPile}, codeErrors...),
+	},
+	"POST /api/v2/deck/{deck_id}/piles/{pile_name}/shuffle/{$}": {
+		summary:  "Melange une pile",
+		response: Response{},
+		errors:   []error{ErrPileNotFound},
+	},
+	"POST /api/v2/deck/{deck_id}/piles/{pile_name}/return/{$}": {
+		summary:  "Remet des cartes d'une pile dans la pioche, toutes si cards est vide",
+		body:     returnRequest{},
+		response: Response{},
+		errors:   append([]error{ErrPileNotFound, ErrCardNotInPile}, returnErrors...),
+	},
+	"POST /api/v2/deck/{deck_id}/piles/{pile_name}/move/{$}": {
+		summary:  "Deplace des cartes d'une pile vers la pile to",
+		body:     moveRequest{},
+		response: Response{},
+		errors:   append([]error{ErrPileNotFound, ErrPileEmpty, ErrCardNotInPile, ErrSamePile}, codeErrors...),
+	},
+
+	"GET /ws/deck/{deck_id}": {
+		summary: "Table de jeu websocket: commandes json (op draw, addToPile, drawPile, return, shuffle, undo, redo ou state) " +
+			"et diffusion des evenements du deck",
+		query:  []param{actorParam},
+		status: http.StatusSwitchingProtocols,
+		errors: []error{ErrInvalidParameter},
+	},
+
+	"GET /static/img/{filename}": {
+		summary:     "Image svg d'une carte",
+		contentType: "image/svg+xml",
+	},
+	"GET /{$}": {
+		summary:     "Page d'accueil",
+		contentType: "text/html",
+	},
+	openAPIPattern: {
+		summary:     "Specification openapi de l'api",
+		contentType: "application/json",
+	},
+}
+
+// pathParamRe parametres de chemin d'un motif http.ServeMux
+var pathParamRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// serveOpenAPI retourne la specification openapi des motifs patterns, generee une seule fois
+func serveOpenAPI(patterns []string) http.HandlerFunc {
+	spec, err := json.Marshal(buildOpenAPI(patterns))
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(spec)
+	}
+}
+
+// buildOpenAPI genere la specification openapi 3 des motifs a partir de operations,
+// les statuts d'erreur sont ceux de getHTTPStatus
+func buildOpenAPI(patterns []string) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]map[string]interface{})
+
+	for _, pattern := range patterns {
+		op := operations[pattern]
+		method, path, found := strings.Cut(pattern, " ")
+		if !found {
+			// Sans methode le motif accepte toutes les methodes, documente en GET
+			method, path = "GET", pattern
+		}
+		path = strings.TrimSuffix(path, "{$}")
+
+		var params []interface{}
+		for _, m := range pathParamRe.FindAllStringSubmatch(path, -1) {
+			params = append(params, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]string{"type": "string"},
+			})
+		}
+		for _, p := range op.query {
+			params = append(params, map[string]interface{}{
+				"name": p.name, "in": "query", "description": p.desc, "schema": map[string]string{"type": p.typ},
+			})
+		}
+
+		status := op.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		switch {
+		case op.response != nil:
+			success["content"] = jsonContent(schemaOf(reflect.TypeOf(op.response), schemas))
+		case op.contentType != "":
+			success["content"] = map[string]interface{}{op.contentType: map[string]interface{}{}}
+		}
+		responses := map[string]interface{}{strconv.Itoa(status): success}
+		if strings.HasPrefix(path, "/api/deck/") || strings.HasPrefix(path, "/api/v2/") || strings.HasPrefix(path, "/ws/") {
+			errResp := jsonContent(schemaOf(reflect.TypeOf(ErrorResponse{}), schemas))
+			for code, desc := range errorStatuses(path, op.errors) {
+				responses[strconv.Itoa(code)] = map[string]interface{}{"description": desc, "content": errResp}
+			}
+		}
+
+		doc := map[string]interface{}{
+			"summary":   op.summary,
+			"responses": responses,
+		}
+		if len(params) > 0 {
+			doc["parameters"] = params
+		}
+		if op.body != nil {
+			doc["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(schemaOf(reflect.TypeOf(op.body), schemas)),
+			}
+		}
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(method)] = doc
+	}
+
+	return map[string]interface{}{
+		"openapi":    "3.0.3",
+		"info":       map[string]string{"title": "Deck of cards API", "version": "2"},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// errorStatuses regroupe par statut http les erreurs d'un endpoint et les erreurs communes
+func errorStatuses(path string, errs []error) map[int]string {
+	all := append([]error{ErrRequestTimeout, ErrDatabase}, errs...)
+	if strings.Contains(path, "{deck_id}") {
+		all = append(all, ErrDeckNotFound, ErrDeckExpired)
+	}
+	messages := make(map[int][]string)
+	for _, err := range all {
+		code := getHTTPStatus(err)
+		if msg := err.Error(); !slices.Contains(messages[code], msg) {
+			messages[code] = append(messages[code], msg)
+		}
+	}
+	statuses := make(map[int]string, len(messages))
+	for code, msgs := range messages {
+		slices.Sort(msgs)
+		statuses[code] = strings.Join(msgs, ", ")
+	}
+	return statuses
+}
+
+// jsonContent contenu application/json d'un corps de requete ou de reponse
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// schemaOf retourne le schema openapi de t, les structures sont ajoutees a schemas et referencees
+// Un champ json sans omitempty est requis
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Uint, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+	default:
+		return map[string]interface{}{}
+	}
+
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + string(name)}
+	if _, done := schemas[string(name)]; done {
+		return ref
+	}
+	schemas[string(name)] = nil // reserve le nom pour les types recursifs
+
+	props := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		props[tag] = schemaOf(f.Type, schemas)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, tag)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	schemas[string(name)] = schema
+	return ref
+}
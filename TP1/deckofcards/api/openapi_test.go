@@ -0,0 +1,136 @@
+package api
+
+import (
+	"deckofcards/database"
+	"deckofcards/models"
+	"deckofcards/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Chaque route enregistree doit etre decrite dans operations, et inversement
+func TestOpenAPI_CoversRoutes(t *testing.T) {
+	registered := make(map[string]bool)
+	for _, rt := range routes(nil, utils.DefaultConfig()) {
+		registered[rt.pattern] = true
+		if _, ok := operations[rt.pattern]; !ok {
+			t.Errorf("route %q has no openapi operation", rt.pattern)
+		}
+	}
+	for pattern := range operations {
+		if !registered[pattern] {
+			t.Errorf("openapi operation %q matches no route", pattern)
+		}
+	}
+}
+
+func TestOpenAPI_Served(t *testing.T) {
+	var handler http.HandlerFunc
+	for _, rt := range routes(nil, utils.DefaultConfig()) {
+		if rt.pattern == openAPIPattern {
+			handler = rt.handler
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Responses   map[string]json.RawMessage `json:"responses"`
+			RequestBody json.RawMessage            `json:"requestBody"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+
+	draw := spec.Paths["/api/deck/{deck_id}/pile/{pile_name}/draw/"]["get"]
+	for _, status := range []string{"200", "400", "404", "410", "500", "503"} {
+		if _, ok := draw.Responses[status]; !ok {
+			t.Errorf("pile draw is missing status %s", status)
+		}
+	}
+	if spec.Paths["/api/v2/deck/{deck_id}/piles/{pile_name}/"]["patch"].RequestBody == nil {
+		t.Error("PATCH pile has no request body")
+	}
+	for _, name := range []string{"Response", "PileResponse", "CardResponse", "ErrorResponse", "DrawRequest"} {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+}
+
+// Chaque requete provoque une erreur attendue, qui doit figurer dans l'operation de sa route
+// %s est remplace par un deck neuf; les erreurs de deck absent ou expire sont implicites
+func TestOpenAPI_DocumentsErrors(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	store := database.NewMemoryStore(cfg)
+	srv := httptest.NewServer(NewHandler(store, cfg))
+	defer srv.Close()
+
+	tests := []struct {
+		pattern string
+		method  string
+		path    string
+		body    string
+		want    error
+	}{
+		{"DELETE /api/deck/{deck_id}/{$}", "DELETE", "/api/deck/absent/", "", ErrDeckNotFound},
+		{"GET /api/deck/{deck_id}/draw/{$}", "GET", "/api/deck/%s/draw/?cards=ZZ", "", ErrInvalidCardCode},
+		{"GET /api/deck/{deck_id}/pile/{pile_name}/list/{$}", "GET", "/api/deck/%s/pile/absente/list/", "", ErrPileNotFound},
+		{"GET /api/deck/{deck_id}/log/{action_id}/{$}", "GET", "/api/deck/%s/log/abc/", "", ErrInvalidParameter},
+		{"POST /api/deck/{deck_id}/undo/{$}", "POST", "/api/deck/%s/undo/", "", ErrNothingToUndo},
+		{"POST /api/v2/deck/{deck_id}/redo/{$}", "POST", "/api/v2/deck/%s/redo/", "", ErrNothingToRedo},
+		{"POST /api/v2/deck/{deck_id}/draw/{$}", "POST", "/api/v2/deck/%s/draw/", `{"method":"middle"}`, ErrInvalidMethod},
+		{"POST /api/v2/deck/{deck_id}/return/{$}", "POST", "/api/v2/deck/%s/return/", `{"cards":["AS"]}`, ErrCardNotDrawn},
+		{"POST /api/v2/deck/{deck_id}/deal/{$}", "POST", "/api/v2/deck/%s/deal/", `{"piles":["a"],"count":60}`, ErrNotEnoughCards},
+		{"PATCH /api/v2/deck/{deck_id}/piles/{pile_name}/{$}", "PATCH", "/api/v2/deck/%s/piles/hand/", `{"cards":["AS"]}`, ErrCardNotDrawn},
+		{"POST /api/v2/deck/{deck_id}/piles/{pile_name}/move/{$}", "POST", "/api/v2/deck/%s/piles/hand/move/", `{"to":"hand"}`, ErrSamePile},
+		{"POST /api/deck/import/{$}", "POST", "/api/deck/import/", `{}`, ErrInvalidDeckFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			op, ok := operations[tt.pattern]
+			if !ok {
+				t.Fatalf("no openapi operation %q", tt.pattern)
+			}
+			documented := op.errors
+			if strings.Contains(tt.pattern, "{deck_id}") {
+				documented = append(documented, ErrDeckNotFound, ErrDeckExpired)
+			}
+			if !slices.Contains(documented, tt.want) {
+				t.Errorf("%q is not documented for %s", tt.want, tt.pattern)
+			}
+
+			path := tt.path
+			if strings.Contains(path, "%s") {
+				deckId, err := store.InsertDeck(models.NewMultiDeck(1, false))
+				if err != nil {
+					t.Fatalf("InsertDeck: %v", err)
+				}
+				path = fmt.Sprintf(path, deckId)
+			}
+			req, _ := http.NewRequest(tt.method, srv.URL+path, strings.NewReader(tt.body))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s: %v", tt.method, path, err)
+			}
+			defer resp.Body.Close()
+			var body ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decode error response: %v", err)
+			}
+			if got := ErrorFromMessage(body.Error); got != tt.want || resp.StatusCode != getHTTPStatus(tt.want) {
+				t.Errorf("%s %s = %d %q, want %d %q", tt.method, path, resp.StatusCode, body.Error, getHTTPStatus(tt.want), tt.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,14 @@
 package api
 
+import (
+	"deckofcards/database"
+	"deckofcards/models"
+	"deckofcards/utils"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
 type CardResponse struct {
 	Code  string `json:"code"`
 	Image string `json:"image"`
@@ -19,5 +28,126 @@ type Response struct {
 	Piles     map[string]PileResponse `json:"piles,omitempty"`
 	Cards     []CardResponse          `json:"img,omitempty"`
 	Shuffled  *bool                   `json:"shuffled,omitempty"`
+	Seed      *int64                  `json:"seed,omitempty"`
 	Error     string                  `json:"error,omitempty"`
 }
+
+// EntryResponse inventaire d'un code de carte
+type EntryResponse struct {
+	Total  int `json:"total"`
+	InDeck int `json:"in_deck"`
+	InPile int `json:"in_pile"`
+	Drawn  int `json:"drawn"`
+}
+
+// DeckStateResponse etat d'un deck retourne par GET /api/deck/{deck_id}/
+type DeckStateResponse struct {
+	Success   bool                     `json:"success"`
+	DeckId    string                   `json:"deck_id"`
+	Remaining int                      `json:"remaining"`
+	Shuffled  bool                     `json:"shuffled"`
+	Seed      *int64                   `json:"seed,omitempty"`
+	Drawn     int                      `json:"drawn"`
+	Piles     map[string]PileResponse  `json:"piles"`
+	Entries   map[string]EntryResponse `json:"entries"`
+	Cards     []CardResponse           `json:"img,omitempty"`
+	LastEvent int64                    `json:"last_event_id"` //< reprise du flux d'evenements apres cet etat
+}
+
+// HistoryResponse reponse d'une annulation ou d'un retablissement
+type HistoryResponse struct {
+	Success bool              `json:"success"`
+	DeckId  string            `json:"deck_id"`
+	Op      string            `json:"op"` //< operation annulee ou retablie
+	State   DeckStateResponse `json:"state"`
+}
+
+// LogResponse actions du journal d'un deck
+type LogResponse struct {
+	Success bool              `json:"success"`
+	DeckId  string            `json:"deck_id"`
+	Actions []database.Action `json:"actions"`
+}
+
+// ReplayResponse etat d'un deck reconstruit depuis son journal
+type ReplayResponse struct {
+	Success bool                    `json:"success"`
+	DeckId  string                  `json:"deck_id"`
+	Action  int64                   `json:"action_id"` //< derniere action rejouee
+	Cards   []CardResponse          `json:"cards"`     //< pioche du dessus vers le dessous
+	Piles   map[string]PileResponse `json:"piles"`
+}
+
+// WSMessage message envoye sur /ws/deck/{deck_id}
+type WSMessage struct {
+	Type      string             `json:"type"`         //< state, result, error ou event
+	Id        json.RawMessage    `json:"id,omitempty"` //< id de la commande a laquelle le message repond
+	Op        string             `json:"op,omitempty"`
+	Cards     []CardResponse     `json:"cards,omitempty"`
+	Remaining *int               `json:"remaining,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	State     *DeckStateResponse `json:"state,omitempty"`
+	Event     *database.Event    `json:"event,omitempty"`
+}
+
+// BatchResultResponse resultat d'une operation d'un lot
+type BatchResultResponse struct {
+	Op    string         `json:"op"`
+	Cards []CardResponse `json:"img,omitempty"`
+}
+
+// BatchResponse reponse de POST /api/deck/{deck_id}/batch/
+type BatchResponse struct {
+	Success   bool                  `json:"success"`
+	DeckId    string                `json:"deck_id"`
+	Remaining int                   `json:"remaining"`
+	Results   []BatchResultResponse `json:"results"`
+}
+
+// publicURL retourne l'url publique du serveur: cfg.PublicURL si definie, sinon
+// deduite de l'en-tete Host. Les en-tetes X-Forwarded-Proto/Host/Prefix ne sont lus
+// que si cfg.TrustProxy, n'importe quel client pouvant les fixer
+func publicURL(r *http.Request, cfg *utils.Config) string {
+	if cfg.PublicURL != "" {
+		return strings.TrimRight(cfg.PublicURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if !cfg.TrustProxy {
+		return scheme + "://" + r.Host
+	}
+	if proto := forwardedHeader(r, "X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := r.Host
+	if h := forwardedHeader(r, "X-Forwarded-Host"); h != "" {
+		host = h
+	}
+	prefix := strings.TrimRight(forwardedHeader(r, "X-Forwarded-Prefix"), "/")
+	return scheme + "://" + host + prefix
+}
+
+// forwardedHeader retourne la premiere valeur d'un en-tete X-Forwarded-* (le client d'origine)
+func forwardedHeader(r *http.Request, name string) string {
+	value, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(value)
+}
+
+// cardResponses construit les reponses des cartes avec leurs images servies par baseURL
+func cardResponses(baseURL string, codes []string) []CardResponse {
+	responses := make([]CardResponse, len(codes))
+	for i, code := range codes {
+		value, _ := models.GetValue(code)
+		suit, _ := models.GetSuit(code)
+		responses[i] = CardResponse{
+			Code:  code,
+			Image: baseURL + "/static/img/" + code + ".svg",
+			Value: value,
+			Suit:  suit,
+		}
+	}
+	return responses
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"deckofcards/utils"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublicURL_ForwardedHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  utils.Config
+		want string
+	}{
+		{"untrusted headers are ignored", utils.Config{}, "http://deck.local"},
+		{"trusted proxy", utils.Config{TrustProxy: true}, "https://cards.example.com/deck"},
+		{"configured url wins", utils.Config{PublicURL: "https://static.example.com/", TrustProxy: true}, "https://static.example.com"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://deck.local/api/deck/new/", nil)
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "cards.example.com, proxy.internal")
+		r.Header.Set("X-Forwarded-Prefix", "/deck/")
+		if got := publicURL(r, &tt.cfg); got != tt.want {
+			t.Errorf("%s: publicURL = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
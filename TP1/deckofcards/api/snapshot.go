@@ -0,0 +1,111 @@
+package api
+
+import (
+	"deckofcards/database"
+	"deckofcards/models"
+	"deckofcards/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// restoreRequest corps d'une restauration: un snapshot tel que retourne par /snapshot/
+type restoreRequest struct {
+	database.Snapshot
+}
+
+func (req *restoreRequest) validate(cfg *utils.Config) error {
+	// Un snapshot ne peut pas contenir plus de cartes que le plus grand deck creable
+	limit := max(cfg.MaxDecks*len(models.NewMultiDeck(1, true).Cards), cfg.CustomDeckCardsLimit)
+	total := 0
+	for _, entry := range req.Entries {
+		total += entry.Total
+	}
+	if total > limit {
+		return fmt.Errorf("%d cartes: %w", total, ErrParameterOutOfRange)
+	}
+	return req.Validate()
+}
+
+// / Retourne la position de jeu d'un deck (pioche, piles et inventaire) en json versionne
+func snapshotDeck(store database.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+
+		snap, err := store.Snapshot(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(snap)
+	}
+}
+
+// / Recree la position de jeu d'un snapshot sous un nouveau deck
+func restoreDeck(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+
+		var req restoreRequest
+		if err := decodeBody(w, r, cfg, &req); err != nil {
+			writeError(w, err, "")
+			return
+		}
+		deckId, err := store.RestoreSnapshot(&req.Snapshot)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+		writeRestored(w, deckId, &req.Snapshot)
+	}
+}
+
+// / Copie la position de jeu actuelle d'un deck sous un nouveau deck
+func forkDeck(store database.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		snap, err := store.Snapshot(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		forkId, err := store.RestoreSnapshot(snap)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		writeRestored(w, forkId, snap)
+	}
+}
+
+// writeRestored ecrit la reponse de creation d'un deck restaure depuis snap
+func writeRestored(w http.ResponseWriter, deckId string, snap *database.Snapshot) {
+	piles := make(map[string]PileResponse, len(snap.Piles))
+	for name, cards := range snap.Piles {
+		piles[name] = PileResponse{Remaining: len(cards)}
+	}
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(Response{
+		Success:   true,
+		DeckId:    deckId,
+		Remaining: len(snap.Cards),
+		Piles:     piles,
+		Shuffled:  &snap.Shuffled,
+		Seed:      snap.Seed,
+	})
+}
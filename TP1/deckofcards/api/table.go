@@ -0,0 +1,239 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"deckofcards/database"
+	"deckofcards/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+const (
+	wsResultBuffer = 16               //< reponses en attente d'envoi, la lecture des commandes s'arrete au-dela
+	wsPingInterval = 30 * time.Second //< intervalle des pings, un client qui n'y repond pas dans le meme delai est deconnecte
+	wsWriteTimeout = 10 * time.Second //< delai maximal d'ecriture d'un message, un client bloque est deconnecte
+)
+
+// wsCommand commande recue sur /ws/deck/{deck_id}: une operation de lot, "undo", "redo" ou "state"
+type wsCommand struct {
+	Id json.RawMessage `json:"id,omitempty"` //< renvoye tel quel dans la reponse
+	batchOpRequest
+}
+
+// / Table de jeu websocket: execute les commandes json recues avec le Backend et
+// diffuse les modifications du deck a toutes les connexions de la table
+// ?actor= (ou X-Actor-Id) donne le joueur inscrit au journal pour les commandes recues
+// Seules les pages du meme hote ou de cfg.AllowedOrigins peuvent ouvrir une table
+//
+//	-> {"id":1,"op":"draw","count":2}
+//	<- {"type":"result","id":1,"op":"draw","cards":[...],"remaining":50}
+//	<- {"type":"event","event":{"id":7,"type":"drawn","cards":["AS","KH"],...}}
+func deckTable(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		baseURL := publicURL(r, cfg)
+		actor, err := parseActor(r, r.URL.Query().Get("actor"))
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+			writeError(w, ErrInvalidParameter, deckId)
+			return
+		}
+
+		// Abonnement avant la lecture de l'etat pour ne rien manquer entre les deux
+		events, cancel := store.Subscribe(deckId)
+		defer cancel()
+		state, err := store.DeckState(deckId, false)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		// Accept repond lui-meme en cas d'echec, origine refusee comprise
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: cfg.AllowedOrigins})
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		conn.SetReadLimit(maxBodyBytes)
+
+		// Le contexte de la requete ne doit plus servir une fois la connexion prise
+		ctx, stop := context.WithCancel(context.Background())
+		defer stop()
+		write := func(msg WSMessage) error {
+			ctx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+			defer cancel()
+			return wsjson.Write(ctx, conn, msg)
+		}
+
+		initial := stateResponse(baseURL, state, false)
+		if write(WSMessage{Type: "state", State: &initial}) != nil {
+			return
+		}
+		lastEvent := state.LastEvent
+
+		// Une seule goroutine ecrit les reponses et les evenements: un client qui ne lit
+		// plus bloque la lecture de ses commandes, puis perd son abonnement
+		results := make(chan WSMessage, wsResultBuffer)
+		readDone := make(chan struct{})
+		go func() {
+			defer close(readDone)
+			readCommands(ctx, conn, store, deckId, actor, baseURL, results)
+		}()
+		go keepAlive(ctx, conn, store, deckId)
+
+		for {
+			var err error
+			select {
+			case msg := <-results:
+				err = write(msg)
+			case ev, ok := <-events:
+				if !ok {
+					// Client trop lent ou arret du serveur: il doit relire l'etat
+					_ = conn.Close(websocket.StatusTryAgainLater, "evenements perdus")
+					return
+				}
+				if ev.Id <= lastEvent {
+					continue
+				}
+				lastEvent = ev.Id
+				err = write(WSMessage{Type: "event", Event: &ev})
+				if err == nil && ev.Type == database.EventDeckDeleted {
+					_ = conn.Close(websocket.StatusNormalClosure, "deck supprime")
+					return
+				}
+			case <-readDone:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// keepAlive envoie un ping toutes les wsPingInterval et prolonge le deck observe
+// Un client qui ne repond pas a temps, ou un deck supprime, ferme la connexion
+func keepAlive(ctx context.Context, conn *websocket.Conn, store database.Backend, deckId string) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if store.TouchDeck(deckId) != nil {
+			_ = conn.Close(websocket.StatusGoingAway, "deck introuvable")
+			return
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, wsPingInterval)
+		err := conn.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			_ = conn.Close(websocket.StatusPolicyViolation, "pas de reponse au ping")
+			return
+		}
+	}
+}
+
+// readCommands lit et execute les commandes jusqu'a la fermeture de la connexion
+// Seuls les messages texte en utf-8 valide sont acceptes
+func readCommands(ctx context.Context, conn *websocket.Conn, store database.Backend, deckId, actor, baseURL string, results chan<- WSMessage) {
+	for {
+		typ, payload, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		if typ != websocket.MessageText {
+			_ = conn.Close(websocket.StatusUnsupportedData, "messages texte seulement")
+			return
+		}
+		if !utf8.Valid(payload) {
+			_ = conn.Close(websocket.StatusInvalidFramePayloadData, "texte utf-8 invalide")
+			return
+		}
+		select {
+		case results <- execCommand(store, deckId, actor, baseURL, payload):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// headerHasToken indique si l'en-tete name contient token dans sa liste separee par des virgules
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// execCommand decode et execute une commande au nom de actor, dans une transaction comme une
+// operation de lot
+func execCommand(store database.Backend, deckId, actor, baseURL string, payload []byte) WSMessage {
+	var cmd wsCommand
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cmd); err != nil {
+		return commandError(cmd, ErrInvalidParameter)
+	}
+
+	switch cmd.Op {
+	case "undo":
+		if _, err := store.As(actor).Undo(deckId); err != nil {
+			return commandError(cmd, err)
+		}
+	case "redo":
+		if _, err := store.As(actor).Redo(deckId); err != nil {
+			return commandError(cmd, err)
+		}
+	}
+	if cmd.Op == "state" || cmd.Op == "undo" || cmd.Op == "redo" {
+		state, err := store.DeckState(deckId, false)
+		if err != nil {
+			return commandError(cmd, err)
+		}
+		resp := stateResponse(baseURL, state, false)
+		return WSMessage{Type: "state", Id: cmd.Id, Op: cmd.Op, State: &resp}
+	}
+
+	op, err := cmd.toBatchOp()
+	if err != nil {
+		return commandError(cmd, err)
+	}
+	res, remaining, err := store.BatchAs(deckId, actor, []database.BatchOp{op})
+	if err != nil {
+		var batchErr *database.BatchError
+		if errors.As(err, &batchErr) {
+			err = batchErr.Err
+		}
+		return commandError(cmd, err)
+	}
+	return WSMessage{
+		Type:      "result",
+		Id:        cmd.Id,
+		Op:        cmd.Op,
+		Cards:     cardResponses(baseURL, res[0].Cards),
+		Remaining: &remaining,
+	}
+}
+
+// commandError retourne le message d'erreur d'une commande
+func commandError(cmd wsCommand, err error) WSMessage {
+	return WSMessage{Type: "error", Id: cmd.Id, Op: cmd.Op, Error: publicError(err).Error()}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"deckofcards/database"
+	"deckofcards/models"
+	"deckofcards/utils"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// testWS connexion de test a une table, les echecs arretent le test
+type testWS struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dialTestWS(t *testing.T, srv *httptest.Server, path string) *testWS {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+path, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	return &testWS{t: t, conn: conn}
+}
+
+func (c *testWS) send(msg string) {
+	c.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.conn.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+		c.t.Fatalf("send: %v", err)
+	}
+}
+
+func (c *testWS) receive() WSMessage {
+	c.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var msg WSMessage
+	if err := wsjson.Read(ctx, c.conn, &msg); err != nil {
+		c.t.Fatalf("receive: %v", err)
+	}
+	return msg
+}
+
+func TestDeckTable(t *testing.T) {
+	handler, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	cfg := utils.DefaultConfig()
+	wp := database.Init(handler, cfg)
+	defer handler.Close()
+	defer wp.Close()
+	deckId, err := wp.InsertDeck(models.NewMultiDeck(1, false))
+	if err != nil {
+		t.Fatalf("InsertDeck: %v", err)
+	}
+
+	srv := httptest.NewServer(NewHandler(wp, cfg))
+	defer srv.Close()
+
+	if resp, err := http.Get(srv.URL + "/ws/deck/" + deckId); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("GET without upgrade = %v, %v; want 400", resp, err)
+	}
+
+	player := dialTestWS(t, srv, "/ws/deck/"+deckId)
+	watcher := dialTestWS(t, srv, "/ws/deck/"+deckId)
+	for _, c := range []*testWS{player, watcher} {
+		if msg := c.receive(); msg.Type != "state" || msg.State.Remaining != 52 {
+			t.Fatalf("first message = %+v, want the state of a full deck", msg)
+		}
+	}
+
+	player.send(`{"id":"d1","op":"draw","count":2}`)
+	var result WSMessage
+	for i := 0; i < 2; i++ {
+		if msg := player.receive(); msg.Type == "result" {
+			result = msg
+		}
+	}
+	if string(result.Id) != `"d1"` || len(result.Cards) != 2 || *result.Remaining != 50 {
+		t.Fatalf("result = %+v, want 2 cards for command d1", result)
+	}
+	if msg := watcher.receive(); msg.Type != "event" || msg.Event.Type != database.EventDrawn || len(msg.Event.Cards) != 2 {
+		t.Fatalf("watcher received %+v, want the drawn event", msg)
+	}
+
+	player.send(`{"id":2,"op":"drawPile","pile":"missing"}`)
+	if msg := player.receive(); msg.Type != "error" || msg.Error != ErrPileNotFound.Error() {
+		t.Errorf("drawPile on missing pile = %+v, want %v", msg, ErrPileNotFound)
+	}
+
+	// Une page d'un autre site ne peut pas ouvrir la table au nom de son visiteur
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, resp, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/deck/"+deckId, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Origin": {"http://evil.example"}},
+	})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-origin dial = %v, %v; want 403", resp, err)
+	}
+
+	// Un texte qui n'est pas de l'utf-8 ferme la connexion
+	player.send("{\"op\":\"\xff\"}")
+	if _, _, err := player.conn.Read(ctx); websocket.CloseStatus(err) != websocket.StatusInvalidFramePayloadData {
+		t.Errorf("invalid utf-8 read = %v, want close %d", err, websocket.StatusInvalidFramePayloadData)
+	}
+}
@@ -0,0 +1,654 @@
+package api
+
+import (
+	"deckofcards/database"
+	"deckofcards/models"
+	"deckofcards/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxBodyBytes taille maximale d'un corps de requete json
+const maxBodyBytes = 1 << 20
+
+// v2Request corps json d'une requete de l'api v2, valide avant tout appel au Backend
+type v2Request interface {
+	validate(cfg *utils.Config) error
+}
+
+// v2Routes retourne les endpoints de l'api /api/v2/ ou les mutations sont des POST, PATCH
+// et DELETE avec un corps json. Les lectures reprennent les handlers de l'api /api/deck/
+func v2Routes(store database.Backend, cfg *utils.Config) []route {
+	return []route{
+		{"POST /api/v2/deck/{$}", newDeckV2(store, cfg)},
+		{"GET /api/v2/deck/{deck_id}/{$}", deckState(store, cfg)},
+		{"DELETE /api/v2/deck/{deck_id}/{$}", deleteDeck(store)},
+		{"POST /api/v2/deck/{deck_id}/draw/{$}", drawCardsV2(store, cfg)},
+		{"POST /api/v2/deck/{deck_id}/shuffle/{$}", shuffleDeckV2(store)},
+		{"POST /api/v2/deck/{deck_id}/return/{$}", returnCardsV2(store)},
+		{"POST /api/v2/deck/{deck_id}/deal/{$}", dealV2(store, cfg)},
+		{"POST /api/v2/deck/{deck_id}/batch/{$}", batch(store, cfg)},
+		{"POST /api/v2/deck/{deck_id}/undo/{$}", travelDeck(store, cfg, true)},
+		{"POST /api/v2/deck/{deck_id}/redo/{$}", travelDeck(store, cfg, false)},
+		{"GET /api/v2/deck/{deck_id}/peek/{$}", peekDeck(store, cfg)},
+
+		{"GET /api/v2/deck/{deck_id}/piles/{$}", listPiles(store, cfg)},
+		{"GET /api/v2/deck/{deck_id}/piles/{pile_name}/{$}", listPiles(store, cfg)},
+		{"PATCH /api/v2/deck/{deck_id}/piles/{pile_name}/{$}", addToPileV2(store)},
+		{"DELETE /api/v2/deck/{deck_id}/piles/{pile_name}/{$}", deletePile(store)},
+		{"GET /api/v2/deck/{deck_id}/piles/{pile_name}/peek/{$}", peekPile(store, cfg)},
+		{"POST /api/v2/deck/{deck_id}/piles/{pile_name}/draw/{$}", drawPileV2(store, cfg)},
+		{"POST /api/v2/deck/{deck_id}/piles/{pile_name}/shuffle/{$}", shufflePile(store)},
+		{"POST /api/v2/deck/{deck_id}/piles/{pile_name}/return/{$}", returnCardsV2(store)},
+		{"POST /api/v2/deck/{deck_id}/piles/{pile_name}/move/{$}", moveV2(store, cfg)},
+	}
+}
+
+// decodeBody decode le corps json de r dans dst puis le valide
+// Un corps vide equivaut a un objet vide, les champs inconnus sont refuses
+func decodeBody(w http.ResponseWriter, r *http.Request, cfg *utils.Config, dst v2Request) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("corps json invalide: %w", ErrInvalidParameter)
+	}
+	return dst.validate(cfg)
+}
+
+// validateCodes verifie chaque code de carte, les doublons sont permis
+func validateCodes(codes []string) error {
+	for _, code := range codes {
+		if !models.CodeValid(code) {
+			return fmt.Errorf("%q: %w", code, ErrInvalidCardCode)
+		}
+	}
+	return nil
+}
+
+// validateUniqueCodes verifie chaque code de carte et l'absence de doublons
+func validateUniqueCodes(codes []string) error {
+	if err := validateCodes(codes); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if seen[code] {
+			return fmt.Errorf("%s: %w", code, ErrDuplicateCards)
+		}
+		seen[code] = true
+	}
+	return nil
+}
+
+// validateMethod verifie une methode de tirage, "top" par defaut
+func validateMethod(method *string) error {
+	switch *method {
+	case "":
+		*method = "top"
+	case "top", "bottom", "random":
+	default:
+		return fmt.Errorf("method %q: %w", *method, ErrInvalidMethod)
+	}
+	return nil
+}
+
+// validateCount verifie un nombre de cartes, 1 par defaut
+func validateCount(count *int) error {
+	if *count < 0 {
+		return fmt.Errorf("count %d: %w", *count, ErrInvalidParameter)
+	}
+	if *count == 0 {
+		*count = 1
+	}
+	return nil
+}
+
+// newDeckRequest corps de POST /api/v2/deck/
+type newDeckRequest struct {
+	DeckCount int      `json:"deck_count,omitempty"`     //< nombre de paquets, 1 par defaut
+	Jokers    bool     `json:"jokers_enabled,omitempty"` //< ajoute deux jokers par paquet
+	Cards     []string `json:"cards,omitempty"`          //< deck personnalise, exclusif avec deck_count
+	Shuffle   bool     `json:"shuffle,omitempty"`
+	Seed      *int64   `json:"seed,omitempty"`
+	Draw      int      `json:"draw,omitempty"` //< cartes tirees apres la creation
+}
+
+func (req *newDeckRequest) validate(cfg *utils.Config) error {
+	if req.Draw < 0 {
+		return fmt.Errorf("draw %d: %w", req.Draw, ErrInvalidParameter)
+	}
+	if len(req.Cards) > 0 {
+		if req.DeckCount != 0 || req.Jokers {
+			return fmt.Errorf("cards exclusif avec deck_count et jokers_enabled: %w", ErrInvalidParameter)
+		}
+		if len(req.Cards) > cfg.CustomDeckCardsLimit {
+			return fmt.Errorf("%d cartes: %w", len(req.Cards), ErrParameterOutOfRange)
+		}
+		return validateUniqueCodes(req.Cards)
+	}
+	if req.DeckCount < 0 {
+		return fmt.Errorf("deck_count %d: %w", req.DeckCount, ErrInvalidParameter)
+	}
+	if req.DeckCount == 0 {
+		req.DeckCount = 1
+	}
+	if req.DeckCount > cfg.MaxDecks {
+		return fmt.Errorf("deck_count %d: %w", req.DeckCount, ErrParameterOutOfRange)
+	}
+	return nil
+}
+
+// drawRequest corps des tirages dans la pioche ou dans une pile
+// cards tire des cartes precises, sinon count cartes selon method
+// Un code repete tire autant d'exemplaires, comme pour les remises
+type drawRequest struct {
+	Count  int      `json:"count,omitempty"`
+	Method string   `json:"method,omitempty"` //< top (defaut), bottom ou random
+	Cards  []string `json:"cards,omitempty"`
+}
+
+func (req *drawRequest) validate(*utils.Config) error {
+	if len(req.Cards) > 0 {
+		if req.Count != 0 || req.Method != "" {
+			return fmt.Errorf("cards exclusif avec count et method: %w", ErrInvalidParameter)
+		}
+		return validateCodes(req.Cards)
+	}
+	if err := validateCount(&req.Count); err != nil {
+		return err
+	}
+	return validateMethod(&req.Method)
+}
+
+// shuffleRequest corps de POST /api/v2/deck/{deck_id}/shuffle/
+type shuffleRequest struct {
+	Seed          *int64 `json:"seed,omitempty"`
+	RemainingOnly bool   `json:"remaining_only,omitempty"` //< ne melange pas les piles
+}
+
+func (req *shuffleRequest) validate(*utils.Config) error {
+	return nil
+}
+
+// returnRequest corps des remises dans la pioche, toutes les cartes si cards est vide
+// Les doublons sont permis, un deck de plusieurs paquets contient plusieurs exemplaires
+type returnRequest struct {
+	Cards    []string `json:"cards,omitempty"`
+	Position string   `json:"position,omitempty"` //< top (defaut), bottom, random ou un index
+
+	pos database.Position
+}
+
+func (req *returnRequest) validate(*utils.Config) error {
+	if err := validateCodes(req.Cards); err != nil {
+		return err
+	}
+	pos, err := parsePositionValue(req.Position)
+	if err != nil {
+		return err
+	}
+	req.pos = pos
+	return nil
+}
+
+// addToPileRequest corps de PATCH /api/v2/deck/{deck_id}/piles/{pile_name}/
+type addToPileRequest struct {
+	Cards []string `json:"cards"`
+}
+
+func (req *addToPileRequest) validate(*utils.Config) error {
+	if len(req.Cards) == 0 {
+		return fmt.Errorf("cards requis: %w", ErrInvalidParameter)
+	}
+	return validateUniqueCodes(req.Cards)
+}
+
+// moveRequest corps de POST /api/v2/deck/{deck_id}/piles/{pile_name}/move/
+// cards deplace des cartes precises, sinon count cartes du dessus ou du dessous
+type moveRequest struct {
+	To    string   `json:"to"`
+	Cards []string `json:"cards,omitempty"`
+	Count int      `json:"count,omitempty"`
+	From  string   `json:"from,omitempty"` //< top (defaut) ou bottom
+}
+
+func (req *moveRequest) validate(*utils.Config) error {
+	if req.To == "" {
+		return fmt.Errorf("to requis: %w", ErrInvalidParameter)
+	}
+	if req.From != "" && req.From != "top" && req.From != "bottom" {
+		return fmt.Errorf("from %q: %w", req.From, ErrInvalidParameter)
+	}
+	if err := validateCount(&req.Count); err != nil {
+		return err
+	}
+	return validateCodes(req.Cards)
+}
+
+// dealRequest corps de POST /api/v2/deck/{deck_id}/deal/
+type dealRequest struct {
+	Piles []string `json:"piles"`
+	Count int      `json:"count,omitempty"`
+	Mode  string   `json:"mode,omitempty"` //< roundrobin (defaut) ou block
+}
+
+func (req *dealRequest) validate(*utils.Config) error {
+	if len(req.Piles) == 0 {
+		return fmt.Errorf("piles requis: %w", ErrInvalidParameter)
+	}
+	seen := make(map[string]bool, len(req.Piles))
+	for _, name := range req.Piles {
+		if name == "" || seen[name] {
+			return fmt.Errorf("pile %q: %w", name, ErrInvalidParameter)
+		}
+		seen[name] = true
+	}
+	if req.Mode == "" {
+		req.Mode = "roundrobin"
+	}
+	if req.Mode != "roundrobin" && req.Mode != "block" {
+		return fmt.Errorf("mode %q: %w", req.Mode, ErrInvalidMethod)
+	}
+	return validateCount(&req.Count)
+}
+
+// / Cree un deck standard ou personnalise, melange et pige au besoin
+func newDeckV2(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+
+		var req newDeckRequest
+		if err := decodeBody(w, r, cfg, &req); err != nil {
+			writeError(w, err, "")
+			return
+		}
+
+		var deck *models.Deck
+		if len(req.Cards) > 0 {
+			var err error
+			if deck, err = models.NewCustomDeck(req.Cards); err != nil {
+				writeError(w, ErrInvalidCardCode, "")
+				return
+			}
+		} else {
+			deck = models.NewMultiDeck(req.DeckCount, req.Jokers)
+		}
+		deck.Seed = req.Seed
+		if req.Shuffle {
+			deck.Shuffle()
+		}
+
+		// La creation et le tirage sont une seule transaction: pas de deck orphelin si le tirage echoue
+		var deckId string
+		var cards []string
+		remaining := len(deck.Cards)
+		if req.Draw > 0 {
+			deckId, cards, remaining, err = store.InsertDeckAndDraw(deck, req.Draw)
+		} else {
+			deckId, err = store.InsertDeck(deck)
+		}
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+
+		resp := Response{
+			Success:   true,
+			DeckId:    deckId,
+			Shuffled:  &req.Shuffle,
+			Seed:      req.Seed,
+			Remaining: remaining,
+		}
+		if req.Draw > 0 {
+			resp.Cards = cardResponses(publicURL(r, cfg), cards)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// / Pige des cartes de la pioche
+func drawCardsV2(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var req drawRequest
+		if err := decodeBody(w, r, cfg, &req); err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var cards []string
+		var remaining int
+		if len(req.Cards) > 0 {
+			cards, remaining, err = store.DrawSpecificFromDeck(deckId, req.Cards)
+		} else {
+			cards, remaining, err = store.DrawCardsFrom(deckId, req.Method, req.Count)
+		}
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		if len(cards) == 0 {
+			writeError(w, ErrDeckEmpty, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success:   true,
+			DeckId:    deckId,
+			Cards:     cardResponses(publicURL(r, cfg), cards),
+			Remaining: remaining,
+		})
+	}
+}
+
+// / Melange la pioche, et les piles sauf si remaining_only
+func shuffleDeckV2(store database.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var req shuffleRequest
+		if err := decodeBody(w, r, nil, &req); err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		// La pioche et les piles sont melangees ensemble, un seul undo annule le tout
+		var deck *models.Deck
+		var piles map[string]int
+		switch {
+		case !req.RemainingOnly:
+			deck, piles, err = store.ShuffleDeckAndPiles(deckId, req.Seed)
+		case req.Seed != nil:
+			deck, err = store.ShuffleDeckSeeded(deckId, *req.Seed)
+		default:
+			deck, err = store.ShuffleDeck(deckId)
+		}
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		shuffled := true
+		resp := Response{
+			Success:   true,
+			DeckId:    deckId,
+			Shuffled:  &shuffled,
+			Seed:      deck.Seed,
+			Remaining: len(deck.Cards),
+		}
+		if len(piles) > 0 {
+			resp.Piles = make(map[string]PileResponse, len(piles))
+			for name, count := range piles {
+				resp.Piles[name] = PileResponse{Remaining: count}
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// / Remet des cartes tirees ou d'une pile dans la pioche
+func returnCardsV2(store database.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		pileName := r.PathValue("pile_name")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var req returnRequest
+		if err := decodeBody(w, r, nil, &req); err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		switch {
+		case pileName != "" && len(req.Cards) > 0:
+			err = store.ReturnSpecificFromPileMany(deckId, pileName, req.Cards, req.pos)
+		case pileName != "":
+			err = store.ReturnAllFromPile(deckId, pileName, req.pos)
+		case len(req.Cards) > 0:
+			err = store.ReturnSpecificDrawnMany(deckId, req.Cards, req.pos)
+		default:
+			err = store.ReturnAllDrawn(deckId, req.pos)
+		}
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		deckRemaining, err := store.CardsInDeck(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		resp := Response{
+			Success:   true,
+			DeckId:    deckId,
+			Remaining: int(deckRemaining),
+		}
+		if pileName != "" {
+			pileRemaining, err := store.CardsInPile(deckId, pileName)
+			if err != nil {
+				writeError(w, err, deckId)
+				return
+			}
+			resp.Piles = map[string]PileResponse{pileName: {Remaining: int(pileRemaining)}}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// / Ajoute des cartes tirees sur le dessus d'une pile, la pile est creee au besoin
+func addToPileV2(store database.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		pileName := r.PathValue("pile_name")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var req addToPileRequest
+		if err := decodeBody(w, r, nil, &req); err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		inserted, err := store.InsertIntoPile(pileName, deckId, req.Cards)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success:   true,
+			DeckId:    inserted.Id,
+			Remaining: inserted.Remaining,
+			Piles: map[string]PileResponse{
+				pileName: {Remaining: inserted.Piles[pileName].Remaining},
+			},
+		})
+	}
+}
+
+// / Pige des cartes d'une pile
+func drawPileV2(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		pileName := r.PathValue("pile_name")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var req drawRequest
+		if err := decodeBody(w, r, cfg, &req); err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		drawn := req.Cards
+		if len(req.Cards) > 0 {
+			err = store.DrawSpecificFromPileMany(deckId, pileName, req.Cards)
+		} else {
+			drawn, err = store.DrawFromPileN(deckId, pileName, req.Method, req.Count)
+		}
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		pileRemaining, err := store.CardsInPile(deckId, pileName)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		deckRemaining, err := store.CardsInDeck(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success:   true,
+			DeckId:    deckId,
+			Remaining: int(deckRemaining),
+			Piles: map[string]PileResponse{
+				pileName: {Remaining: int(pileRemaining)},
+			},
+			Cards: cardResponses(publicURL(r, cfg), drawn),
+		})
+	}
+}
+
+// / Deplace des cartes d'une pile vers la pile to
+func moveV2(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		fromPile := r.PathValue("pile_name")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var req moveRequest
+		if err := decodeBody(w, r, cfg, &req); err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		moved, err := store.MovePileCards(deckId, fromPile, req.To, req.Cards, req.Count, req.From == "bottom")
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		piles, err := store.ListPiles(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		deckRemaining, err := store.CardsInDeck(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{
+			Success:   true,
+			DeckId:    deckId,
+			Remaining: int(deckRemaining),
+			Piles: map[string]PileResponse{
+				fromPile: {Remaining: piles[fromPile]},
+				req.To:   {Remaining: piles[req.To]},
+			},
+			Cards: cardResponses(publicURL(r, cfg), moved),
+		})
+	}
+}
+
+// / Distribue count cartes de la pioche a chacune des piles
+func dealV2(store database.Backend, cfg *utils.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deckId := r.PathValue("deck_id")
+		store, err := storeAs(r, store)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		var req dealRequest
+		if err := decodeBody(w, r, cfg, &req); err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		dealt, remaining, err := store.Deal(deckId, req.Piles, req.Count, req.Mode)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+		totals, err := store.ListPiles(deckId)
+		if err != nil {
+			writeError(w, err, deckId)
+			return
+		}
+
+		baseURL := publicURL(r, cfg)
+		resp := Response{
+			Success:   true,
+			DeckId:    deckId,
+			Remaining: remaining,
+			Piles:     make(map[string]PileResponse, len(dealt)),
+		}
+		for name, codes := range dealt {
+			resp.Piles[name] = PileResponse{
+				Cards:     cardResponses(baseURL, codes),
+				Remaining: totals[name],
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
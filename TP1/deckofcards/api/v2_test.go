@@ -0,0 +1,53 @@
+package api
+
+import (
+	"deckofcards/utils"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestV2RequestValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		req  v2Request
+		want error
+	}{
+		{"empty body uses defaults", ``, &drawRequest{}, nil},
+		{"unknown field", `{"count":1,"from":"top"}`, &drawRequest{}, ErrInvalidParameter},
+		{"malformed json", `{"count":`, &drawRequest{}, ErrInvalidParameter},
+		{"negative count", `{"count":-2}`, &drawRequest{}, ErrInvalidParameter},
+		{"unknown method", `{"method":"middle"}`, &drawRequest{}, ErrInvalidMethod},
+		{"cards with count", `{"cards":["AS"],"count":2}`, &drawRequest{}, ErrInvalidParameter},
+		{"invalid code", `{"cards":["ZZ"]}`, &drawRequest{}, ErrInvalidCardCode},
+		{"duplicate draw allowed", `{"cards":["AS","AS"]}`, &drawRequest{}, nil},
+		{"duplicate add", `{"cards":["AS","AS"]}`, &addToPileRequest{}, ErrDuplicateCards},
+		{"duplicate return allowed", `{"cards":["AS","AS"],"position":"bottom"}`, &returnRequest{}, nil},
+		{"bad position", `{"position":"middle"}`, &returnRequest{}, ErrInvalidParameter},
+		{"add without cards", `{}`, &addToPileRequest{}, ErrInvalidParameter},
+		{"move without target", `{"count":2}`, &moveRequest{}, ErrInvalidParameter},
+		{"deal duplicate pile", `{"piles":["a","a"]}`, &dealRequest{}, ErrInvalidParameter},
+		{"deal bad mode", `{"piles":["a"],"mode":"spiral"}`, &dealRequest{}, ErrInvalidMethod},
+		{"too many decks", `{"deck_count":16}`, &newDeckRequest{}, ErrParameterOutOfRange},
+		{"cards with deck_count", `{"cards":["AS"],"deck_count":2}`, &newDeckRequest{}, ErrInvalidParameter},
+		{"custom deck", `{"cards":["AS","KH"],"shuffle":true,"seed":42}`, &newDeckRequest{}, nil},
+	}
+	cfg := utils.DefaultConfig()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/v2/deck/", strings.NewReader(tt.body))
+			err := decodeBody(httptest.NewRecorder(), r, cfg, tt.req)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("decodeBody(%s) = %v, want %v", tt.body, err, tt.want)
+			}
+		})
+	}
+
+	var req drawRequest
+	_ = decodeBody(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(``)), cfg, &req)
+	if req.Count != 1 || req.Method != "top" {
+		t.Errorf("defaults = %+v, want count 1 and method top", req)
+	}
+}
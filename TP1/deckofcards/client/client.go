@@ -0,0 +1,216 @@
+// Package client est un client go de l'api de decks de cartes.
+//
+// Il utilise les routes json /api/v2/ et retourne les reponses de l'api
+// (api.Response). Les erreurs retournees par le serveur sont des *Error qui
+// enveloppent les erreurs api.Err*, errors.Is(err, api.ErrDeckNotFound) fonctionne.
+package client
+
+import (
+	"bytes"
+	"context"
+	"deckofcards/api"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client client de l'api, sur pour plusieurs goroutines
+type Client struct {
+	BaseURL    string        //< url du serveur, ex. http://localhost:8080
+	HTTPClient *http.Client  //< http.DefaultClient si nil
+	MaxRetries int           //< nombre de nouvelles tentatives apres un echec temporaire
+	RetryDelay time.Duration //< delai avant la premiere nouvelle tentative, double a chaque essai
+}
+
+// New retourne un client du serveur baseURL avec 2 nouvelles tentatives par defaut
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		MaxRetries: 2,
+		RetryDelay: 100 * time.Millisecond,
+	}
+}
+
+// Error erreur retournee par le serveur
+type Error struct {
+	StatusCode int
+	DeckId     string
+	Message    string //< message de ErrorResponse.Error
+	Operation  *int   //< index de l'operation en echec d'un lot
+	err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("deck api: %d %s", e.StatusCode, e.Message)
+}
+
+// Unwrap retourne l'erreur api.Err* correspondant au message, nil si inconnue
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// NewDeckOptions options de creation d'un deck, un deck standard de 52 cartes par defaut
+type NewDeckOptions struct {
+	DeckCount int      `json:"deck_count,omitempty"`     //< nombre de paquets
+	Jokers    bool     `json:"jokers_enabled,omitempty"` //< ajoute deux jokers par paquet
+	Cards     []string `json:"cards,omitempty"`          //< deck personnalise
+	Shuffle   bool     `json:"shuffle,omitempty"`
+	Seed      *int64   `json:"seed,omitempty"`
+	Draw      int      `json:"draw,omitempty"` //< cartes tirees apres la creation
+}
+
+// NewDeck cree un deck
+func (c *Client) NewDeck(ctx context.Context, opts NewDeckOptions) (*api.Response, error) {
+	var resp api.Response
+	return &resp, c.do(ctx, http.MethodPost, "/api/v2/deck/", opts, &resp)
+}
+
+// Draw pige count cartes du dessus de la pioche
+func (c *Client) Draw(ctx context.Context, deckId string, count int) (*api.Response, error) {
+	var resp api.Response
+	body := map[string]int{"count": count}
+	return &resp, c.do(ctx, http.MethodPost, deckPath(deckId, "draw"), body, &resp)
+}
+
+// Shuffle melange la pioche et les piles d'un deck
+func (c *Client) Shuffle(ctx context.Context, deckId string) (*api.Response, error) {
+	var resp api.Response
+	return &resp, c.do(ctx, http.MethodPost, deckPath(deckId, "shuffle"), nil, &resp)
+}
+
+// AddToPile ajoute des cartes tirees sur le dessus d'une pile, creee au besoin
+func (c *Client) AddToPile(ctx context.Context, deckId, pile string, codes ...string) (*api.Response, error) {
+	var resp api.Response
+	body := map[string][]string{"cards": codes}
+	return &resp, c.do(ctx, http.MethodPatch, pilePath(deckId, pile), body, &resp)
+}
+
+// DrawFromPile pige count cartes du dessus d'une pile
+func (c *Client) DrawFromPile(ctx context.Context, deckId, pile string, count int) (*api.Response, error) {
+	var resp api.Response
+	body := map[string]int{"count": count}
+	return &resp, c.do(ctx, http.MethodPost, pilePath(deckId, pile, "draw"), body, &resp)
+}
+
+// ListPiles retourne le nombre de cartes de chaque pile d'un deck
+func (c *Client) ListPiles(ctx context.Context, deckId string) (*api.Response, error) {
+	var resp api.Response
+	return &resp, c.do(ctx, http.MethodGet, deckPath(deckId, "piles"), nil, &resp)
+}
+
+// GetPile retourne le nombre de cartes de chaque pile d'un deck et les cartes de la pile pile
+func (c *Client) GetPile(ctx context.Context, deckId, pile string) (*api.Response, error) {
+	var resp api.Response
+	return &resp, c.do(ctx, http.MethodGet, pilePath(deckId, pile), nil, &resp)
+}
+
+// Return remet des cartes sur le dessus de la pioche: celles de la pile pile, ou les cartes
+// tirees si pile est vide. Toutes les cartes sont remises si codes est vide
+func (c *Client) Return(ctx context.Context, deckId, pile string, codes ...string) (*api.Response, error) {
+	path := deckPath(deckId, "return")
+	if pile != "" {
+		path = pilePath(deckId, pile, "return")
+	}
+	var resp api.Response
+	body := map[string][]string{"cards": codes}
+	return &resp, c.do(ctx, http.MethodPost, path, body, &resp)
+}
+
+// deckPath retourne /api/v2/deck/{deckId}/{elems...}/
+func deckPath(deckId string, elems ...string) string {
+	path := "/api/v2/deck/" + url.PathEscape(deckId) + "/"
+	for _, e := range elems {
+		path += url.PathEscape(e) + "/"
+	}
+	return path
+}
+
+// pilePath retourne /api/v2/deck/{deckId}/piles/{pile}/{elems...}/
+func pilePath(deckId, pile string, elems ...string) string {
+	return deckPath(deckId, append([]string{"piles", pile}, elems...)...)
+}
+
+// do envoie une requete json et decode la reponse dans out
+// Une reponse 503 est toujours retentee. Une erreur de transport l'est pour un GET,
+// ou si la connexion n'a pas pu etre etablie, afin de ne jamais rejouer une mutation
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, httpClient, method, path, payload, out)
+		if err == nil || attempt >= c.MaxRetries || !retryable(method, err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.RetryDelay << attempt):
+		}
+	}
+}
+
+// send envoie une seule requete
+func (c *Client) send(ctx context.Context, httpClient *http.Client, method, path string, payload []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		apiErr := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		var errResp api.ErrorResponse
+		if data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20)); json.Unmarshal(data, &errResp) == nil && errResp.Error != "" {
+			apiErr.Message = errResp.Error
+			apiErr.DeckId = errResp.DeckId
+			apiErr.Operation = errResp.Operation
+			apiErr.err = api.ErrorFromMessage(errResp.Error)
+		}
+		return apiErr
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("deck api: reponse invalide: %w", err)
+	}
+	return nil
+}
+
+// retryable indique si une requete en echec peut etre renvoyee sans risque
+func retryable(method string, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusServiceUnavailable
+	}
+	if method == http.MethodGet {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"deckofcards/api"
+	"deckofcards/database"
+	"deckofcards/utils"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestServer demarre les vrais handlers de l'api sur une base temporaire
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	handler, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	cfg := utils.DefaultConfig()
+	wp := database.Init(handler, cfg)
+	t.Cleanup(func() {
+		wp.Close()
+		_ = handler.Close()
+	})
+	return api.NewHandler(wp, cfg)
+}
+
+func TestClient_Game(t *testing.T) {
+	srv := httptest.NewServer(newTestServer(t))
+	defer srv.Close()
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	seed := int64(42)
+	deck, err := c.NewDeck(ctx, NewDeckOptions{Shuffle: true, Seed: &seed})
+	if err != nil {
+		t.Fatalf("NewDeck: %v", err)
+	}
+	if deck.Remaining != 52 || deck.Seed == nil || *deck.Seed != seed {
+		t.Fatalf("NewDeck = %+v, want 52 cards and seed %d", deck, seed)
+	}
+
+	drawn, err := c.Draw(ctx, deck.DeckId, 5)
+	if err != nil {
+		t.Fatalf("Draw: %v", err)
+	}
+	if len(drawn.Cards) != 5 || drawn.Remaining != 47 {
+		t.Fatalf("Draw = %d cards, %d remaining", len(drawn.Cards), drawn.Remaining)
+	}
+
+	if _, err := c.AddToPile(ctx, deck.DeckId, "hand", drawn.Cards[0].Code, drawn.Cards[1].Code); err != nil {
+		t.Fatalf("AddToPile: %v", err)
+	}
+	piles, err := c.ListPiles(ctx, deck.DeckId)
+	if err != nil {
+		t.Fatalf("ListPiles: %v", err)
+	}
+	if piles.Piles["hand"].Remaining != 2 {
+		t.Errorf("hand has %d cards, want 2", piles.Piles["hand"].Remaining)
+	}
+
+	fromPile, err := c.DrawFromPile(ctx, deck.DeckId, "hand", 1)
+	if err != nil {
+		t.Fatalf("DrawFromPile: %v", err)
+	}
+	if len(fromPile.Cards) != 1 || fromPile.Cards[0].Code != drawn.Cards[1].Code {
+		t.Errorf("DrawFromPile = %+v, want the top card %s", fromPile.Cards, drawn.Cards[1].Code)
+	}
+
+	if _, err := c.Return(ctx, deck.DeckId, "hand"); err != nil {
+		t.Fatalf("Return pile: %v", err)
+	}
+	returned, err := c.Return(ctx, deck.DeckId, "")
+	if err != nil {
+		t.Fatalf("Return drawn: %v", err)
+	}
+	if returned.Remaining != 52 {
+		t.Errorf("remaining after returns = %d, want 52", returned.Remaining)
+	}
+	if _, err := c.Shuffle(ctx, deck.DeckId); err != nil {
+		t.Fatalf("Shuffle: %v", err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	srv := httptest.NewServer(newTestServer(t))
+	defer srv.Close()
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	_, err := c.Draw(ctx, "doesnotexist", 1)
+	if !errors.Is(err, api.ErrDeckNotFound) {
+		t.Errorf("Draw on unknown deck err = %v, want ErrDeckNotFound", err)
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("err = %#v, want *Error with status 404", err)
+	}
+
+	deck, err := c.NewDeck(ctx, NewDeckOptions{})
+	if err != nil {
+		t.Fatalf("NewDeck: %v", err)
+	}
+	if _, err := c.DrawFromPile(ctx, deck.DeckId, "missing", 1); !errors.Is(err, api.ErrPileNotFound) {
+		t.Errorf("DrawFromPile on missing pile err = %v, want ErrPileNotFound", err)
+	}
+	if _, err := c.AddToPile(ctx, deck.DeckId, "hand", "XX"); !errors.Is(err, api.ErrInvalidCardCode) {
+		t.Errorf("AddToPile with bad code err = %v, want ErrInvalidCardCode", err)
+	}
+	if _, err := c.Return(ctx, deck.DeckId, "", "AS"); !errors.Is(err, api.ErrCardNotDrawn) {
+		t.Errorf("Return of a card in the deck err = %v, want ErrCardNotDrawn", err)
+	}
+}
+
+func TestClient_RetriesUnavailable(t *testing.T) {
+	backend := newTestServer(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Les deux premiers appels echouent comme lorsque le pool de workers est plein
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"success":false,"error":"request timeout"}`))
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	c.RetryDelay = 0
+	if _, err := c.NewDeck(context.Background(), NewDeckOptions{}); err != nil {
+		t.Fatalf("NewDeck after retries: %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3", calls.Load())
+	}
+
+	calls.Store(0)
+	c.MaxRetries = 1
+	if _, err := c.NewDeck(context.Background(), NewDeckOptions{}); !errors.Is(err, api.ErrRequestTimeout) {
+		t.Errorf("err = %v, want ErrRequestTimeout once retries are exhausted", err)
+	}
+}
+
+func TestClient_ContextCanceled(t *testing.T) {
+	srv := httptest.NewServer(newTestServer(t))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New(srv.URL).NewDeck(ctx, NewDeckOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Actions du journal d'un deck
+const (
+	ActionCreate     = "create"      //< creation, Cards donne la pioche
+	ActionDraw       = "draw"        //< Cards retirees de la pioche aux Positions successives
+	ActionShuffle    = "shuffle"     //< pioche, ou pile Pile, reordonnee selon Permutation
+	ActionPileInsert = "pile_insert" //< Cards posees une a une sur la pile Pile, aux Positions si donnees, sinon sur le dessus
+	ActionPileDraw   = "pile_draw"   //< Cards retirees de la pile Pile aux Positions successives
+	ActionPileDelete = "pile_delete" //< pile Pile supprimee, ses Cards deviennent tirees
+	ActionReturn     = "return"      //< Cards retirees de la pile Pile aux index From, ou des cartes tirees, puis inserees dans la pioche aux Positions
+	ActionRestore    = "restore"     //< etat remplace par Cards et Piles (restauration d'un snapshot)
+)
+
+// Action entree du journal ActionLog, assez precise pour rejouer la partie
+// Les positions sont des index dans la chaine au moment de chaque carte, 0 = dessus
+type Action struct {
+	Id          int64               `json:"id"`
+	Action      string              `json:"action"`
+	Pile        string              `json:"pile,omitempty"`
+	Actor       string              `json:"actor,omitempty"`
+	Cards       []string            `json:"cards,omitempty"`
+	Positions   []int               `json:"positions,omitempty"`
+	From        []int               `json:"from,omitempty"`
+	Permutation []int               `json:"permutation,omitempty"` //< la carte i apres le melange etait a Permutation[i]
+	Piles       map[string][]string `json:"piles,omitempty"`
+	At          time.Time           `json:"at"`
+}
+
+// actionDetail partie json d'une Action, colonne ActionLog.detail
+type actionDetail struct {
+	Cards       []string            `json:"cards,omitempty"`
+	Positions   []int               `json:"positions,omitempty"`
+	From        []int               `json:"from,omitempty"`
+	Permutation []int               `json:"permutation,omitempty"`
+	Piles       map[string][]string `json:"piles,omitempty"`
+}
+
+// GameState pioche et piles d'un deck reconstruites depuis le journal
+type GameState struct {
+	DeckId string
+	Action int64               //< derniere action appliquee
+	Cards  []string            //< pioche du dessus vers le dessous
+	Piles  map[string][]string //< cartes de chaque pile du dessus vers le dessous
+}
+
+// logAction ajoute une action au journal dans la transaction q, avec l'acteur de la transaction
+func (w *WorkerPool) logAction(q querier, deckId string, a Action) error {
+	// Les poses sur une pile sont gardees meme vides: elles peuvent creer la pile
+	switch a.Action {
+	case ActionDraw, ActionPileDraw, ActionReturn:
+		if len(a.Cards) == 0 {
+			return nil
+		}
+	}
+	detail, err := json.Marshal(actionDetail{
+		Cards: a.Cards, Positions: a.Positions, From: a.From, Permutation: a.Permutation, Piles: a.Piles,
+	})
+	if err != nil {
+		return err
+	}
+	res, err := q.Exec(`INSERT INTO ActionLog (deckId, action, pile, actor, detail, createdAt) VALUES (?, ?, ?, ?, ?, ?)`,
+		deckId, a.Action, a.Pile, w.actor, string(detail), w.now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("echec d'ecriture du journal: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("echec de lecture de LastInsertId: %w", err)
+	}
+	return w.recordChange(q, deckId, id)
+}
+
+// chainPermutation retourne la permutation qui mene de before a after, par id de carte
+func chainPermutation(before, after []chainCard) []int {
+	index := make(map[int64]int, len(before))
+	for i, card := range before {
+		index[card.id] = i
+	}
+	perm := make([]int, len(after))
+	for i, card := range after {
+		perm[i] = index[card.id]
+	}
+	return perm
+}
+
+// ActionLog retourne les actions d'un deck d'id superieur a afterId, au plus limit
+func (w *WorkerPool) ActionLog(deckId string, afterId int64, limit int) ([]Action, error) {
+	resp := w.read(func(q querier) (interface{}, error) {
+		if err := w.checkDeck(q, deckId); err != nil {
+			return nil, err
+		}
+		return readActions(q, deckId, `id > ? ORDER BY id LIMIT ?`, afterId, limit)
+	})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.Data.([]Action), nil
+}
+
+// readActions lit les actions d'un deck qui verifient la condition where
+func readActions(q querier, deckId, where string, args ...interface{}) ([]Action, error) {
+	rows, err := q.Query(`SELECT id, action, pile, actor, detail, createdAt FROM ActionLog WHERE deckId = ? AND `+where,
+		append([]interface{}{deckId}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("echec de lecture du journal: %w", err)
+	}
+	defer rows.Close()
+
+	actions := []Action{}
+	for rows.Next() {
+		var a Action
+		var detail string
+		var at int64
+		if err := rows.Scan(&a.Id, &a.Action, &a.Pile, &a.Actor, &detail, &at); err != nil {
+			return nil, fmt.Errorf("echec de lecture du journal: %w", err)
+		}
+		var d actionDetail
+		if err := json.Unmarshal([]byte(detail), &d); err != nil {
+			return nil, fmt.Errorf("action %d illisible: %w", a.Id, err)
+		}
+		a.Cards, a.Positions, a.From, a.Permutation, a.Piles = d.Cards, d.Positions, d.From, d.Permutation, d.Piles
+		a.At = time.UnixMilli(at).UTC()
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
+
+// Replay Rejoue le journal d'un deck jusqu'a l'action untilId incluse (toutes si 0) et
+// retourne la pioche et les piles a ce moment
+func (w *WorkerPool) Replay(deckId string, untilId int64) (*GameState, error) {
+	resp := w.read(func(q querier) (interface{}, error) {
+		if err := w.checkDeck(q, deckId); err != nil {
+			return nil, err
+		}
+		if untilId <= 0 {
+			untilId = 1<<63 - 1
+		}
+		actions, err := readActions(q, deckId, `id <= ? ORDER BY id`, untilId)
+		if err != nil {
+			return nil, err
+		}
+		return replay(deckId, actions)
+	})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.Data.(*GameState), nil
+}
+
+// replay applique des actions, la premiere doit etre la creation du deck
+func replay(deckId string, actions []Action) (*GameState, error) {
+	if len(actions) == 0 || actions[0].Action != ActionCreate {
+		return nil, fmt.Errorf("deck %s: %w", deckId, ErrLogIncomplete)
+	}
+	state := &GameState{DeckId: deckId, Piles: map[string][]string{}}
+	for _, a := range actions {
+		if err := state.apply(a); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// apply applique une action a la pioche et aux piles en verifiant le code de chaque
+// position. Partage par replay et par MemoryStore, qui modifie ses decks action par action
+func (s *GameState) apply(a Action) error {
+	// take retire la carte i de chain apres avoir verifie son code
+	take := func(chain []string, i int, code string) ([]string, error) {
+		if i < 0 || i >= len(chain) || chain[i] != code {
+			return nil, fmt.Errorf("action %d: carte %s absente de la position %d: %w", a.Id, code, i, ErrLogIncomplete)
+		}
+		return slices.Delete(chain, i, i+1), nil
+	}
+	if !wellFormed(a) {
+		return fmt.Errorf("action %d: positions incompletes: %w", a.Id, ErrLogIncomplete)
+	}
+	var err error
+	switch a.Action {
+	case ActionCreate:
+		s.Cards = slices.Clone(a.Cards)
+
+	case ActionDraw:
+		for k, code := range a.Cards {
+			if s.Cards, err = take(s.Cards, a.Positions[k], code); err != nil {
+				return err
+			}
+		}
+
+	case ActionShuffle:
+		chain := s.Cards
+		if a.Pile != "" {
+			pile, ok := s.Piles[a.Pile]
+			if !ok {
+				return fmt.Errorf("action %d: pile %s absente: %w", a.Id, a.Pile, ErrLogIncomplete)
+			}
+			chain = pile
+		}
+		if len(a.Permutation) != len(chain) {
+			return fmt.Errorf("action %d: permutation de %d cartes pour %d: %w", a.Id, len(a.Permutation), len(chain), ErrLogIncomplete)
+		}
+		shuffled := make([]string, len(chain))
+		for i, j := range a.Permutation {
+			shuffled[i] = chain[j]
+		}
+		if a.Pile != "" {
+			s.Piles[a.Pile] = shuffled
+		} else {
+			s.Cards = shuffled
+		}
+
+	case ActionPileInsert:
+		pile := s.Piles[a.Pile]
+		for k, code := range a.Cards {
+			i := 0
+			if a.Positions != nil {
+				i = a.Positions[k]
+			}
+			if i < 0 || i > len(pile) {
+				return fmt.Errorf("action %d: position %d hors de la pile %s: %w", a.Id, i, a.Pile, ErrLogIncomplete)
+			}
+			pile = slices.Insert(pile, i, code)
+		}
+		s.Piles[a.Pile] = pile
+
+	case ActionPileDraw, ActionPileDelete:
+		pile := s.Piles[a.Pile]
+		for k, code := range a.Cards {
+			if pile, err = take(pile, a.Positions[k], code); err != nil {
+				return err
+			}
+		}
+		s.Piles[a.Pile] = pile
+		if a.Action == ActionPileDelete {
+			if len(pile) > 0 {
+				return fmt.Errorf("action %d: pile %s encore non vide: %w", a.Id, a.Pile, ErrLogIncomplete)
+			}
+			delete(s.Piles, a.Pile)
+		}
+
+	case ActionReturn:
+		if a.Pile != "" {
+			pile := s.Piles[a.Pile]
+			for k, code := range a.Cards {
+				if pile, err = take(pile, a.From[k], code); err != nil {
+					return err
+				}
+			}
+			s.Piles[a.Pile] = pile
+		}
+		for k, code := range a.Cards {
+			if a.Positions[k] < 0 || a.Positions[k] > len(s.Cards) {
+				return fmt.Errorf("action %d: position %d hors de la pioche: %w", a.Id, a.Positions[k], ErrLogIncomplete)
+			}
+			s.Cards = slices.Insert(s.Cards, a.Positions[k], code)
+		}
+
+	case ActionRestore:
+		s.Cards = slices.Clone(a.Cards)
+		s.Piles = make(map[string][]string, len(a.Piles))
+		for name, cards := range a.Piles {
+			s.Piles[name] = slices.Clone(cards)
+		}
+
+	default:
+		return fmt.Errorf("action %d: %q inconnue: %w", a.Id, a.Action, ErrLogIncomplete)
+	}
+	s.Action = a.Id
+	return nil
+}
+
+// wellFormed indique si une action donne une position pour chacune de ses cartes
+func wellFormed(a Action) bool {
+	switch a.Action {
+	case ActionDraw, ActionPileDraw, ActionPileDelete:
+		return len(a.Positions) == len(a.Cards)
+	case ActionPileInsert:
+		return a.Positions == nil || len(a.Positions) == len(a.Cards)
+	case ActionReturn:
+		return len(a.Positions) == len(a.Cards) && (a.Pile == "" || len(a.From) == len(a.Cards))
+	}
+	return true
+}
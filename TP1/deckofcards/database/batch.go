@@ -0,0 +1,134 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// BatchOp operation d'un lot execute par Batch
+type BatchOp struct {
+	Op       string   //< draw, addToPile, drawPile, return ou shuffle
+	Pile     string   //< pile visee, vide pour la pioche (draw, return, shuffle)
+	Cards    []string //< cartes precises; si vide, Count cartes ou toutes pour return
+	Count    int      //< nombre de cartes pour draw et drawPile
+	Method   string   //< top, bottom ou random pour draw et drawPile
+	Position Position //< position des cartes remises par return
+	Seed     *int64   //< nouvelle graine pour shuffle de la pioche
+}
+
+// BatchResult resultat d'une operation d'un lot
+type BatchResult struct {
+	Cards []string //< cartes tirees, posees ou remises
+}
+
+// BatchError erreur de l'operation Index d'un lot: aucune operation du lot n'a ete appliquee
+type BatchError struct {
+	Index int
+	Op    string
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d (%s): %v", e.Index, e.Op, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batchResult resultats d'un lot et nombre de cartes restantes
+type batchResult struct {
+	results   []BatchResult
+	remaining int
+}
+
+// Batch Execute une liste d'operations sur un deck dans un seul Execute et une seule
+// transaction: la premiere operation en echec annule tout le lot et est retournee
+// sous forme de *BatchError. Retourne le resultat de chaque operation et le nombre
+// de cartes restantes dans la pioche
+func (w *WorkerPool) Batch(deckId string, ops []BatchOp) ([]BatchResult, int, error) {
+	return w.BatchAs(deckId, "", ops)
+}
+
+// BatchAs Execute un lot comme Batch en inscrivant actor comme auteur de ses actions
+// dans le journal ActionLog, vide si inconnu
+func (w *WorkerPool) BatchAs(deckId, actor string, ops []BatchOp) ([]BatchResult, int, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		w.actor = actor
+		if err := w.change(tx, deckId, "batch"); err != nil {
+			return nil, err
+		}
+		results := make([]BatchResult, len(ops))
+		for i, op := range ops {
+			res, err := w.batchOp(tx, deckId, op)
+			if err != nil {
+				return nil, &BatchError{Index: i, Op: op.Op, Err: err}
+			}
+			results[i] = res
+		}
+		var remaining int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM DeckCard WHERE deckId = ?`, deckId).Scan(&remaining); err != nil {
+			return nil, fmt.Errorf("echec de lecture du deck: %w", err)
+		}
+		return batchResult{results: results, remaining: remaining}, nil
+	})
+	if resp.Err != nil {
+		return nil, 0, resp.Err
+	}
+	res := resp.Data.(batchResult)
+	return res.results, res.remaining, nil
+}
+
+// batchOp applique une operation d'un lot dans la transaction en cours
+func (w *WorkerPool) batchOp(q querier, deckId string, op BatchOp) (BatchResult, error) {
+	method := op.Method
+	if method == "" {
+		method = "top"
+	}
+
+	switch op.Op {
+	case "draw":
+		if len(op.Cards) > 0 {
+			res, err := w.drawSpecificFromDeckTx(q, deckId, op.Cards)
+			return BatchResult{Cards: res.codes}, err
+		}
+		res, err := w.drawCardsTx(q, deckId, method, op.Count)
+		return BatchResult{Cards: res.codes}, err
+
+	case "addToPile":
+		return BatchResult{Cards: op.Cards}, w.insertIntoPileTx(q, deckId, op.Pile, op.Cards)
+
+	case "drawPile":
+		if len(op.Cards) > 0 {
+			return BatchResult{Cards: op.Cards}, w.drawSpecificFromPileTx(q, deckId, op.Pile, op.Cards)
+		}
+		drawn, err := w.drawFromPileTx(q, deckId, op.Pile, method, op.Count)
+		return BatchResult{Cards: drawn}, err
+
+	case "return":
+		if err := op.Position.check(); err != nil {
+			return BatchResult{}, err
+		}
+		if len(op.Cards) > 0 {
+			if op.Pile == "" {
+				return BatchResult{Cards: op.Cards}, w.returnSpecificDrawnTx(q, deckId, op.Cards, op.Position)
+			}
+			return BatchResult{Cards: op.Cards}, w.returnSpecificFromPileTx(q, deckId, op.Pile, op.Cards, op.Position)
+		}
+		if op.Pile == "" {
+			return BatchResult{}, w.returnAllDrawnTx(q, deckId, op.Position)
+		}
+		return BatchResult{}, w.returnAllFromPileTx(q, deckId, op.Pile, op.Position)
+
+	case "shuffle":
+		if op.Pile == "" {
+			_, err := w.shuffleDeckTx(q, deckId, op.Seed)
+			return BatchResult{}, err
+		}
+		_, err := w.shufflePileByNameTx(q, deckId, op.Pile)
+		return BatchResult{}, err
+
+	default:
+		return BatchResult{}, fmt.Errorf("operation %q: %w", op.Op, ErrInvalidMethod)
+	}
+}
@@ -0,0 +1,281 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+)
+
+// chainCard carte d'une liste chainee DeckCard ou PileCard
+type chainCard struct {
+	id   int64
+	code string
+}
+
+// chainNode noeud lu depuis la base avant le parcours de la liste
+type chainNode struct {
+	code string
+	next sql.NullInt64
+}
+
+// walkChain parcourt les noeuds depuis top en suivant next
+// Toutes les cartes doivent etre atteintes, sinon la liste est corrompue
+func walkChain(nodes map[int64]chainNode, top int64) ([]chainCard, error) {
+	cards := make([]chainCard, 0, len(nodes))
+	visited := make(map[int64]bool, len(nodes))
+	for id, ok := top, true; ok; {
+		if visited[id] {
+			return nil, fmt.Errorf("reference circulaire a la carte %d", id)
+		}
+		visited[id] = true
+		node, exists := nodes[id]
+		if !exists {
+			return nil, fmt.Errorf("liste brisee: carte %d introuvable", id)
+		}
+		cards = append(cards, chainCard{id: id, code: node.code})
+		id, ok = node.next.Int64, node.next.Valid
+	}
+	if len(cards) != len(nodes) {
+		return nil, fmt.Errorf("liste brisee: %d cartes atteintes sur %d", len(cards), len(nodes))
+	}
+	return cards, nil
+}
+
+// readChainNodes lit les noeuds retournes par une requete (id, code, next)
+func readChainNodes(q querier, query string, args ...interface{}) (map[int64]chainNode, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := make(map[int64]chainNode)
+	for rows.Next() {
+		var id int64
+		var node chainNode
+		if err := rows.Scan(&id, &node.code, &node.next); err != nil {
+			return nil, fmt.Errorf("echec de lecture de resultat de requete: %w", err)
+		}
+		nodes[id] = node
+	}
+	return nodes, rows.Err()
+}
+
+// deckChain retourne les cartes restantes d'un deck, du dessus vers le dessous
+func deckChain(q querier, deckId string) ([]chainCard, error) {
+	var top sql.NullInt64
+	if err := q.QueryRow(`SELECT topCardId FROM Deck WHERE deckId = ?`, deckId).Scan(&top); err != nil {
+		return nil, fmt.Errorf("echec de lecture du deck: %w", err)
+	}
+	nodes, err := readChainNodes(q, `SELECT id, code, nextId FROM DeckCard WHERE deckId = ?`, deckId)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return []chainCard{}, nil
+	}
+	if !top.Valid {
+		return nil, fmt.Errorf("deck %s sans carte du dessus", deckId)
+	}
+	return walkChain(nodes, top.Int64)
+}
+
+// pileChain retourne les cartes d'une pile, du dessus vers le dessous
+// La carte du dessus est la seule qui n'est referencee par aucun nextCardId
+func pileChain(q querier, pileId int64) ([]chainCard, error) {
+	nodes, err := readChainNodes(q, `SELECT id, code, nextCardId FROM PileCard WHERE pileId = ?`, pileId)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return []chainCard{}, nil
+	}
+	referenced := make(map[int64]bool, len(nodes))
+	for _, node := range nodes {
+		if node.next.Valid {
+			referenced[node.next.Int64] = true
+		}
+	}
+	for id := range nodes {
+		if !referenced[id] {
+			return walkChain(nodes, id)
+		}
+	}
+	return nil, fmt.Errorf("pile %d sans carte du dessus (reference circulaire?)", pileId)
+}
+
+// relinkDeck reecrit les nextId et le topCardId d'un deck selon l'ordre de cards
+func relinkDeck(q querier, deckId string, cards []chainCard) error {
+	for i, card := range cards {
+		var next interface{}
+		if i+1 < len(cards) {
+			next = cards[i+1].id
+		}
+		if _, err := q.Exec(`UPDATE DeckCard SET nextId = ? WHERE id = ?`, next, card.id); err != nil {
+			return fmt.Errorf("echec de mise a jour de nextId: %w", err)
+		}
+	}
+	var top interface{}
+	if len(cards) > 0 {
+		top = cards[0].id
+	}
+	if _, err := q.Exec(`UPDATE Deck SET topCardId = ? WHERE deckId = ?`, top, deckId); err != nil {
+		return fmt.Errorf("echec de mise a jour du topCardId: %w", err)
+	}
+	return nil
+}
+
+// relinkPile reecrit les nextCardId d'une pile selon l'ordre de cards
+func relinkPile(q querier, cards []chainCard) error {
+	for i, card := range cards {
+		var next interface{}
+		if i+1 < len(cards) {
+			next = cards[i+1].id
+		}
+		if _, err := q.Exec(`UPDATE PileCard SET nextCardId = ? WHERE id = ?`, next, card.id); err != nil {
+			return fmt.Errorf("echec de mise a jour de nextCardId: %w", err)
+		}
+	}
+	return nil
+}
+
+// unlinkDeckCard tire la carte i de la pioche: ses voisines sont raccordees, la carte
+// est supprimee et DeckEntry.inDeck est decremente. Retourne la pioche sans la carte
+func unlinkDeckCard(q querier, deckId string, cards []chainCard, i int) ([]chainCard, error) {
+	var next interface{}
+	if i+1 < len(cards) {
+		next = cards[i+1].id
+	}
+	if i == 0 {
+		if _, err := q.Exec(`UPDATE Deck SET topCardId = ? WHERE deckId = ?`, next, deckId); err != nil {
+			return nil, fmt.Errorf("echec de mise a jour du topCardId: %w", err)
+		}
+	} else {
+		if _, err := q.Exec(`UPDATE DeckCard SET nextId = ? WHERE id = ?`, next, cards[i-1].id); err != nil {
+			return nil, fmt.Errorf("echec de mise a jour de nextId: %w", err)
+		}
+	}
+	if _, err := q.Exec(`DELETE FROM DeckCard WHERE id = ?`, cards[i].id); err != nil {
+		return nil, fmt.Errorf("echec de suppression de carte: %w", err)
+	}
+	if _, err := q.Exec(`UPDATE DeckEntry SET inDeck = inDeck - 1 WHERE deckId = ? AND code = ?`, deckId, cards[i].code); err != nil {
+		return nil, fmt.Errorf("echec de mise a jour de DeckEntry: %w", err)
+	}
+	return slices.Delete(cards, i, i+1), nil
+}
+
+// spliceDeckCard remet une carte dans la pioche a l'index i (0 = dessus, len(cards) = dessous)
+// et incremente DeckEntry.inDeck. Retourne la pioche avec la carte
+func spliceDeckCard(q querier, deckId string, cards []chainCard, i int, code string) ([]chainCard, error) {
+	var next interface{}
+	if i < len(cards) {
+		next = cards[i].id
+	}
+	res, err := q.Exec(`INSERT INTO DeckCard (deckId, code, nextId) VALUES (?, ?, ?)`, deckId, code, next)
+	if err != nil {
+		return nil, fmt.Errorf("echec d'insertion de carte: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("echec de lecture de LastInsertId: %w", err)
+	}
+	if i == 0 {
+		if _, err := q.Exec(`UPDATE Deck SET topCardId = ? WHERE deckId = ?`, id, deckId); err != nil {
+			return nil, fmt.Errorf("echec de mise a jour du topCardId: %w", err)
+		}
+	} else {
+		if _, err := q.Exec(`UPDATE DeckCard SET nextId = ? WHERE id = ?`, id, cards[i-1].id); err != nil {
+			return nil, fmt.Errorf("echec de mise a jour de nextId: %w", err)
+		}
+	}
+	if _, err := q.Exec(`UPDATE DeckEntry SET inDeck = inDeck + 1 WHERE deckId = ? AND code = ?`, deckId, code); err != nil {
+		return nil, fmt.Errorf("echec de mise a jour de DeckEntry: %w", err)
+	}
+	return slices.Insert(cards, i, chainCard{id: id, code: code}), nil
+}
+
+// detachPileCard retire la carte i de la chaine d'une pile en raccordant ses voisines,
+// sans supprimer la ligne PileCard. Retourne la pile sans la carte
+func detachPileCard(q querier, cards []chainCard, i int) ([]chainCard, error) {
+	if i > 0 {
+		var next interface{}
+		if i+1 < len(cards) {
+			next = cards[i+1].id
+		}
+		if _, err := q.Exec(`UPDATE PileCard SET nextCardId = ? WHERE id = ?`, next, cards[i-1].id); err != nil {
+			return nil, fmt.Errorf("echec de mise a jour de nextCardId: %w", err)
+		}
+	}
+	return slices.Delete(cards, i, i+1), nil
+}
+
+// unlinkPileCard retire la carte i d'une pile et supprime sa ligne PileCard
+// DeckEntry n'est pas modifie, c'est a l'appelant de savoir ou va la carte
+func unlinkPileCard(q querier, cards []chainCard, i int) ([]chainCard, error) {
+	id := cards[i].id
+	cards, err := detachPileCard(q, cards, i)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := q.Exec(`DELETE FROM PileCard WHERE id = ?`, id); err != nil {
+		return nil, fmt.Errorf("echec de suppression de carte de pile: %w", err)
+	}
+	return cards, nil
+}
+
+// pushPileCard place une carte detachee sur le dessus d'une pile
+func pushPileCard(q querier, pileId int64, cards []chainCard, card chainCard) ([]chainCard, error) {
+	var next interface{}
+	if len(cards) > 0 {
+		next = cards[0].id
+	}
+	if _, err := q.Exec(`UPDATE PileCard SET pileId = ?, nextCardId = ? WHERE id = ?`, pileId, next, card.id); err != nil {
+		return nil, fmt.Errorf("echec de deplacement de carte de pile: %w", err)
+	}
+	return slices.Insert(cards, 0, card), nil
+}
+
+// insertPileCard pose une nouvelle carte sur le dessus d'une pile et incremente DeckEntry.inPile
+func insertPileCard(q querier, deckId string, pileId int64, cards []chainCard, code string) ([]chainCard, error) {
+	return splicePileCard(q, deckId, pileId, cards, 0, code)
+}
+
+// splicePileCard insere une nouvelle carte dans une pile a l'index i (0 = dessus) et
+// incremente DeckEntry.inPile. Retourne la pile avec la carte
+func splicePileCard(q querier, deckId string, pileId int64, cards []chainCard, i int, code string) ([]chainCard, error) {
+	var next interface{}
+	if i < len(cards) {
+		next = cards[i].id
+	}
+	res, err := q.Exec(`INSERT INTO PileCard (pileId, code, nextCardId) VALUES (?, ?, ?)`, pileId, code, next)
+	if err != nil {
+		return nil, fmt.Errorf("echec d'insertion de carte de pile: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("echec de lecture de LastInsertId: %w", err)
+	}
+	if i > 0 {
+		if _, err := q.Exec(`UPDATE PileCard SET nextCardId = ? WHERE id = ?`, id, cards[i-1].id); err != nil {
+			return nil, fmt.Errorf("echec de mise a jour de nextCardId: %w", err)
+		}
+	}
+	if _, err := q.Exec(`UPDATE DeckEntry SET inPile = inPile + 1 WHERE deckId = ? AND code = ?`, deckId, code); err != nil {
+		return nil, fmt.Errorf("echec de mise a jour de DeckEntry: %w", err)
+	}
+	return slices.Insert(cards, i, chainCard{id: id, code: code}), nil
+}
+
+// chainIndex retourne la position de la premiere carte de code donne, -1 si absente
+func chainIndex(cards []chainCard, code string) int {
+	return slices.IndexFunc(cards, func(c chainCard) bool { return c.code == code })
+}
+
+// chainCodes retourne les codes des cartes dans l'ordre
+func chainCodes(cards []chainCard) []string {
+	codes := make([]string, len(cards))
+	for i, card := range cards {
+		codes[i] = card.code
+	}
+	return codes
+}
@@ -1,8 +1,8 @@
 package database
 
 import (
-	"database/sql"
 	"deckofcards/models"
+	"deckofcards/utils"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,92 +10,16 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
-// Helper: Setup test database for concurrency tests
+// Helper: Setup test database for concurrency tests, with the schema of NewDB
 func setupConcurrencyTestDB(t *testing.T) (*DBHandler, *WorkerPool, string) {
-	tmpDir := t.TempDir()
-	dbPath := filepath.Join(tmpDir, "test_concurrent.db")
-
-	dsn := fmt.Sprintf("%s?_foreign_keys=on&_busy_timeout=5000", dbPath)
-	db, err := sql.Open("sqlite3", dsn)
+	dbPath := filepath.Join(t.TempDir(), "test_concurrent.db")
+	handler, err := NewDB(dbPath)
 	if err != nil {
 		t.Fatalf("Failed to open database: %v", err)
 	}
-
-	if err := db.Ping(); err != nil {
-		db.Close()
-		t.Fatalf("Failed to ping database: %v", err)
-	}
-
-	if _, err := db.Exec(`PRAGMA journal_mode=WAL;`); err != nil {
-		db.Close()
-		t.Fatalf("Failed to set WAL mode: %v", err)
-	}
-
-	schema := `
-PRAGMA foreign_keys = ON;
-
-CREATE TABLE IF NOT EXISTS Deck (
-  deckId   TEXT PRIMARY KEY,
-  topCardId INTEGER,
-  shuffled INTEGER DEFAULT 0,
-  FOREIGN KEY (topCardId) REFERENCES DeckCard(id) ON DELETE SET NULL
-);
-
-CREATE TABLE IF NOT EXISTS DeckCard (
-  id       INTEGER PRIMARY KEY AUTOINCREMENT,
-  deckId   TEXT NOT NULL,
-  code     TEXT NOT NULL,
-  nextId   INTEGER,
-  FOREIGN KEY (deckId) REFERENCES Deck(deckId) ON DELETE CASCADE,
-  FOREIGN KEY (nextId) REFERENCES DeckCard(id) ON DELETE SET NULL
-);
-
-CREATE TABLE IF NOT EXISTS Pile (
-  id     INTEGER PRIMARY KEY AUTOINCREMENT,
-  deckId TEXT NOT NULL,
-  name   TEXT NOT NULL,
-  topCardId INTEGER,
-  FOREIGN KEY (deckId) REFERENCES Deck(deckId) ON DELETE CASCADE,
-  FOREIGN KEY (topCardId) REFERENCES DeckCard(id) ON DELETE SET NULL,
-  UNIQUE(deckId, name)
-);
-
-CREATE TABLE IF NOT EXISTS PileCard (
-  id           INTEGER PRIMARY KEY AUTOINCREMENT,
-  pileId       INTEGER NOT NULL,
-  code         TEXT NOT NULL,
-  nextCardId   INTEGER,
-  FOREIGN KEY (pileId)   REFERENCES Pile(id)      ON DELETE CASCADE,
-  FOREIGN KEY (nextCardId) REFERENCES PileCard(id) ON DELETE SET NULL
-);
-
-CREATE TABLE IF NOT EXISTS DeckEntry (
-  id      INTEGER PRIMARY KEY AUTOINCREMENT,
-  deckId  TEXT NOT NULL,
-  code    TEXT NOT NULL,
-  total   INTEGER NOT NULL,
-  inDeck  INTEGER NOT NULL,
-  inPile  INTEGER NOT NULL DEFAULT 0,
-  FOREIGN KEY (deckId) REFERENCES Deck(deckId) ON DELETE CASCADE,
-  UNIQUE(deckId, code)
-);
-`
-
-	if _, err := db.Exec(schema); err != nil {
-		db.Close()
-		t.Fatalf("Failed to apply schema: %v", err)
-	}
-
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
-
-	handler := NewDBHandler(db)
-	workerPool := Init(handler)
+	workerPool := Init(handler, utils.DefaultConfig())
 
 	return handler, workerPool, dbPath
 }
@@ -17,6 +17,11 @@ CREATE TABLE IF NOT EXISTS Deck (
   deckId   TEXT PRIMARY KEY,
   topCardId INTEGER,
   shuffled INTEGER DEFAULT 0,
+  seed     INTEGER,                           -- graine des melanges, NULL = imprevisible
+  shuffleCount INTEGER NOT NULL DEFAULT 0,    -- nombre de melanges faits avec la graine
+  nPackets INTEGER NOT NULL DEFAULT 0,        -- nombre de paquets a la creation, 0 = deck personnalise
+  createdAt INTEGER NOT NULL DEFAULT 0,       -- secondes unix
+  lastAccessedAt INTEGER NOT NULL DEFAULT 0,  -- secondes unix, sert a l'expiration
   FOREIGN KEY (topCardId) REFERENCES DeckCard(id) ON DELETE SET NULL
 );
 
@@ -59,6 +64,40 @@ CREATE TABLE IF NOT EXISTS DeckEntry (
   FOREIGN KEY (deckId) REFERENCES Deck(deckId) ON DELETE CASCADE,
   UNIQUE(deckId, code)
 );
+CREATE TABLE IF NOT EXISTS DeckEvent (
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,   -- sequence de reprise des flux (Last-Event-ID)
+  deckId    TEXT NOT NULL,
+  type      TEXT NOT NULL,
+  pile      TEXT NOT NULL DEFAULT '',
+  cards     TEXT NOT NULL DEFAULT '',            -- codes separes par des virgules
+  createdAt INTEGER NOT NULL,                    -- millisecondes unix
+  FOREIGN KEY (deckId) REFERENCES Deck(deckId) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS DeckEventByDeck ON DeckEvent(deckId, id);
+CREATE TABLE IF NOT EXISTS DeckHistory (
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  deckId    TEXT NOT NULL,
+  op        TEXT NOT NULL,                       -- operation annulable
+  undo      TEXT NOT NULL,                       -- json des melanges et des piles avant l'operation
+  redo      TEXT,                                -- json des melanges et des piles apres l'operation, garde a l'annulation
+  firstAction INTEGER,                           -- premiere et derniere actions ActionLog de l'operation, NULL si aucune
+  lastAction  INTEGER,
+  undone    INTEGER NOT NULL DEFAULT 0,
+  createdAt INTEGER NOT NULL,                    -- secondes unix
+  FOREIGN KEY (deckId) REFERENCES Deck(deckId) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS DeckHistoryByDeck ON DeckHistory(deckId, id);
+CREATE TABLE IF NOT EXISTS ActionLog (
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,   -- ordre des actions, jamais modifiees
+  deckId    TEXT NOT NULL,
+  action    TEXT NOT NULL,
+  pile      TEXT NOT NULL DEFAULT '',
+  actor     TEXT NOT NULL DEFAULT '',
+  detail    TEXT NOT NULL,                       -- json: cartes, positions, permutation
+  createdAt INTEGER NOT NULL,                    -- millisecondes unix
+  FOREIGN KEY (deckId) REFERENCES Deck(deckId) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS ActionLogByDeck ON ActionLog(deckId, id);
 
 `
 
@@ -82,6 +121,10 @@ func NewDB(filepath string) (*DBHandler, error) {
 		_ = db.Close()
 		return nil, fmt.Errorf("application du schéma: %w", err)
 	}
+	if err := migrate(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("migration du schéma: %w", err)
+	}
 
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(5)
@@ -89,3 +132,74 @@ func NewDB(filepath string) (*DBHandler, error) {
 
 	return NewDBHandler(db), nil
 }
+
+// migrations colonnes ajoutees apres la creation initiale du schema, par table
+var migrations = []struct {
+	table, column, definition string
+}{
+	{"Deck", "createdAt", "INTEGER NOT NULL DEFAULT 0"},
+	{"Deck", "lastAccessedAt", "INTEGER NOT NULL DEFAULT 0"},
+	{"Deck", "seed", "INTEGER"},
+	{"Deck", "shuffleCount", "INTEGER NOT NULL DEFAULT 0"},
+	{"Deck", "nPackets", "INTEGER NOT NULL DEFAULT 0"},
+	{"DeckHistory", "firstAction", "INTEGER"},
+	{"DeckHistory", "lastAction", "INTEGER"},
+}
+
+// migrate ajoute les colonnes manquantes aux bases creees avec un ancien schema
+func migrate(db *sql.DB) error {
+	for _, m := range migrations {
+		exists, err := columnExists(db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, m.table, m.column, m.definition)); err != nil {
+			return fmt.Errorf("ajout de %s.%s: %w", m.table, m.column, err)
+		}
+		// L'ancien historique gardait des copies completes des decks, il n'est plus lisible
+		if m.table == "DeckHistory" && m.column == "firstAction" {
+			if _, err := db.Exec(`DELETE FROM DeckHistory`); err != nil {
+				return fmt.Errorf("purge de l'historique: %w", err)
+			}
+		}
+	}
+
+	// Les decks anterieurs a l'expiration sont consideres comme crees maintenant
+	now := time.Now().Unix()
+	if _, err := db.Exec(`UPDATE Deck SET createdAt = ?, lastAccessedAt = ? WHERE createdAt = 0`, now, now); err != nil {
+		return fmt.Errorf("initialisation des dates des decks: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_deck_lastAccessedAt ON Deck(lastAccessedAt)`); err != nil {
+		return fmt.Errorf("creation de l'index lastAccessedAt: %w", err)
+	}
+	return nil
+}
+
+// columnExists indique si une colonne existe dans une table
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, fmt.Errorf("lecture du schema de %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, fmt.Errorf("lecture du schema de %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
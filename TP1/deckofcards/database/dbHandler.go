@@ -38,3 +38,8 @@ func (h *DBHandler) UnLock() {
 func (h *DBHandler) RUnLock() {
 	h.mu.RUnlock()
 }
+
+// / Close ferme la connexion a la base de donnees
+func (h *DBHandler) Close() error {
+	return h.db.Close()
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// dealResult cartes distribuees par pile et nombre de cartes restantes
+type dealResult struct {
+	piles     map[string][]string
+	remaining int
+}
+
+// Deal Distribue count cartes du dessus de la pioche a chacune des piles, creees au besoin,
+// en une seule transaction. En mode "roundrobin" les piles recoivent une carte a tour
+// de role, en mode "block" chaque pile recoit ses count cartes d'un coup
+// Retourne les cartes recues par chaque pile dans l'ordre de distribution et le nombre
+// de cartes restantes. Rien n'est distribue si la pioche ne suffit pas
+func (w *WorkerPool) Deal(deckId string, piles []string, count int, mode string) (map[string][]string, int, error) {
+	if mode != "roundrobin" && mode != "block" {
+		return nil, 0, fmt.Errorf("%q: %w", mode, ErrInvalidMethod)
+	}
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "deal"); err != nil {
+			return nil, err
+		}
+		deck, err := deckChain(tx, deckId)
+		if err != nil {
+			return nil, err
+		}
+		if len(deck) < count*len(piles) {
+			return nil, fmt.Errorf("%d cartes pour %d piles de %d: %w", len(deck), len(piles), count, ErrNotEnoughCards)
+		}
+
+		ids := make([]int64, len(piles))
+		chains := make([][]chainCard, len(piles))
+		for i, name := range piles {
+			if ids[i], err = ensurePile(tx, deckId, name); err != nil {
+				return nil, err
+			}
+			if chains[i], err = pileChain(tx, ids[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		dealt := make(map[string][]string, len(piles))
+		var order []string
+		deal := func(i int) error {
+			code := deck[0].code
+			if deck, err = unlinkDeckCard(tx, deckId, deck, 0); err != nil {
+				return err
+			}
+			if chains[i], err = insertPileCard(tx, deckId, ids[i], chains[i], code); err != nil {
+				return err
+			}
+			dealt[piles[i]] = append(dealt[piles[i]], code)
+			order = append(order, code)
+			return nil
+		}
+
+		if mode == "roundrobin" {
+			for round := 0; round < count; round++ {
+				for i := range piles {
+					if err := deal(i); err != nil {
+						return nil, err
+					}
+				}
+			}
+		} else {
+			for i := range piles {
+				for n := 0; n < count; n++ {
+					if err := deal(i); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		// Toutes les cartes sont prises sur le dessus, l'ordre entre les piles n'importe pas
+		if err := w.logAction(tx, deckId, Action{Action: ActionDraw, Cards: order, Positions: make([]int, len(order))}); err != nil {
+			return nil, err
+		}
+		for _, name := range piles {
+			if err := w.logAction(tx, deckId, Action{Action: ActionPileInsert, Pile: name, Cards: dealt[name]}); err != nil {
+				return nil, err
+			}
+			if err := w.emit(tx, deckId, EventPileAdded, name, dealt[name]); err != nil {
+				return nil, err
+			}
+		}
+		return dealResult{piles: dealt, remaining: len(deck)}, nil
+	})
+	if resp.Err != nil {
+		return nil, 0, resp.Err
+	}
+	res := resp.Data.(dealResult)
+	return res.piles, res.remaining, nil
+}
@@ -6,8 +6,7 @@ import (
 	"deckofcards/models"
 	"errors"
 	"fmt"
-	mathrand "math/rand"
-	"time"
+	"slices"
 )
 
 const base62 = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
@@ -24,178 +23,150 @@ func randomBase62(n int) (string, error) {
 	return string(out), nil
 }
 
-// InsertDeck Insert un deck
-func (w *WorkerPool) InsertDeck(deck *models.Deck) (string, error) {
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
-		var deckToken string
-		for tries := 0; tries < 30; tries++ {
-			id, err := randomBase62(12)
-			if err != nil {
-				return DBResponse{Err: fmt.Errorf("randomBase62: %w", err)}
-			}
-
-			var count int
-
-			row := db.QueryRow(`SELECT COUNT(deckId) FROM Deck WHERE deckId = ?`, id)
-			if err := row.Scan(&count); err != nil {
-				return DBResponse{Err: fmt.Errorf("Echec de lecture de resultat de requete: %w", err)}
-			}
-			if count == 0 {
-				deckToken = id
-				break
-			}
-		}
-		if deckToken == "" {
-			return DBResponse{Err: fmt.Errorf("Impossible de generer un id unique pour le deck")}
-		}
-
-		tx, err := db.Begin()
-		if err != nil {
-			return DBResponse{Err: fmt.Errorf("Echec de demarrage de transaction: %w", err)}
+// pileID retourne l'identifiant d'une pile, ErrPileNotFound si elle n'existe pas
+func pileID(q querier, deckId, pileName string) (int64, error) {
+	var pileId int64
+	if err := q.QueryRow(`SELECT id FROM Pile WHERE deckId = ? AND name = ?`, deckId, pileName).Scan(&pileId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("pile %s: %w", pileName, ErrPileNotFound)
 		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-			}
-		}()
+		return 0, fmt.Errorf("echec de lecture de la pile: %w", err)
+	}
+	return pileId, nil
+}
 
-		cardIDs := make([]int64, len(deck.Cards))
-		cardCounts := make(map[string]int)
+// ensurePile retourne l'id d'une pile, en la creant si elle n'existe pas
+func ensurePile(q querier, deckId, pileName string) (int64, error) {
+	pileId, err := pileID(q, deckId, pileName)
+	if !errors.Is(err, ErrPileNotFound) {
+		return pileId, err
+	}
+	result, err := q.Exec(`INSERT INTO Pile (deckId, name) VALUES (?, ?)`, deckId, pileName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert Pile: %w", err)
+	}
+	pileId, err = result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get inserted ID: %w", err)
+	}
+	return pileId, nil
+}
 
-		if _, err := tx.Exec(`INSERT INTO Deck(deckId, topCardId) VALUES (?, NULL)`, deckToken); err != nil {
-			return DBResponse{Err: fmt.Errorf("échec d'insertion du deck: %w", err)}
-		}
+// InsertDeck Insert un deck
+func (w *WorkerPool) InsertDeck(deck *models.Deck) (string, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		return w.insertDeckTx(tx, deck)
+	})
+	if resp.Err != nil {
+		return "", resp.Err
+	}
+	return resp.Data.(string), nil
+}
 
-		for i, cardCode := range deck.Cards {
-			res, err := tx.Exec(`INSERT INTO DeckCard (deckId, code, nextId) VALUES (?, ?, NULL)`, deckToken, cardCode)
-			if err != nil {
-				return DBResponse{Err: fmt.Errorf("Echec d'insertion de carte: %w", err)}
-			}
-			cardID, err := res.LastInsertId()
-			if err != nil {
-				return DBResponse{Err: fmt.Errorf("Echec de lecture de LastInsertId: %w", err)}
-			}
-			cardIDs[i] = cardID
-			cardCounts[cardCode]++
+// InsertDeckAndDraw Insert un deck et en pige jusqu'a count cartes du dessus dans la meme
+// transaction: un echec du tirage annule aussi la creation
+// Retourne l'id du deck, les codes piges et le nombre de cartes restantes
+func (w *WorkerPool) InsertDeckAndDraw(deck *models.Deck, count int) (string, []string, int, error) {
+	var deckId string
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		var err error
+		if deckId, err = w.insertDeckTx(tx, deck); err != nil {
+			return nil, err
 		}
-
-		for i := 0; i < len(cardIDs)-1; i++ {
-			if _, err := tx.Exec(`UPDATE DeckCard SET nextId = ? WHERE id = ?`, cardIDs[i+1], cardIDs[i]); err != nil {
-				return DBResponse{Err: fmt.Errorf("Echec de mise a jour de nextId: %w", err)}
-			}
+		if err := w.change(tx, deckId, "draw"); err != nil {
+			return nil, err
 		}
+		return w.drawCardsTx(tx, deckId, "top", count)
+	})
+	if resp.Err != nil {
+		return "", nil, 0, resp.Err
+	}
+	res := resp.Data.(drawResult)
+	return deckId, res.codes, res.remaining, nil
+}
 
-		if len(cardIDs) > 0 {
-			if _, err := tx.Exec(`UPDATE Deck SET topCardId = ? WHERE deckId = ?`, cardIDs[0], deckToken); err != nil {
-				return DBResponse{Err: fmt.Errorf("echec de mise a jour du topCardId: %w", err)}
-			}
+// insertDeckTx insere un deck sous un nouvel identifiant, ses cartes dans l'ordre de
+// deck.Cards (la premiere sur le dessus) et son inventaire DeckEntry
+func (w *WorkerPool) insertDeckTx(q querier, deck *models.Deck) (string, error) {
+	var deckToken string
+	for tries := 0; tries < 30; tries++ {
+		id, err := randomBase62(12)
+		if err != nil {
+			return "", fmt.Errorf("randomBase62: %w", err)
 		}
 
-		for code, count := range cardCounts {
-			if _, err := tx.Exec(`INSERT INTO DeckEntry (deckId, code, total, inDeck) VALUES (?, ?, ?, ?) ON CONFLICT(deckId, code) DO UPDATE SET total = excluded.total, inDeck = excluded.inDeck`,
-				deckToken, code, count, count); err != nil {
-				return DBResponse{Err: fmt.Errorf("echec d'insertion de DeckEntry: %w", err)}
-			}
+		var count int
+		row := q.QueryRow(`SELECT COUNT(deckId) FROM Deck WHERE deckId = ?`, id)
+		if err := row.Scan(&count); err != nil {
+			return "", fmt.Errorf("Echec de lecture de resultat de requete: %w", err)
 		}
-
-		if err := tx.Commit(); err != nil {
-			return DBResponse{Err: fmt.Errorf("echec de commit: %w", err)}
+		if count == 0 {
+			deckToken = id
+			break
 		}
+	}
+	if deckToken == "" {
+		return "", fmt.Errorf("Impossible de generer un id unique pour le deck")
+	}
 
-		return DBResponse{Data: deckToken}
-	})
+	cardIDs := make([]int64, len(deck.Cards))
+	cardCounts := make(map[string]int)
 
-	if resp.Err != nil {
-		return "", resp.Err
+	now := w.now().Unix()
+	// Le melange initial d'un deck avec graine correspond au tour 0
+	var shuffleCount int
+	if deck.Seed != nil && deck.Shuffled {
+		shuffleCount = 1
 	}
-	token, ok := resp.Data.(string)
-	if !ok {
-		return "", fmt.Errorf("internal: expected string deck token")
+	if _, err := q.Exec(`INSERT INTO Deck(deckId, topCardId, shuffled, seed, shuffleCount, nPackets, createdAt, lastAccessedAt) VALUES (?, NULL, ?, ?, ?, ?, ?, ?)`,
+		deckToken, deck.Shuffled, deck.Seed, shuffleCount, deck.NPackets, now, now); err != nil {
+		return "", fmt.Errorf("échec d'insertion du deck: %w", err)
 	}
-	return token, nil
-}
-
-// InsertIntoPile Rajoute des cartes dans une pile, si la pile n'existe pas elle est creee
-func (w *WorkerPool) InsertIntoPile(name string, deckId string, codes []string) (models.Deck, error) {
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
 
-		tx, err := db.Begin()
+	for i, cardCode := range deck.Cards {
+		res, err := q.Exec(`INSERT INTO DeckCard (deckId, code, nextId) VALUES (?, ?, NULL)`, deckToken, cardCode)
 		if err != nil {
-			return DBResponse{Err: fmt.Errorf("echec de demarrage de transaction: %w", err)}
+			return "", fmt.Errorf("Echec d'insertion de carte: %w", err)
 		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-			}
-		}()
-
-		for i := 0; i < len(codes); i++ {
-			var total, inDeck, inPile int64
-			row := tx.QueryRow(`SELECT total, inDeck, inPile FROM DeckEntry WHERE deckId = ? AND code = ?`, deckId, codes[i])
-			if err := row.Scan(&total, &inDeck, &inPile); err != nil {
-				if errors.Is(err, sql.ErrNoRows) {
-					return DBResponse{Err: fmt.Errorf("carte non trouvee dans le deck")}
-				}
-				return DBResponse{Err: fmt.Errorf("echec de lecture: %w", err)}
-			}
-
-			if total < inDeck+inPile+1 {
-				return DBResponse{Err: fmt.Errorf("carte non pigée, non présente dans le deck, ou déjà dans les piles")}
-			}
-
-			if _, err := tx.Exec(`UPDATE DeckEntry SET inPile = inPile + 1 WHERE deckId = ? AND code = ?`, deckId, codes[i]); err != nil {
-				return DBResponse{Err: fmt.Errorf("echec de mise a jour de DeckEntry: %w", err)}
-			}
+		cardID, err := res.LastInsertId()
+		if err != nil {
+			return "", fmt.Errorf("Echec de lecture de LastInsertId: %w", err)
 		}
+		cardIDs[i] = cardID
+		cardCounts[cardCode]++
+	}
 
-		var pileId int64
-		row := tx.QueryRow(`SELECT id FROM Pile WHERE deckId = ? AND name = ?`, deckId, name)
-		if err := row.Scan(&pileId); err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				result, err := tx.Exec(`INSERT INTO Pile (deckId, name) VALUES (?, ?)`, deckId, name)
-				if err != nil {
-					return DBResponse{Err: fmt.Errorf("failed to insert Pile: %w", err)}
-				}
-				pileId, err = result.LastInsertId()
-				if err != nil {
-					return DBResponse{Err: fmt.Errorf("failed to get inserted ID: %w", err)}
-				}
-			} else {
-				return DBResponse{Err: fmt.Errorf("echec de lecture: %w", err)}
-			}
+	for i := 0; i < len(cardIDs)-1; i++ {
+		if _, err := q.Exec(`UPDATE DeckCard SET nextId = ? WHERE id = ?`, cardIDs[i+1], cardIDs[i]); err != nil {
+			return "", fmt.Errorf("Echec de mise a jour de nextId: %w", err)
 		}
-		var topCardId *int64
-		row = tx.QueryRow(`SELECT id FROM PileCard WHERE pileId = ? AND id NOT IN (SELECT nextCardId FROM PileCard WHERE nextCardId IS NOT NULL)`, pileId)
-		if err := row.Scan(&topCardId); err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				topCardId = nil
-			} else {
-				return DBResponse{Err: fmt.Errorf("echec lecture carte du dessus de la pile: %w", err)}
-			}
+	}
+
+	if len(cardIDs) > 0 {
+		if _, err := q.Exec(`UPDATE Deck SET topCardId = ? WHERE deckId = ?`, cardIDs[0], deckToken); err != nil {
+			return "", fmt.Errorf("echec de mise a jour du topCardId: %w", err)
 		}
+	}
 
-		for _, code := range codes {
-			result, err := tx.Exec(`INSERT INTO PileCard (pileId, code, nextCardId) VALUES (?, ?, ?)`, pileId, code, topCardId)
-			if err != nil {
-				return DBResponse{Err: fmt.Errorf("echec d'insertion de carte de pile: %w", err)}
-			}
-			lastId, err := result.LastInsertId()
-			if err != nil {
-				return DBResponse{Err: fmt.Errorf("echec d'insertion de carte de pile: %w", err)}
-			}
-			topCardId = &lastId
+	for code, count := range cardCounts {
+		if _, err := q.Exec(`INSERT INTO DeckEntry (deckId, code, total, inDeck) VALUES (?, ?, ?, ?) ON CONFLICT(deckId, code) DO UPDATE SET total = excluded.total, inDeck = excluded.inDeck`,
+			deckToken, code, count, count); err != nil {
+			return "", fmt.Errorf("echec d'insertion de DeckEntry: %w", err)
 		}
+	}
+	if err := w.logAction(q, deckToken, Action{Action: ActionCreate, Cards: deck.Cards}); err != nil {
+		return "", err
+	}
+	return deckToken, nil
+}
 
-		if err := tx.Commit(); err != nil {
-			return DBResponse{Err: fmt.Errorf("echec de commit: %w", err)}
+// InsertIntoPile Rajoute des cartes dans une pile, si la pile n'existe pas elle est creee
+func (w *WorkerPool) InsertIntoPile(name string, deckId string, codes []string) (models.Deck, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "addToPile"); err != nil {
+			return nil, err
 		}
-		return DBResponse{}
+		return nil, w.insertIntoPileTx(tx, deckId, name, codes)
 	})
 	if resp.Err != nil {
 		return models.Deck{}, resp.Err
@@ -224,94 +195,61 @@ func (w *WorkerPool) InsertIntoPile(name string, deckId string, codes []string)
 	}, nil
 }
 
-// GetPileCards Optient les cartes d'une pile
-func (w *WorkerPool) GetPileCards(deckId, pileName string) ([]string, int, error) {
-	resp := w.Execute(func() DBResponse {
-		w.handler.RLock()
-		defer w.handler.RUnLock()
-
-		// First, get the pile ID
-		var pileId int64
-		if err := w.handler.db.QueryRow(`SELECT id FROM Pile WHERE deckId = ? AND name = ?`, deckId, pileName).Scan(&pileId); err != nil {
-			return DBResponse{Err: fmt.Errorf("pile not found: %w", err)}
-		}
-
-		// Get all cards with their next pointers
-		rows, err := w.handler.db.Query(`
-			SELECT id, code, nextCardId 
-			FROM PileCard 
-			WHERE pileId = ?
-		`, pileId)
-		if err != nil {
-			return DBResponse{Err: err}
-		}
-		defer rows.Close()
-
-		// Build a map of cards
-		type cardNode struct {
-			id     int64
-			code   string
-			nextId sql.NullInt64
-		}
-		cards := make(map[int64]cardNode)
-		var topId int64 = -1
-
-		for rows.Next() {
-			var node cardNode
-			if err := rows.Scan(&node.id, &node.code, &node.nextId); err != nil {
-				return DBResponse{Err: err}
+// insertIntoPileTx pose des cartes tirees sur le dessus d'une pile, creee au besoin
+// La derniere carte de codes se retrouve sur le dessus
+func (w *WorkerPool) insertIntoPileTx(q querier, deckId, name string, codes []string) error {
+	pileId, err := ensurePile(q, deckId, name)
+	if err != nil {
+		return err
+	}
+	cards, err := pileChain(q, pileId)
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		var total, inDeck, inPile int64
+		row := q.QueryRow(`SELECT total, inDeck, inPile FROM DeckEntry WHERE deckId = ? AND code = ?`, deckId, code)
+		if err := row.Scan(&total, &inDeck, &inPile); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("carte %s: %w", code, ErrCardNotInDeck)
 			}
-			cards[node.id] = node
+			return fmt.Errorf("echec de lecture: %w", err)
 		}
 
-		if len(cards) == 0 {
-			return DBResponse{Data: []string{}}
+		if total < inDeck+inPile+1 {
+			return fmt.Errorf("carte %s non pigée, non présente dans le deck, ou déjà dans les piles: %w", code, ErrCardNotDrawn)
 		}
 
-		// Find the top card (the one not referenced by any nextCardId)
-		referenced := make(map[int64]bool)
-		for _, card := range cards {
-			if card.nextId.Valid {
-				referenced[card.nextId.Int64] = true
-			}
+		if cards, err = insertPileCard(q, deckId, pileId, cards, code); err != nil {
+			return err
 		}
+	}
+	if err := w.logAction(q, deckId, Action{Action: ActionPileInsert, Pile: name, Cards: codes}); err != nil {
+		return err
+	}
+	return w.emit(q, deckId, EventPileAdded, name, codes)
+}
 
-		for id := range cards {
-			if !referenced[id] {
-				topId = id
-				break
-			}
+// GetPileCards Optient les cartes d'une pile
+func (w *WorkerPool) GetPileCards(deckId, pileName string) ([]string, int, error) {
+	resp := w.Execute(func() DBResponse {
+		w.handler.RLock()
+		defer w.handler.RUnLock()
+		if err := w.checkDeck(w.handler.db, deckId); err != nil {
+			return DBResponse{Err: err}
 		}
 
-		if topId == -1 {
-			return DBResponse{Err: fmt.Errorf("pile has no top card (circular reference?)")}
+		// First, get the pile ID
+		pileId, err := pileID(w.handler.db, deckId, pileName)
+		if err != nil {
+			return DBResponse{Err: err}
 		}
 
-		// Follow the linked list from top to bottom
-		var codes []string
-		currentId := topId
-		visited := make(map[int64]bool)
-
-		for {
-			if visited[currentId] {
-				return DBResponse{Err: fmt.Errorf("circular reference detected in pile")}
-			}
-			visited[currentId] = true
-
-			card, exists := cards[currentId]
-			if !exists {
-				return DBResponse{Err: fmt.Errorf("broken linked list: card %d not found", currentId)}
-			}
-
-			codes = append(codes, card.code)
-
-			if !card.nextId.Valid {
-				// Reached the end
-				break
-			}
-
-			currentId = card.nextId.Int64
+		cards, err := pileChain(w.handler.db, pileId)
+		if err != nil {
+			return DBResponse{Err: err}
 		}
+		codes := chainCodes(cards)
 
 		return DBResponse{Data: codes}
 	})
@@ -329,6 +267,9 @@ func (w *WorkerPool) CardsInDeck(deckId string) (uint64, error) {
 		db := w.handler.db
 		w.handler.RLock()
 		defer w.handler.RUnLock()
+		if err := w.checkDeck(db, deckId); err != nil {
+			return DBResponse{Err: err}
+		}
 		result := db.QueryRow(
 			`SELECT COUNT(*) FROM Deck INNER JOIN DeckCard ON Deck.deckId = DeckCard.deckId WHERE Deck.deckId = ?`, deckId,
 		)
@@ -351,6 +292,9 @@ func (w *WorkerPool) CardsInPile(deckId string, pileName string) (uint64, error)
 		db := w.handler.db
 		w.handler.RLock()
 		defer w.handler.RUnLock()
+		if err := w.checkDeck(db, deckId); err != nil {
+			return DBResponse{Err: err}
+		}
 		result := db.QueryRow(
 			`SELECT COUNT(*) FROM Pile INNER JOIN PileCard ON Pile.id = PileCard.pileId WHERE Pile.deckId = ? AND Pile.name =?`, deckId, pileName,
 		)
@@ -369,32 +313,11 @@ func (w *WorkerPool) CardsInPile(deckId string, pileName string) (uint64, error)
 
 // / ListPiles liste les piles pour un deck
 func (w *WorkerPool) ListPiles(deckId string) (map[string]int, error) {
-	resp := w.Execute(func() DBResponse {
-		w.handler.RLock()
-		defer w.handler.RUnLock()
-
-		rows, err := w.handler.db.Query(`
-			SELECT name, COUNT(PileCard.id) 
-			FROM Pile
-			LEFT JOIN PileCard ON Pile.id = PileCard.pileId
-			WHERE deckId = ?
-			GROUP BY name
-		`, deckId)
-		if err != nil {
-			return DBResponse{Err: err}
+	resp := w.read(func(q querier) (interface{}, error) {
+		if err := w.checkDeck(q, deckId); err != nil {
+			return nil, err
 		}
-		defer rows.Close()
-
-		piles := make(map[string]int)
-		for rows.Next() {
-			var name string
-			var count int
-			if err := rows.Scan(&name, &count); err != nil {
-				return DBResponse{Err: err}
-			}
-			piles[name] = count
-		}
-		return DBResponse{Data: piles}
+		return listPiles(q, deckId)
 	})
 
 	if resp.Err != nil {
@@ -402,859 +325,714 @@ func (w *WorkerPool) ListPiles(deckId string) (map[string]int, error) {
 	}
 	return resp.Data.(map[string]int), nil
 }
-func (w *WorkerPool) ShuffleAllPiles(deckId string) (map[string]int, error) {
-	results := make(map[string]int)
 
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
+// listPiles retourne le nombre de cartes de chaque pile d'un deck
+func listPiles(q querier, deckId string) (map[string]int, error) {
+	rows, err := q.Query(`
+		SELECT name, COUNT(PileCard.id) 
+		FROM Pile
+		LEFT JOIN PileCard ON Pile.id = PileCard.pileId
+		WHERE deckId = ?
+		GROUP BY name
+	`, deckId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		// Start transaction for atomic operations
-		tx, err := db.Begin()
-		if err != nil {
-			return DBResponse{Err: err}
+	piles := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			return nil, err
 		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-			}
-		}()
+		piles[name] = count
+	}
+	return piles, rows.Err()
+}
 
-		rows, err := tx.Query(`SELECT id, name FROM Pile WHERE deckId = ?`, deckId)
-		if err != nil {
-			return DBResponse{Err: err}
+// ShuffleAllPiles Melange toutes les piles d'un deck et retourne le nombre de cartes de chacune
+// Sans pile, rien n'est melange ni inscrit dans l'historique
+func (w *WorkerPool) ShuffleAllPiles(deckId string) (map[string]int, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.checkDeck(tx, deckId); err != nil {
+			return nil, err
 		}
-		defer rows.Close()
-
-		type pileInfo struct {
-			id   int64
-			name string
+		piles, err := listPiles(tx, deckId)
+		if err != nil || len(piles) == 0 {
+			return piles, err
 		}
-		var piles []pileInfo
-
-		for rows.Next() {
-			var pi pileInfo
-			if err := rows.Scan(&pi.id, &pi.name); err != nil {
-				return DBResponse{Err: err}
-			}
-			piles = append(piles, pi)
+		if err := w.change(tx, deckId, "shufflePiles"); err != nil {
+			return nil, err
 		}
-		rows.Close()
-
-		// Process each pile
-		for _, pile := range piles {
-			// Fetch all card IDs for this pile
-			cardRows, err := tx.Query(`SELECT id FROM PileCard WHERE pileId = ? ORDER BY id ASC`, pile.id)
-			if err != nil {
-				return DBResponse{Err: err}
-			}
-
-			var cards []int64
-			for cardRows.Next() {
-				var cardId int64
-				if err := cardRows.Scan(&cardId); err != nil {
-					cardRows.Close()
-					return DBResponse{Err: err}
-				}
-				cards = append(cards, cardId)
-			}
-			cardRows.Close()
-
-			if len(cards) == 0 {
-				results[pile.name] = 0
-				continue
-			}
-
-			// Shuffle in memory
-			mathrand.Seed(time.Now().UnixNano())
-			mathrand.Shuffle(len(cards), func(i, j int) {
-				cards[i], cards[j] = cards[j], cards[i]
-			})
-
-			// Clear current links
-			if _, err := tx.Exec(`UPDATE PileCard SET nextCardId = NULL WHERE pileId = ?`, pile.id); err != nil {
-				return DBResponse{Err: err}
-			}
-
-			// Rebuild linked list with shuffled order
-			for i := 0; i < len(cards)-1; i++ {
-				if _, err := tx.Exec(`UPDATE PileCard SET nextCardId = ? WHERE id = ?`, cards[i+1], cards[i]); err != nil {
-					return DBResponse{Err: err}
-				}
-			}
+		return w.shuffleAllPilesTx(tx, deckId)
+	})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.Data.(map[string]int), nil
+}
 
-			// Update pile's topCardId to point to the first card in shuffled order
-			// Note: The Pile table doesn't have topCardId in your schema, so we skip this
-			// The top card is identified as the one NOT referenced by any nextCardId
+// shuffleAllPilesTx melange toutes les piles d'un deck avec un meme Shuffler
+// Sans pile, le Shuffler d'un deck avec graine n'est pas avance
+func (w *WorkerPool) shuffleAllPilesTx(q querier, deckId string) (map[string]int, error) {
+	rows, err := q.Query(`SELECT id, name FROM Pile WHERE deckId = ? ORDER BY id`, deckId)
+	if err != nil {
+		return nil, err
+	}
+	type pileInfo struct {
+		id   int64
+		name string
+	}
+	var piles []pileInfo
+	for rows.Next() {
+		var pi pileInfo
+		if err := rows.Scan(&pi.id, &pi.name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		piles = append(piles, pi)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-			results[pile.name] = len(cards)
+	results := make(map[string]int, len(piles))
+	if len(piles) == 0 {
+		return results, nil
+	}
+	shuffler, err := w.deckShuffler(q, deckId)
+	if err != nil {
+		return nil, err
+	}
+	for _, pile := range piles {
+		cards, err := w.shufflePileTx(q, deckId, pile.id, pile.name, shuffler)
+		if err != nil {
+			return nil, err
 		}
-
-		if err := tx.Commit(); err != nil {
-			return DBResponse{Err: err}
+		results[pile.name] = len(cards)
+		if err := w.emit(q, deckId, EventShuffled, pile.name, nil); err != nil {
+			return nil, err
 		}
+	}
+	return results, nil
+}
 
-		return DBResponse{Data: results}
+// ShufflePile Melange une pile et retourne ses cartes du dessus vers le dessous
+func (w *WorkerPool) ShufflePile(deckId, pileName string) ([]string, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "shufflePile"); err != nil {
+			return nil, err
+		}
+		return w.shufflePileByNameTx(tx, deckId, pileName)
 	})
-
 	if resp.Err != nil {
 		return nil, resp.Err
 	}
+	return resp.Data.([]string), nil
+}
 
-	if resp.Data != nil {
-		if res, ok := resp.Data.(map[string]int); ok {
-			return res, nil
-		}
+// shufflePileByNameTx melange une pile avec le Shuffler du deck
+func (w *WorkerPool) shufflePileByNameTx(q querier, deckId, pileName string) ([]string, error) {
+	pileId, err := pileID(q, deckId, pileName)
+	if err != nil {
+		return nil, err
+	}
+	shuffler, err := w.deckShuffler(q, deckId)
+	if err != nil {
+		return nil, err
 	}
+	cards, err := w.shufflePileTx(q, deckId, pileId, pileName, shuffler)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.emit(q, deckId, EventShuffled, pileName, nil); err != nil {
+		return nil, err
+	}
+	return chainCodes(cards), nil
+}
 
-	return results, nil
+// shufflePileTx melange les cartes de la pile pileName a partir de leur ordre actuel
+func (w *WorkerPool) shufflePileTx(q querier, deckId string, pileId int64, pileName string, shuffler models.Shuffler) ([]chainCard, error) {
+	cards, err := pileChain(q, pileId)
+	if err != nil {
+		return nil, err
+	}
+	before := slices.Clone(cards)
+	shuffler.Shuffle(len(cards), func(i, j int) {
+		cards[i], cards[j] = cards[j], cards[i]
+	})
+	if err := relinkPile(q, cards); err != nil {
+		return nil, err
+	}
+	perm := chainPermutation(before, cards)
+	if err := w.logAction(q, deckId, Action{Action: ActionShuffle, Pile: pileName, Permutation: perm}); err != nil {
+		return nil, err
+	}
+	return cards, nil
 }
 
-// / UpdatePileOrder shuffle une pile
-func (w *WorkerPool) UpdatePileOrder(deckId, pileName string, codes []string) error {
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
+// ShuffleDeck Melange les cartes restantes d'un deck, avec la graine du deck si elle existe
+func (w *WorkerPool) ShuffleDeck(value string) (*models.Deck, error) {
+	return w.shuffleDeck(value, nil)
+}
 
-		var pileId int64
-		row := db.QueryRow(`SELECT id FROM Pile WHERE deckId = ? AND name = ?`, deckId, pileName)
-		if err := row.Scan(&pileId); err != nil {
-			return DBResponse{Err: err}
-		}
+// ShuffleDeckSeeded Remplace la graine d'un deck puis le melange: les melanges suivants
+// du deck et de ses piles sont reproductibles a partir de seed
+func (w *WorkerPool) ShuffleDeckSeeded(deckId string, seed int64) (*models.Deck, error) {
+	return w.shuffleDeck(deckId, &seed)
+}
 
-		if _, err := db.Exec(`UPDATE PileCard SET nextCardId = NULL WHERE pileId = ?`, pileId); err != nil {
-			return DBResponse{Err: err}
+// ShuffleDeckAndPiles Melange la pioche puis toutes les piles d'un deck dans une seule
+// transaction, annulee d'un seul Undo. seed remplace d'abord la graine du deck s'il est fourni
+// Retourne la pioche melangee et le nombre de cartes de chaque pile
+func (w *WorkerPool) ShuffleDeckAndPiles(deckId string, seed *int64) (*models.Deck, map[string]int, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "shuffle"); err != nil {
+			return nil, err
 		}
-
-		var prevId *int64
-		for _, code := range codes {
-			var cardId int64
-			row := db.QueryRow(`SELECT id FROM PileCard WHERE pileId = ? AND code = ?`, pileId, code)
-			if err := row.Scan(&cardId); err != nil {
-				return DBResponse{Err: err}
-			}
-			if prevId != nil {
-				if _, err := db.Exec(`UPDATE PileCard SET nextCardId = ? WHERE id = ?`, cardId, *prevId); err != nil {
-					return DBResponse{Err: err}
-				}
-			}
-			prevId = &cardId
+		deck, err := w.shuffleDeckTx(tx, deckId, seed)
+		if err != nil {
+			return nil, err
 		}
-
-		return DBResponse{}
+		piles, err := w.shuffleAllPilesTx(tx, deckId)
+		return shuffleResult{deck: deck, piles: piles}, err
 	})
+	if resp.Err != nil {
+		return nil, nil, resp.Err
+	}
+	res := resp.Data.(shuffleResult)
+	return res.deck, res.piles, nil
+}
 
-	return resp.Err
+// shuffleResult pioche et piles melangees par ShuffleDeckAndPiles
+type shuffleResult struct {
+	deck  *models.Deck
+	piles map[string]int
 }
 
-// ShuffleDeck Shuffle un deck
-func (w *WorkerPool) ShuffleDeck(value string) (*models.Deck, error) {
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
-		var count int
-		row := db.QueryRow(`SELECT COUNT(deckId) FROM Deck WHERE deckId = ?`, value)
-		if err := row.Scan(&count); err != nil {
-			return DBResponse{Err: err}
-		}
-		if count == 0 {
-			return DBResponse{Err: fmt.Errorf("deck inexistant")}
+func (w *WorkerPool) shuffleDeck(deckId string, seed *int64) (*models.Deck, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "shuffle"); err != nil {
+			return nil, err
 		}
+		return w.shuffleDeckTx(tx, deckId, seed)
+	})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.Data.(*models.Deck), nil
+}
 
-		rows, err := db.Query(`SELECT id, code FROM DeckCard WHERE deckId = ?`, value)
-		if err != nil {
-			return DBResponse{Err: err}
+// shuffleDeckTx melange la pioche, apres avoir remplace la graine du deck si seed est fourni
+func (w *WorkerPool) shuffleDeckTx(q querier, deckId string, seed *int64) (*models.Deck, error) {
+	if seed != nil {
+		if _, err := q.Exec(`UPDATE Deck SET seed = ?, shuffleCount = 0 WHERE deckId = ?`, *seed, deckId); err != nil {
+			return nil, fmt.Errorf("echec de mise a jour de la graine: %w", err)
 		}
-		defer rows.Close()
+	}
+	shuffler, err := w.deckShuffler(q, deckId)
+	if err != nil {
+		return nil, err
+	}
 
-		type CardInfo struct {
-			ID   int64
-			Code string
-		}
-		var cards []CardInfo
-		for rows.Next() {
-			var c CardInfo
-			if err := rows.Scan(&c.ID, &c.Code); err != nil {
-				return DBResponse{Err: fmt.Errorf("echec de lecture de resultat de requete: %w", err)}
-			}
-			cards = append(cards, c)
-		}
-		if err := rows.Err(); err != nil {
-			return DBResponse{Err: err}
-		}
-
-		if len(cards) == 0 {
-			return DBResponse{Data: &models.Deck{Cards: []string{}}}
-		}
-
-		mathrand.Seed(time.Now().UnixNano())
-		mathrand.Shuffle(len(cards), func(i, j int) {
-			cards[i], cards[j] = cards[j], cards[i]
-		})
-
-		tx, err := db.Begin()
-		if err != nil {
-			return DBResponse{Err: fmt.Errorf("echec de demarrage de transaction: %w", err)}
-		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-			}
-		}()
-
-		for i := 0; i < len(cards)-1; i++ {
-			if _, err := tx.Exec(`UPDATE DeckCard SET nextId = ? WHERE id = ?`, cards[i+1].ID, cards[i].ID); err != nil {
-				return DBResponse{Err: fmt.Errorf("echec de mise a jour de nextId: %w", err)}
-			}
-		}
-		if _, err := tx.Exec(`UPDATE DeckCard SET nextId = NULL WHERE id = ?`, cards[len(cards)-1].ID); err != nil {
-			return DBResponse{Err: fmt.Errorf("echec de mise a jour du dernier nextId: %w", err)}
-		}
-		if _, err := tx.Exec(`UPDATE Deck SET topCardId = ?, shuffled = 1 WHERE deckId = ?`, cards[0].ID, value); err != nil {
-			return DBResponse{Err: fmt.Errorf("echec de mise a jour du deck: %w", err)}
-		}
-
-		if err := tx.Commit(); err != nil {
-			return DBResponse{Err: fmt.Errorf("echec de commit: %w", err)}
-		}
-
-		codes := make([]string, len(cards))
-		for i, card := range cards {
-			codes[i] = card.Code
-		}
-		return DBResponse{Data: &models.Deck{Cards: codes}}
+	cards, err := deckChain(q, deckId)
+	if err != nil {
+		return nil, err
+	}
+	before := slices.Clone(cards)
+	shuffler.Shuffle(len(cards), func(i, j int) {
+		cards[i], cards[j] = cards[j], cards[i]
 	})
-
-	if resp.Err != nil {
-		return nil, resp.Err
+	if err := relinkDeck(q, deckId, cards); err != nil {
+		return nil, err
+	}
+	if err := w.logAction(q, deckId, Action{Action: ActionShuffle, Permutation: chainPermutation(before, cards)}); err != nil {
+		return nil, err
+	}
+	if _, err := q.Exec(`UPDATE Deck SET shuffled = 1 WHERE deckId = ?`, deckId); err != nil {
+		return nil, fmt.Errorf("echec de mise a jour du deck: %w", err)
 	}
-	deck, ok := resp.Data.(*models.Deck)
-	if !ok {
-		return nil, fmt.Errorf("internal: unexpected shuffle result")
+	if err := w.emit(q, deckId, EventShuffled, "", nil); err != nil {
+		return nil, err
+	}
+
+	deck := &models.Deck{Cards: chainCodes(cards), Id: deckId, Shuffled: true}
+	if deck.Seed, err = deckSeed(q, deckId); err != nil {
+		return nil, err
 	}
 	return deck, nil
 }
 
 // / Pige une carte d'une pile
 func (w *WorkerPool) DrawFromPile(deckId, pileName, method string) (string, error) {
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
-
-		var pileId int64
-		if err := db.QueryRow(`SELECT id FROM Pile WHERE deckId=? AND name=?`, deckId, pileName).Scan(&pileId); err != nil {
-			return DBResponse{Err: fmt.Errorf("pile not found: %w", err)}
-		}
-		var cardId int64
-		var cardCode string
-		var nextId sql.NullInt64
-
-		switch method {
-		case "top":
-			row := db.QueryRow(`
-				SELECT id, code, nextCardId FROM PileCard
-				WHERE pileId=? AND id NOT IN (SELECT nextCardId FROM PileCard WHERE nextCardId IS NOT NULL)
-			`, pileId)
-			if err := row.Scan(&cardId, &cardCode, &nextId); err != nil {
-				if err == sql.ErrNoRows {
-					return DBResponse{Err: fmt.Errorf("pile empty")}
-				}
-				return DBResponse{Err: err}
-			}
-		case "bottom":
-			row := db.QueryRow(`SELECT id, code FROM PileCard WHERE pileId=? AND nextCardId IS NULL`, pileId)
-			if err := row.Scan(&cardId, &cardCode); err != nil {
-				if err == sql.ErrNoRows {
-					return DBResponse{Err: fmt.Errorf("pile empty")}
-				}
-				return DBResponse{Err: err}
-			}
-		case "random":
-			rows, err := db.Query(`SELECT id, code, nextCardId FROM PileCard WHERE pileId=?`, pileId)
-			if err != nil {
-				return DBResponse{Err: err}
-			}
-			defer rows.Close()
+	codes, err := w.DrawFromPileN(deckId, pileName, method, 1)
+	if err != nil {
+		return "", err
+	}
+	return codes[0], nil
+}
 
-			var cards []struct {
-				id   int64
-				code string
-				next sql.NullInt64
-			}
-			for rows.Next() {
-				var c struct {
-					id   int64
-					code string
-					next sql.NullInt64
-				}
-				if err := rows.Scan(&c.id, &c.code, &c.next); err != nil {
-					return DBResponse{Err: err}
-				}
-				cards = append(cards, c)
-			}
-			if len(cards) == 0 {
-				return DBResponse{Err: fmt.Errorf("pile empty")}
-			}
-			mathrand.Seed(time.Now().UnixNano())
-			pick := cards[mathrand.Intn(len(cards))]
-			cardId, cardCode, nextId = pick.id, pick.code, pick.next
-		default:
-			return DBResponse{Err: fmt.Errorf("invalid draw method")}
+// DrawFromPileN Pige jusqu'a count cartes du dessus, du dessous ou au hasard d'une pile
+// en une seule transaction. ErrPileEmpty si la pile est vide
+func (w *WorkerPool) DrawFromPileN(deckId, pileName, method string, count int) ([]string, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "drawPile"); err != nil {
+			return nil, err
 		}
+		return w.drawFromPileTx(tx, deckId, pileName, method, count)
+	})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.Data.([]string), nil
+}
 
-		var prevId sql.NullInt64
-		_ = db.QueryRow(`SELECT id FROM PileCard WHERE pileId=? AND nextCardId=?`, pileId, cardId).Scan(&prevId)
+// drawFromPileTx tire jusqu'a count cartes du dessus ("top"), du dessous ("bottom") ou au hasard ("random") d'une pile
+func (w *WorkerPool) drawFromPileTx(q querier, deckId, pileName, method string, count int) ([]string, error) {
+	if method != "top" && method != "bottom" && method != "random" {
+		return nil, fmt.Errorf("%q: %w", method, ErrInvalidMethod)
+	}
+	pileId, err := pileID(q, deckId, pileName)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := pileChain(q, pileId)
+	if err != nil {
+		return nil, err
+	}
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("pile %s: %w", pileName, ErrPileEmpty)
+	}
 
-		tx, err := db.Begin()
+	pick := func() int { return 0 }
+	switch method {
+	case "bottom":
+		pick = func() int { return len(cards) - 1 }
+	case "random":
+		shuffler, err := w.deckShuffler(q, deckId)
 		if err != nil {
-			return DBResponse{Err: err}
-		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-			}
-		}()
-
-		if prevId.Valid {
-			if _, err := tx.Exec(`UPDATE PileCard SET nextCardId=? WHERE id=?`, nextId, prevId.Int64); err != nil {
-				return DBResponse{Err: err}
-			}
-		}
-
-		if _, err := tx.Exec(`DELETE FROM PileCard WHERE id=?`, cardId); err != nil {
-			return DBResponse{Err: err}
-		}
-
-		if _, err := tx.Exec(`UPDATE DeckEntry SET inPile = inPile - 1 WHERE deckId=? AND code=? AND inPile>0`, deckId, cardCode); err != nil {
-			return DBResponse{Err: err}
+			return nil, err
 		}
+		pick = func() int { return shuffler.Intn(len(cards)) }
+	}
 
-		if err := tx.Commit(); err != nil {
-			return DBResponse{Err: err}
+	var drawn []string
+	var positions []int
+	for len(drawn) < count && len(cards) > 0 {
+		i := pick()
+		drawn = append(drawn, cards[i].code)
+		positions = append(positions, i)
+		if cards, err = takePileCard(q, deckId, cards, i); err != nil {
+			return nil, err
 		}
-
-		return DBResponse{Data: cardCode}
-	})
-
-	if resp.Err != nil {
-		return "", resp.Err
 	}
-	code, ok := resp.Data.(string)
-	if !ok {
-		return "", fmt.Errorf("internal: unexpected draw result")
+	if err := w.logAction(q, deckId, Action{Action: ActionPileDraw, Pile: pileName, Cards: drawn, Positions: positions}); err != nil {
+		return nil, err
 	}
-	return code, nil
+	if err := w.emit(q, deckId, EventPileDrawn, pileName, drawn); err != nil {
+		return nil, err
+	}
+	return drawn, nil
 }
 
 // / Pige une carte specifique d'une pile
 func (w *WorkerPool) DrawSpecificFromPile(deckId, pileName, code string) (string, error) {
-	db := w.handler.db
-	w.handler.Lock()
-	defer w.handler.UnLock()
-
-	var pileId int64
-	if err := db.QueryRow(`SELECT id FROM Pile WHERE deckId=? AND name=?`, deckId, pileName).Scan(&pileId); err != nil {
+	if err := w.DrawSpecificFromPileMany(deckId, pileName, []string{code}); err != nil {
 		return "", err
 	}
+	return code, nil
+}
 
-	var cardId int64
-	var nextId sql.NullInt64
-	if err := db.QueryRow(`SELECT id, nextCardId FROM PileCard WHERE pileId=? AND code=?`, pileId, code).Scan(&cardId, &nextId); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", fmt.Errorf("card %s not in pile", code)
+// DrawSpecificFromPileMany Pige les cartes de codes donnes d'une pile en une seule transaction
+// Rien n'est tire si l'une des cartes n'est pas dans la pile
+func (w *WorkerPool) DrawSpecificFromPileMany(deckId, pileName string, codes []string) error {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "drawPile"); err != nil {
+			return nil, err
 		}
-		return "", err
-	}
-
-	var prevId sql.NullInt64
-	_ = db.QueryRow(`SELECT id FROM PileCard WHERE pileId=? AND nextCardId=?`, pileId, cardId).Scan(&prevId)
+		return nil, w.drawSpecificFromPileTx(tx, deckId, pileName, codes)
+	})
+	return resp.Err
+}
 
-	tx, err := db.Begin()
+// drawSpecificFromPileTx tire d'une pile les cartes de codes donnes, les plus proches du dessus
+// Toutes les cartes sont verifiees avant la premiere modification
+func (w *WorkerPool) drawSpecificFromPileTx(q querier, deckId, pileName string, codes []string) error {
+	pileId, err := pileID(q, deckId, pileName)
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback()
+	cards, err := pileChain(q, pileId)
+	if err != nil {
+		return err
+	}
+	if err := checkInPile(chainCodes(cards), pileName, codes); err != nil {
+		return err
+	}
+	positions := make([]int, len(codes))
+	for k, code := range codes {
+		positions[k] = chainIndex(cards, code)
+		if cards, err = takePileCard(q, deckId, cards, positions[k]); err != nil {
+			return err
 		}
-	}()
+	}
+	if err := w.logAction(q, deckId, Action{Action: ActionPileDraw, Pile: pileName, Cards: codes, Positions: positions}); err != nil {
+		return err
+	}
+	return w.emit(q, deckId, EventPileDrawn, pileName, codes)
+}
 
-	if prevId.Valid {
-		if _, err := tx.Exec(`UPDATE PileCard SET nextCardId=? WHERE id=?`, nextId, prevId.Int64); err != nil {
-			return "", err
+// checkInPile verifie que la pile contient au moins autant d'exemplaires de chaque code que demande
+func checkInPile(pile []string, pileName string, codes []string) error {
+	inPile := make(map[string]int, len(pile))
+	for _, code := range pile {
+		inPile[code]++
+	}
+	for _, code := range codes {
+		if inPile[code] == 0 {
+			return fmt.Errorf("card %s in pile %s: %w", code, pileName, ErrCardNotInPile)
 		}
+		inPile[code]--
 	}
+	return nil
+}
 
-	if _, err := tx.Exec(`DELETE FROM PileCard WHERE id=?`, cardId); err != nil {
-		return "", err
+// takePileCard retire la carte i d'une pile, elle devient tiree et placee nulle part
+// Retourne la pile sans la carte
+func takePileCard(q querier, deckId string, cards []chainCard, i int) ([]chainCard, error) {
+	code := cards[i].code
+	cards, err := unlinkPileCard(q, cards, i)
+	if err != nil {
+		return nil, err
 	}
-
-	if _, err := tx.Exec(`UPDATE DeckEntry SET inPile = inPile - 1 WHERE deckId=? AND code=? AND inPile>0`, deckId, code); err != nil {
-		return "", err
+	if _, err := q.Exec(`UPDATE DeckEntry SET inPile = inPile - 1 WHERE deckId=? AND code=? AND inPile>0`, deckId, code); err != nil {
+		return nil, fmt.Errorf("echec de mise a jour de DeckEntry: %w", err)
 	}
+	return cards, nil
+}
 
-	if err := tx.Commit(); err != nil {
+// ReturnSpecificDrawn Remet une carte tiree dans la pioche a la position pos
+func (w *WorkerPool) ReturnSpecificDrawn(deckId, code string, pos Position) (string, error) {
+	if err := w.ReturnSpecificDrawnMany(deckId, []string{code}, pos); err != nil {
 		return "", err
 	}
-
 	return code, nil
 }
 
-func (w *WorkerPool) ReturnSpecificDrawn(deckId, code string) (string, error) {
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
-
-		tx, err := db.Begin()
-		if err != nil {
-			return DBResponse{Err: err}
-		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-			}
-		}()
-
-		// Check if card exists and how many are drawn
-		var total, inDeck, inPile int
-		if err := tx.QueryRow(
-			`SELECT total, inDeck, inPile FROM DeckEntry WHERE deckId=? AND code=?`,
-			deckId, code,
-		).Scan(&total, &inDeck, &inPile); err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return DBResponse{Err: fmt.Errorf("card %s not found in deck %s", code, deckId)}
-			}
-			return DBResponse{Err: fmt.Errorf("query failed: %w", err)}
-		}
-
-		// Calculate how many are drawn (not in deck, not in pile)
-		drawn := total - inDeck - inPile
-		if drawn <= 0 {
-			return DBResponse{Err: fmt.Errorf(
-				"card %s is not drawn (total=%d, inDeck=%d, inPile=%d)",
-				code, total, inDeck, inPile,
-			)}
-		}
-
-		// Get current top card of the deck
-		var topCardId sql.NullInt64
-		_ = tx.QueryRow(`SELECT topCardId FROM Deck WHERE deckId = ?`, deckId).Scan(&topCardId)
-
-		// Insert a new DeckCard for the returned card on top
-		res, err := tx.Exec(
-			`INSERT INTO DeckCard (deckId, code, nextId) VALUES (?, ?, ?)`,
-			deckId, code, topCardId,
-		)
-		if err != nil {
-			return DBResponse{Err: fmt.Errorf("insert DeckCard: %w", err)}
-		}
-		newCardId, _ := res.LastInsertId()
-
-		// Update Deck.topCardId
-		if _, err := tx.Exec(
-			`UPDATE Deck SET topCardId = ? WHERE deckId = ?`,
-			newCardId, deckId,
-		); err != nil {
-			return DBResponse{Err: fmt.Errorf("update topCardId: %w", err)}
-		}
-
-		// Increment inDeck in DeckEntry
-		if _, err := tx.Exec(
-			`UPDATE DeckEntry SET inDeck = inDeck + 1 WHERE deckId = ? AND code = ?`,
-			deckId, code,
-		); err != nil {
-			return DBResponse{Err: fmt.Errorf("update DeckEntry: %w", err)}
-		}
-
-		if err := tx.Commit(); err != nil {
-			return DBResponse{Err: err}
+// ReturnSpecificDrawnMany Remet des cartes tirees dans la pioche a la position pos, dans
+// l'ordre donne et en une seule transaction. Rien n'est remis si l'une n'est pas tiree
+func (w *WorkerPool) ReturnSpecificDrawnMany(deckId string, codes []string, pos Position) error {
+	if err := pos.check(); err != nil {
+		return err
+	}
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "return"); err != nil {
+			return nil, err
 		}
-
-		return DBResponse{Data: code}
+		return nil, w.returnSpecificDrawnTx(tx, deckId, codes, pos)
 	})
-
-	if resp.Err != nil {
-		return "", resp.Err
-	}
-	out, ok := resp.Data.(string)
-	if !ok {
-		return "", fmt.Errorf("internal: unexpected return value")
-	}
-	return out, nil
+	return resp.Err
 }
 
-// ReturnAllDrawn Retourne toutes les cartes pigees dans le deck
-func (w *WorkerPool) ReturnAllDrawn(deckId string) error {
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
-
-		tx, err := db.Begin()
-		if err != nil {
-			return DBResponse{Err: err}
-		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-			}
-		}()
-
-		var topCardId sql.NullInt64
-		_ = tx.QueryRow(`SELECT topCardId FROM Deck WHERE deckId = ?`, deckId).Scan(&topCardId)
-
-		rows, err := tx.Query(`SELECT code, total, inDeck, inPile FROM DeckEntry WHERE deckId = ?`, deckId)
-		if err != nil {
-			return DBResponse{Err: fmt.Errorf("query DeckEntry: %w", err)}
-		}
-		defer rows.Close()
-
-		type entry struct {
-			code  string
-			count int
-		}
-		var toReturn []entry
-		for rows.Next() {
-			var code string
-			var total, inDeck, inPile int
-			if err := rows.Scan(&code, &total, &inDeck, &inPile); err != nil {
-				return DBResponse{Err: err}
-			}
-			drawn := total - inDeck - inPile
-			if drawn > 0 {
-				toReturn = append(toReturn, entry{code, drawn})
-			}
-		}
-
-		for i := len(toReturn) - 1; i >= 0; i-- {
-			for j := 0; j < toReturn[i].count; j++ {
-				res, err := tx.Exec(`INSERT INTO DeckCard (deckId, code, nextId) VALUES (?, ?, ?)`, deckId, toReturn[i].code, topCardId)
-				if err != nil {
-					return DBResponse{Err: fmt.Errorf("insert DeckCard: %w", err)}
-				}
-				newCardId, _ := res.LastInsertId()
-				topCardId.Int64 = newCardId
-				topCardId.Valid = true
-			}
-		}
-
-		if topCardId.Valid {
-			if _, err := tx.Exec(`UPDATE Deck SET topCardId = ? WHERE deckId = ?`, topCardId, deckId); err != nil {
-				return DBResponse{Err: fmt.Errorf("update topCardId: %w", err)}
-			}
+// returnSpecificDrawnTx remet des cartes tirees et placees nulle part dans la pioche
+// Toutes les cartes sont verifiees avant la premiere modification
+func (w *WorkerPool) returnSpecificDrawnTx(q querier, deckId string, codes []string, pos Position) error {
+	entries, err := deckEntries(q, deckId)
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		entry, ok := entries[code]
+		if !ok {
+			return fmt.Errorf("card %s: %w", code, ErrCardNotInDeck)
 		}
+		// Calculate how many are drawn (not in deck, not in pile)
+		if entry.Drawn <= 0 {
+			return fmt.Errorf(
+				"card %s (total=%d, inDeck=%d, inPile=%d): %w",
+				code, entry.Total, entry.InDeck, entry.InPile, ErrCardNotDrawn,
+			)
+		}
+		entry.Drawn--
+		entries[code] = entry
+	}
 
-		if _, err := tx.Exec(`UPDATE DeckEntry SET inDeck = total - inPile WHERE deckId = ?`, deckId); err != nil {
-			return DBResponse{Err: fmt.Errorf("update DeckEntry: %w", err)}
-		}
+	return w.returnToDeck(q, deckId, "", nil, codes, pos)
+}
 
-		if err := tx.Commit(); err != nil {
-			return DBResponse{Err: err}
+// ReturnAllDrawn Remet toutes les cartes tirees qui ne sont dans aucune pile dans la pioche
+func (w *WorkerPool) ReturnAllDrawn(deckId string, pos Position) error {
+	if err := pos.check(); err != nil {
+		return err
+	}
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "return"); err != nil {
+			return nil, err
 		}
-		return DBResponse{}
+		return nil, w.returnAllDrawnTx(tx, deckId, pos)
 	})
 	return resp.Err
 }
 
-// ReturnSpecificFromPile Retourne des cartes specifiques d'une pile dans le deck
-func (w *WorkerPool) ReturnSpecificFromPile(deckId, pileName, code string) (string, error) {
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
-
-		var pileId int64
-		if err := db.QueryRow(`SELECT id FROM Pile WHERE deckId=? AND name=?`, deckId, pileName).Scan(&pileId); err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return DBResponse{Err: fmt.Errorf("pile %s not found", pileName)}
-			}
-			return DBResponse{Err: fmt.Errorf("pile query: %w", err)}
+// returnAllDrawnTx remet toutes les cartes tirees et placees nulle part dans la pioche
+// Les codes sont pris dans l'ordre alphabetique pour qu'un deck avec graine les remette
+// toujours aux memes positions
+func (w *WorkerPool) returnAllDrawnTx(q querier, deckId string, pos Position) error {
+	rows, err := q.Query(`SELECT code, total - inDeck - inPile FROM DeckEntry WHERE deckId = ? ORDER BY code`, deckId)
+	if err != nil {
+		return fmt.Errorf("query DeckEntry: %w", err)
+	}
+	var codes []string
+	for rows.Next() {
+		var code string
+		var drawn int
+		if err := rows.Scan(&code, &drawn); err != nil {
+			rows.Close()
+			return err
+		}
+		for ; drawn > 0; drawn-- {
+			codes = append(codes, code)
 		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-		var cardId int64
-		var next sql.NullInt64
-		if err := db.QueryRow(`SELECT id, nextCardId FROM PileCard WHERE pileId=? AND code=?`, pileId, code).Scan(&cardId, &next); err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return DBResponse{Err: fmt.Errorf("card %s not in pile %s", code, pileName)}
-			}
-			return DBResponse{Err: fmt.Errorf("pilecard query: %w", err)}
-		}
+	return w.returnToDeck(q, deckId, "", nil, codes, pos)
+}
 
-		var prevId sql.NullInt64
-		_ = db.QueryRow(`SELECT id FROM PileCard WHERE pileId=? AND nextCardId=?`, pileId, cardId).Scan(&prevId)
+// ReturnSpecificFromPile Remet une carte d'une pile dans la pioche a la position pos
+func (w *WorkerPool) ReturnSpecificFromPile(deckId, pileName, code string, pos Position) (string, error) {
+	if err := w.ReturnSpecificFromPileMany(deckId, pileName, []string{code}, pos); err != nil {
+		return "", err
+	}
+	return code, nil
+}
 
-		tx, err := db.Begin()
-		if err != nil {
-			return DBResponse{Err: fmt.Errorf("begin tx: %w", err)}
+// ReturnSpecificFromPileMany Remet des cartes d'une pile dans la pioche a la position pos,
+// dans l'ordre donne et en une seule transaction. Rien n'est remis si l'une n'est pas dans la pile
+func (w *WorkerPool) ReturnSpecificFromPileMany(deckId, pileName string, codes []string, pos Position) error {
+	if err := pos.check(); err != nil {
+		return err
+	}
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "return"); err != nil {
+			return nil, err
 		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-			}
-		}()
+		return nil, w.returnSpecificFromPileTx(tx, deckId, pileName, codes, pos)
+	})
+	return resp.Err
+}
 
-		if prevId.Valid {
-			if _, err := tx.Exec(`UPDATE PileCard SET nextCardId=? WHERE id=?`, next, prevId.Int64); err != nil {
-				return DBResponse{Err: fmt.Errorf("update prev: %w", err)}
-			}
-		}
+// returnSpecificFromPileTx remet des cartes d'une pile, les plus proches du dessus, dans la pioche
+// Toutes les cartes sont verifiees avant la premiere modification
+func (w *WorkerPool) returnSpecificFromPileTx(q querier, deckId, pileName string, codes []string, pos Position) error {
+	pileId, err := pileID(q, deckId, pileName)
+	if err != nil {
+		return err
+	}
+	cards, err := pileChain(q, pileId)
+	if err != nil {
+		return err
+	}
+	if err := checkInPile(chainCodes(cards), pileName, codes); err != nil {
+		return err
+	}
 
-		if _, err := tx.Exec(`DELETE FROM PileCard WHERE id=?`, cardId); err != nil {
-			return DBResponse{Err: fmt.Errorf("delete pilecard: %w", err)}
+	from := make([]int, len(codes))
+	for k, code := range codes {
+		from[k] = chainIndex(cards, code)
+		if cards, err = unlinkPileCard(q, cards, from[k]); err != nil {
+			return err
 		}
-
-		res, err := tx.Exec(`
+		res, err := q.Exec(`
             UPDATE DeckEntry
-            SET inPile = inPile - 1, inDeck = inDeck + 1
+            SET inPile = inPile - 1
             WHERE deckId = ? AND code = ? AND inPile > 0
         `, deckId, code)
 		if err != nil {
-			return DBResponse{Err: fmt.Errorf("update deckentry: %w", err)}
+			return fmt.Errorf("update deckentry: %w", err)
 		}
-		rows, _ := res.RowsAffected()
-		if rows == 0 {
-			return DBResponse{Err: fmt.Errorf("inconsistent DeckEntry for code %s (not in pile)", code)}
-		}
-
-		var topCardId sql.NullInt64
-		_ = tx.QueryRow(`SELECT topCardId FROM Deck WHERE deckId = ?`, deckId).Scan(&topCardId)
-
-		res2, err := tx.Exec(`INSERT INTO DeckCard (deckId, code, nextId) VALUES (?, ?, ?)`, deckId, code, topCardId)
-		if err != nil {
-			return DBResponse{Err: fmt.Errorf("insert DeckCard: %w", err)}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("inconsistent DeckEntry for code %s (not in pile)", code)
 		}
-		newCardId, _ := res2.LastInsertId()
+	}
 
-		if _, err := tx.Exec(`UPDATE Deck SET topCardId = ? WHERE deckId = ?`, newCardId, deckId); err != nil {
-			return DBResponse{Err: fmt.Errorf("update topCardId: %w", err)}
-		}
+	return w.returnToDeck(q, deckId, pileName, from, codes, pos)
+}
 
-		if err := tx.Commit(); err != nil {
-			return DBResponse{Err: fmt.Errorf("commit: %w", err)}
+// ReturnAllFromPile Remet toutes les cartes d'une pile dans la pioche a la position pos,
+// dans l'ordre de la pile
+func (w *WorkerPool) ReturnAllFromPile(deckId, pileName string, pos Position) error {
+	if err := pos.check(); err != nil {
+		return err
+	}
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "return"); err != nil {
+			return nil, err
 		}
-		return DBResponse{Data: code}
+		return nil, w.returnAllFromPileTx(tx, deckId, pileName, pos)
 	})
-	if resp.Err != nil {
-		return "", resp.Err
-	}
-	out, ok := resp.Data.(string)
-	if !ok {
-		return "", fmt.Errorf("internal: unexpected return value")
-	}
-	return out, nil
+	return resp.Err
 }
 
-// ReturnAllFromPile Retourne toutes les cartes d'une pile dans le deck
-func (w *WorkerPool) ReturnAllFromPile(deckId, pileName string) error {
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
-
-		// get pile id
-		var pileId int64
-		if err := db.QueryRow(`SELECT id FROM Pile WHERE deckId=? AND name=?`, deckId, pileName).Scan(&pileId); err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return DBResponse{Err: fmt.Errorf("pile %s not found", pileName)}
-			}
-			return DBResponse{Err: fmt.Errorf("pile query: %w", err)}
-		}
+// returnAllFromPileTx vide une pile dans la pioche en gardant l'ordre de la pile
+func (w *WorkerPool) returnAllFromPileTx(q querier, deckId, pileName string, pos Position) error {
+	pileId, err := pileID(q, deckId, pileName)
+	if err != nil {
+		return err
+	}
+	cards, err := pileChain(q, pileId)
+	if err != nil {
+		return err
+	}
+	codes := chainCodes(cards)
 
-		// gather all img in the pile (in order)
-		rows, err := db.Query(`
-			SELECT code FROM PileCard 
-			WHERE pileId=? 
-			ORDER BY id ASC
-		`, pileId)
+	// count occurrences per code for DeckEntry update
+	codeCounts := make(map[string]int64)
+	for _, code := range codes {
+		codeCounts[code]++
+	}
+	for code, cnt := range codeCounts {
+		res, err := q.Exec(`
+            UPDATE DeckEntry
+            SET inPile = inPile - ?
+            WHERE deckId = ? AND code = ? AND inPile >= ?
+        `, cnt, deckId, code, cnt)
 		if err != nil {
-			return DBResponse{Err: fmt.Errorf("query pilecards: %w", err)}
+			return fmt.Errorf("update deckentry: %w", err)
 		}
-		defer rows.Close()
-
-		var codes []string
-		for rows.Next() {
-			var code string
-			if err := rows.Scan(&code); err != nil {
-				return DBResponse{Err: fmt.Errorf("scan: %w", err)}
-			}
-			codes = append(codes, code)
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("inconsistent DeckEntry for code %s", code)
 		}
+	}
 
-		// count occurrences per code for DeckEntry update
-		codeCounts := make(map[string]int64)
-		for _, code := range codes {
-			codeCounts[code]++
-		}
+	if _, err := q.Exec(`DELETE FROM PileCard WHERE pileId = ?`, pileId); err != nil {
+		return fmt.Errorf("delete pilecards: %w", err)
+	}
 
-		tx, err := db.Begin()
-		if err != nil {
-			return DBResponse{Err: fmt.Errorf("begin tx: %w", err)}
-		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-			}
-		}()
-
-		for code, cnt := range codeCounts {
-			res, err := tx.Exec(`
-                UPDATE DeckEntry
-                SET inPile = inPile - ?, inDeck = inDeck + ?
-                WHERE deckId = ? AND code = ? AND inPile >= ?
-            `, cnt, cnt, deckId, code, cnt)
-			if err != nil {
-				return DBResponse{Err: fmt.Errorf("update deckentry: %w", err)}
-			}
-			n, _ := res.RowsAffected()
-			if n == 0 {
-				return DBResponse{Err: fmt.Errorf("inconsistent DeckEntry for code %s", code)}
-			}
-		}
+	return w.returnToDeck(q, deckId, pileName, make([]int, len(codes)), codes, pos)
+}
 
-		if _, err := tx.Exec(`DELETE FROM PileCard WHERE pileId = ?`, pileId); err != nil {
-			return DBResponse{Err: fmt.Errorf("delete pilecards: %w", err)}
+// returnToDeck insere codes, venant de la pile pile ou des cartes tirees si vide, dans la
+// pioche a la position pos en gardant leur ordre
+// from donne pour le journal les index successifs des cartes retirees de la pile
+// DeckEntry.inDeck est incremente pour chaque carte
+func (w *WorkerPool) returnToDeck(q querier, deckId, pile string, from []int, codes []string, pos Position) error {
+	shuffler, err := w.positionShuffler(q, deckId, pos)
+	if err != nil {
+		return err
+	}
+	cards, err := deckChain(q, deckId)
+	if err != nil {
+		return err
+	}
+	positions := make([]int, len(codes))
+	for n, code := range codes {
+		positions[n] = pos.index(n, len(cards), shuffler)
+		if cards, err = spliceDeckCard(q, deckId, cards, positions[n], code); err != nil {
+			return err
 		}
+	}
+	returned := Action{Action: ActionReturn, Pile: pile, Cards: codes, Positions: positions, From: from}
+	if err := w.logAction(q, deckId, returned); err != nil {
+		return err
+	}
+	return w.emit(q, deckId, EventReturned, pile, codes)
+}
 
-		var topCardId sql.NullInt64
-		_ = tx.QueryRow(`SELECT topCardId FROM Deck WHERE deckId = ?`, deckId).Scan(&topCardId)
+// DrawCards Pige jusqu'a amount cartes et retourne les codes et le nombre de cartes restantes
+func (w *WorkerPool) DrawCards(deckId string, amount int) ([]string, int, error) {
+	return w.DrawCardsFrom(deckId, "top", amount)
+}
 
-		for i := len(codes) - 1; i >= 0; i-- {
-			res, err := tx.Exec(`INSERT INTO DeckCard (deckId, code, nextId) VALUES (?, ?, ?)`, deckId, codes[i], topCardId)
-			if err != nil {
-				return DBResponse{Err: fmt.Errorf("insert DeckCard: %w", err)}
-			}
-			newCardId, _ := res.LastInsertId()
-			topCardId.Int64 = newCardId
-			topCardId.Valid = true
+// DeleteDeck Supprime un deck, ses cartes, ses piles et son inventaire (ON DELETE CASCADE)
+// Les abonnes du deck recoivent EventDeckDeleted puis leur canal est ferme
+func (w *WorkerPool) DeleteDeck(deckId string) error {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM Deck WHERE deckId = ?)`, deckId).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("echec de lecture du deck: %w", err)
 		}
-
-		if topCardId.Valid {
-			if _, err := tx.Exec(`UPDATE Deck SET topCardId = ? WHERE deckId = ?`, topCardId, deckId); err != nil {
-				return DBResponse{Err: fmt.Errorf("update topCardId: %w", err)}
-			}
+		if !exists {
+			return nil, fmt.Errorf("deck %s: %w", deckId, ErrDeckNotFound)
 		}
-
-		if err := tx.Commit(); err != nil {
-			return DBResponse{Err: fmt.Errorf("commit: %w", err)}
+		// L'evenement part avec le deck, mais son id reste reserve par AUTOINCREMENT
+		if err := w.emit(tx, deckId, EventDeckDeleted, "", nil); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`DELETE FROM Deck WHERE deckId = ?`, deckId); err != nil {
+			return nil, fmt.Errorf("echec de suppression du deck: %w", err)
 		}
-		return DBResponse{}
+		return nil, nil
 	})
 	return resp.Err
 }
 
-// DrawCards Pige jusqu'a amount cartes et retourne les codes et le nombre de cartes restantes
-func (w *WorkerPool) DrawCards(deckId string, amount int) ([]string, int, error) {
-	resp := w.Execute(func() DBResponse {
-		db := w.handler.db
-		w.handler.Lock()
-		defer w.handler.UnLock()
-
-		var remaining int
-		row := db.QueryRow(`SELECT COUNT(*) FROM DeckCard WHERE deckId = ?`, deckId)
-		if err := row.Scan(&remaining); err != nil {
-			return DBResponse{Err: fmt.Errorf("echec de lecture du deck: %w", err)}
+// DeletePile Supprime une pile, ses cartes redeviennent pigees (hors deck et hors pile)
+// Retourne le nombre de cartes liberees
+func (w *WorkerPool) DeletePile(deckId, pileName string) (int, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "deletePile"); err != nil {
+			return nil, err
 		}
 
-		if remaining < amount {
-			amount = remaining
+		pileId, err := pileID(tx, deckId, pileName)
+		if err != nil {
+			return nil, err
 		}
-		if amount == 0 {
-			return DBResponse{Data: struct {
-				Codes     []string
-				Remaining int
-			}{Codes: []string{}, Remaining: remaining}}
+		cards, err := pileChain(tx, pileId)
+		if err != nil {
+			return nil, err
 		}
 
-		tx, err := db.Begin()
+		rows, err := tx.Query(`SELECT code, COUNT(*) FROM PileCard WHERE pileId = ? GROUP BY code`, pileId)
 		if err != nil {
-			return DBResponse{Err: fmt.Errorf("echec de demarrage de transaction: %w", err)}
+			return nil, fmt.Errorf("echec de lecture des cartes de la pile: %w", err)
 		}
-		defer func() {
-			if err != nil {
-				_ = tx.Rollback()
-			}
-		}()
-
-		var codes []string
-		for i := 0; i < amount; i++ {
-			var topCardId int64
-			var topCardCode string
-			var nextId sql.NullInt64
-
-			row := tx.QueryRow(`SELECT DeckCard.id, DeckCard.code, DeckCard.nextId FROM DeckCard INNER JOIN Deck ON DeckCard.id = Deck.topCardId WHERE Deck.deckId = ?`, deckId)
-			if err := row.Scan(&topCardId, &topCardCode, &nextId); err != nil {
-				if err == sql.ErrNoRows {
-					// no top card
-					break
-				}
-				return DBResponse{Err: fmt.Errorf("echec de lecture de la carte du top: %w", err)}
-			}
-
-			// UPDATE inDeck
-			if _, err := tx.Exec(`UPDATE DeckEntry SET inDeck = inDeck - 1 WHERE deckId = ? AND code = ?`, deckId, topCardCode); err != nil {
-				return DBResponse{Err: fmt.Errorf("echec de mise a jour de DeckEntry: %w", err)}
+		counts := make(map[string]int)
+		for rows.Next() {
+			var code string
+			var count int
+			if err := rows.Scan(&code, &count); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("echec de lecture des cartes de la pile: %w", err)
 			}
+			counts[code] = count
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
 
-			codes = append(codes, topCardCode)
-
-			// UPDATE topCardId
-			var newTopId interface{}
-			if nextId.Valid {
-				newTopId = nextId.Int64
-			} else {
-				newTopId = nil
+		released := 0
+		for code, count := range counts {
+			res, err := tx.Exec(`UPDATE DeckEntry SET inPile = inPile - ? WHERE deckId = ? AND code = ? AND inPile >= ?`, count, deckId, code, count)
+			if err != nil {
+				return nil, fmt.Errorf("echec de mise a jour de DeckEntry: %w", err)
 			}
-			if _, err := tx.Exec(`UPDATE Deck SET topCardId = ? WHERE deckId = ?`, newTopId, deckId); err != nil {
-				return DBResponse{Err: fmt.Errorf("echec de mise a jour du topCardId: %w", err)}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return nil, fmt.Errorf("inconsistent DeckEntry for code %s", code)
 			}
-
-			// DELETE card
-			if _, err := tx.Exec(`DELETE FROM DeckCard WHERE id = ?`, topCardId); err != nil {
-				return DBResponse{Err: fmt.Errorf("echec de suppression de carte: %w", err)}
-			}
-
-			remaining--
+			released += count
 		}
 
-		if err := tx.Commit(); err != nil {
-			return DBResponse{Err: fmt.Errorf("echec de commit: %w", err)}
+		if _, err := tx.Exec(`DELETE FROM Pile WHERE id = ?`, pileId); err != nil {
+			return nil, fmt.Errorf("echec de suppression de la pile: %w", err)
 		}
-
-		return DBResponse{Data: struct {
-			Codes     []string
-			Remaining int
-		}{Codes: codes, Remaining: remaining}}
+		codes := chainCodes(cards)
+		deleted := Action{Action: ActionPileDelete, Pile: pileName, Cards: codes, Positions: make([]int, len(codes))}
+		if err := w.logAction(tx, deckId, deleted); err != nil {
+			return nil, err
+		}
+		return released, w.emit(tx, deckId, EventPileDeleted, pileName, codes)
 	})
-
 	if resp.Err != nil {
-		return nil, 0, resp.Err
-	}
-	data, ok := resp.Data.(struct {
-		Codes     []string
-		Remaining int
-	})
-	if !ok {
-		type drawResult struct {
-			Codes     []string
-			Remaining int
-		}
-		dr, ok2 := resp.Data.(drawResult)
-		if ok2 {
-			return dr.Codes, dr.Remaining, nil
-		}
-		// fallback: attempt to interpret as map[string]interface{}
-		if m, ok := resp.Data.(map[string]interface{}); ok {
-			codes, _ := m["Codes"].([]string)
-			rem, _ := m["Remaining"].(int)
-			return codes, rem, nil
-		}
-
-		return nil, 0, fmt.Errorf("internal: unexpected draw result")
+		return 0, resp.Err
 	}
-	return data.Codes, data.Remaining, nil
+	return resp.Data.(int), nil
 }
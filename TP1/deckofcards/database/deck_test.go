@@ -0,0 +1,1103 @@
+package database
+
+import (
+	"deckofcards/models"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Helper: compte les lignes d'une table appartenant a un deck
+func countRows(t *testing.T, h *DBHandler, query string, deckId string) int {
+	t.Helper()
+	var n int
+	if err := h.db.QueryRow(query, deckId).Scan(&n); err != nil {
+		t.Fatalf("count query failed: %v", err)
+	}
+	return n
+}
+
+func TestDeleteDeck_Cascade(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	drawn, _, err := wp.DrawCards(deckId, 5)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn[:3]); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+
+	if err := wp.DeleteDeck(deckId); err != nil {
+		t.Fatalf("DeleteDeck: %v", err)
+	}
+
+	queries := map[string]string{
+		"Deck":      `SELECT COUNT(*) FROM Deck WHERE deckId = ?`,
+		"DeckCard":  `SELECT COUNT(*) FROM DeckCard WHERE deckId = ?`,
+		"Pile":      `SELECT COUNT(*) FROM Pile WHERE deckId = ?`,
+		"DeckEntry": `SELECT COUNT(*) FROM DeckEntry WHERE deckId = ?`,
+	}
+	for table, query := range queries {
+		if n := countRows(t, handler, query, deckId); n != 0 {
+			t.Errorf("%s still has %d rows after DeleteDeck", table, n)
+		}
+	}
+	var orphans int
+	if err := handler.db.QueryRow(`SELECT COUNT(*) FROM PileCard WHERE pileId NOT IN (SELECT id FROM Pile)`).Scan(&orphans); err != nil {
+		t.Fatalf("count PileCard: %v", err)
+	}
+	if orphans != 0 {
+		t.Errorf("PileCard still has %d orphan rows after DeleteDeck", orphans)
+	}
+
+	if err := wp.DeleteDeck(deckId); !errors.Is(err, ErrDeckNotFound) {
+		t.Errorf("second DeleteDeck error = %v, want ErrDeckNotFound", err)
+	}
+}
+
+func TestDeletePile_ReleasesCards(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	drawn, _, err := wp.DrawCards(deckId, 4)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	if _, err := wp.InsertIntoPile("discard", deckId, drawn); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+
+	released, err := wp.DeletePile(deckId, "discard")
+	if err != nil {
+		t.Fatalf("DeletePile: %v", err)
+	}
+	if released != 4 {
+		t.Errorf("released = %d, want 4", released)
+	}
+	if n := countRows(t, handler, `SELECT COALESCE(SUM(inPile), 0) FROM DeckEntry WHERE deckId = ?`, deckId); n != 0 {
+		t.Errorf("inPile sum = %d, want 0", n)
+	}
+
+	// Les cartes liberees peuvent etre remises dans une pile
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn); err != nil {
+		t.Errorf("InsertIntoPile after DeletePile: %v", err)
+	}
+
+	if _, err := wp.DeletePile(deckId, "discard"); !errors.Is(err, ErrPileNotFound) {
+		t.Errorf("DeletePile on missing pile error = %v, want ErrPileNotFound", err)
+	}
+	if _, err := wp.DeletePile("missing", "hand"); !errors.Is(err, ErrDeckNotFound) {
+		t.Errorf("DeletePile on missing deck error = %v, want ErrDeckNotFound", err)
+	}
+}
+
+func TestDeckExpiry(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	now := time.Now()
+	wp.ttl = time.Hour
+	wp.now = func() time.Time { return now }
+
+	expired := createConcurrencyTestDeck(t, wp)
+	active := createConcurrencyTestDeck(t, wp)
+	watched := createConcurrencyTestDeck(t, wp)
+
+	now = now.Add(50 * time.Minute)
+	if _, _, err := wp.DrawCards(active, 1); err != nil {
+		t.Fatalf("DrawCards on active deck: %v", err)
+	}
+	// Une lecture prolonge aussi le deck
+	if _, err := wp.ListPiles(watched); err != nil {
+		t.Fatalf("ListPiles on watched deck: %v", err)
+	}
+	// sans ecrire dans la base, la purge reporte l'acces
+	lastAccess := func() int64 {
+		var at int64
+		if err := handler.db.QueryRow(`SELECT lastAccessedAt FROM Deck WHERE deckId = ?`, watched).Scan(&at); err != nil {
+			t.Fatalf("read lastAccessedAt: %v", err)
+		}
+		return at
+	}
+	if lastAccess() == now.Unix() {
+		t.Errorf("ListPiles wrote lastAccessedAt")
+	}
+
+	now = now.Add(20 * time.Minute)
+	if _, _, err := wp.DrawCards(expired, 1); !errors.Is(err, ErrDeckExpired) {
+		t.Errorf("DrawCards on expired deck error = %v, want ErrDeckExpired", err)
+	}
+	if _, err := wp.CardsInDeck(active); err != nil {
+		t.Errorf("CardsInDeck on active deck: %v", err)
+	}
+	if err := wp.TouchDeck(watched); err != nil {
+		t.Errorf("TouchDeck on watched deck: %v", err)
+	}
+
+	purged, err := wp.PurgeExpired(10)
+	if err != nil {
+		t.Fatalf("PurgeExpired: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("purged = %d, want 1", purged)
+	}
+	if lastAccess() != now.Unix() {
+		t.Errorf("PurgeExpired did not write the last access of the watched deck")
+	}
+	if _, err := wp.CardsInDeck(expired); !errors.Is(err, ErrDeckNotFound) {
+		t.Errorf("CardsInDeck on purged deck error = %v, want ErrDeckNotFound", err)
+	}
+	if n := countRows(t, handler, `SELECT COUNT(*) FROM DeckCard WHERE deckId = ?`, expired); n != 0 {
+		t.Errorf("purged deck still has %d cards", n)
+	}
+}
+
+func TestPurgeExpired_Batches(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	now := time.Now()
+	wp.ttl = time.Minute
+	wp.now = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		createConcurrencyTestDeck(t, wp)
+	}
+	now = now.Add(2 * time.Minute)
+
+	for _, want := range []int{2, 2, 1, 0} {
+		n, err := wp.PurgeExpired(2)
+		if err != nil {
+			t.Fatalf("PurgeExpired: %v", err)
+		}
+		if n != want {
+			t.Errorf("PurgeExpired(2) = %d, want %d", n, want)
+		}
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	drawn, _, err := wp.DrawCards(deckId, 2)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn[:1]); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"DrawCards unknown deck", lastErr(wp.DrawCards("missing", 1)), ErrDeckNotFound},
+		{"ShuffleDeck unknown deck", lastErr(wp.ShuffleDeck("missing")), ErrDeckNotFound},
+		{"ListPiles unknown deck", lastErr(wp.ListPiles("missing")), ErrDeckNotFound},
+		{"DrawFromPile unknown pile", lastErr(wp.DrawFromPile(deckId, "nope", "top")), ErrPileNotFound},
+		{"DrawFromPile invalid method", lastErr(wp.DrawFromPile(deckId, "hand", "middle")), ErrInvalidMethod},
+		{"DrawSpecificFromPile missing card", lastErr(wp.DrawSpecificFromPile(deckId, "hand", drawn[1])), ErrCardNotInPile},
+		{"InsertIntoPile card still in deck", lastErr(wp.InsertIntoPile("hand", deckId, []string{"KD"})), ErrCardNotDrawn},
+		{"InsertIntoPile unknown card", lastErr(wp.InsertIntoPile("hand", deckId, []string{"ZR"})), ErrCardNotInDeck},
+		{"ReturnSpecificDrawn not drawn", lastErr(wp.ReturnSpecificDrawn(deckId, drawn[0], PositionTop)), ErrCardNotDrawn},
+		{"ReturnAllFromPile unknown pile", wp.ReturnAllFromPile(deckId, "nope", PositionTop), ErrPileNotFound},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, tt.err, tt.want)
+		}
+	}
+
+	if _, err := wp.DrawFromPile(deckId, "hand", "top"); err != nil {
+		t.Fatalf("DrawFromPile: %v", err)
+	}
+	if _, err := wp.DrawFromPile(deckId, "hand", "top"); !errors.Is(err, ErrPileEmpty) {
+		t.Errorf("DrawFromPile on empty pile error = %v, want ErrPileEmpty", err)
+	}
+}
+
+// lastErr retourne l'erreur d'un appel a plusieurs valeurs de retour
+func lastErr(values ...interface{}) error {
+	err, _ := values[len(values)-1].(error)
+	return err
+}
+
+// Une meme graine et une meme suite d'operations donnent toujours les memes cartes
+func TestSeededDeckReplay(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	play := func() []string {
+		seed := int64(1234)
+		deck := models.NewMultiDeck(1, false)
+		deck.Seed = &seed
+		deck.Shuffle()
+		deckId, err := wp.InsertDeck(deck)
+		if err != nil {
+			t.Fatalf("InsertDeck: %v", err)
+		}
+
+		var log []string
+		drawn, _, err := wp.DrawCards(deckId, 10)
+		if err != nil {
+			t.Fatalf("DrawCards: %v", err)
+		}
+		log = append(log, drawn...)
+		if _, err := wp.InsertIntoPile("hand", deckId, drawn); err != nil {
+			t.Fatalf("InsertIntoPile: %v", err)
+		}
+		pile, err := wp.ShufflePile(deckId, "hand")
+		if err != nil {
+			t.Fatalf("ShufflePile: %v", err)
+		}
+		log = append(log, pile...)
+		code, err := wp.DrawFromPile(deckId, "hand", "random")
+		if err != nil {
+			t.Fatalf("DrawFromPile: %v", err)
+		}
+		log = append(log, code)
+		shuffled, err := wp.ShuffleDeck(deckId)
+		if err != nil {
+			t.Fatalf("ShuffleDeck: %v", err)
+		}
+		if shuffled.Seed == nil || *shuffled.Seed != seed {
+			t.Fatalf("ShuffleDeck seed = %v, want %d", shuffled.Seed, seed)
+		}
+		return append(log, shuffled.Cards...)
+	}
+
+	first, second := play(), play()
+	if !slices.Equal(first, second) {
+		t.Fatalf("seeded games diverged:\n%v\n%v", first, second)
+	}
+}
+
+func TestShuffleDeckSeeded(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	a := createConcurrencyTestDeck(t, wp)
+	b := createConcurrencyTestDeck(t, wp)
+
+	da, err := wp.ShuffleDeckSeeded(a, 99)
+	if err != nil {
+		t.Fatalf("ShuffleDeckSeeded: %v", err)
+	}
+	db, err := wp.ShuffleDeckSeeded(b, 99)
+	if err != nil {
+		t.Fatalf("ShuffleDeckSeeded: %v", err)
+	}
+	if !slices.Equal(da.Cards, db.Cards) {
+		t.Fatalf("same seed on identical decks gave different orders")
+	}
+	if da.Seed == nil || *da.Seed != 99 {
+		t.Errorf("seed = %v, want 99", da.Seed)
+	}
+
+	// Les melanges suivants utilisent la graine enregistree sur le deck
+	na, _ := wp.ShuffleDeck(a)
+	nb, _ := wp.ShuffleDeck(b)
+	if !slices.Equal(na.Cards, nb.Cards) {
+		t.Errorf("follow-up shuffles of seeded decks diverged")
+	}
+	if slices.Equal(na.Cards, da.Cards) {
+		t.Errorf("follow-up shuffle repeated the previous order")
+	}
+}
+
+func TestDeckState(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	drawn, _, err := wp.DrawCards(deckId, 5)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn[:2]); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+
+	state, err := wp.DeckState(deckId, true)
+	if err != nil {
+		t.Fatalf("DeckState: %v", err)
+	}
+	if state.Remaining != 47 || len(state.Cards) != 47 {
+		t.Errorf("remaining = %d, revealed %d cards, want 47", state.Remaining, len(state.Cards))
+	}
+	if state.Drawn != 3 {
+		t.Errorf("drawn = %d, want 3", state.Drawn)
+	}
+	if state.Piles["hand"] != 2 {
+		t.Errorf("hand = %d, want 2", state.Piles["hand"])
+	}
+	if e := state.Entries[drawn[0]]; e.Total != 1 || e.InDeck != 0 || e.InPile != 1 || e.Drawn != 0 {
+		t.Errorf("entry %s = %+v", drawn[0], e)
+	}
+	if e := state.Entries[drawn[4]]; e.Drawn != 1 {
+		t.Errorf("entry %s = %+v, want drawn 1", drawn[4], e)
+	}
+
+	// L'ordre revele correspond aux prochains tirages
+	next, _, err := wp.DrawCards(deckId, 3)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	if !slices.Equal(next, state.Cards[:3]) {
+		t.Errorf("revealed %v, then drew %v", state.Cards[:3], next)
+	}
+
+	hidden, err := wp.DeckState(deckId, false)
+	if err != nil {
+		t.Fatalf("DeckState: %v", err)
+	}
+	if hidden.Cards != nil {
+		t.Errorf("cards revealed without reveal")
+	}
+}
+
+func TestPeek_DoesNotDraw(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	peeked, remaining, err := wp.PeekDeck(deckId, 3)
+	if err != nil {
+		t.Fatalf("PeekDeck: %v", err)
+	}
+	if remaining != 52 {
+		t.Errorf("remaining = %d, want 52", remaining)
+	}
+	drawn, _, err := wp.DrawCards(deckId, 5)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	if !slices.Equal(peeked, drawn[:3]) {
+		t.Errorf("peeked %v, then drew %v", peeked, drawn[:3])
+	}
+
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+	pile, _, err := wp.GetPileCards(deckId, "hand")
+	if err != nil {
+		t.Fatalf("GetPileCards: %v", err)
+	}
+
+	top, n, err := wp.PeekPile(deckId, "hand", 2, false)
+	if err != nil {
+		t.Fatalf("PeekPile: %v", err)
+	}
+	if n != 5 || !slices.Equal(top, pile[:2]) {
+		t.Errorf("top peek = %v (%d), pile = %v", top, n, pile)
+	}
+	bottom, _, err := wp.PeekPile(deckId, "hand", 10, true)
+	if err != nil {
+		t.Fatalf("PeekPile: %v", err)
+	}
+	want := slices.Clone(pile)
+	slices.Reverse(want)
+	if !slices.Equal(bottom, want) {
+		t.Errorf("bottom peek = %v, want %v", bottom, want)
+	}
+	if code, err := wp.DrawFromPile(deckId, "hand", "bottom"); err != nil || code != bottom[0] {
+		t.Errorf("bottom draw = %q (%v), want %q", code, err, bottom[0])
+	}
+
+	if _, _, err := wp.PeekPile(deckId, "missing", 1, false); !errors.Is(err, ErrPileNotFound) {
+		t.Errorf("PeekPile missing pile error = %v, want ErrPileNotFound", err)
+	}
+}
+
+func TestDrawFromDeckMiddle(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	before, err := wp.DeckState(deckId, true)
+	if err != nil {
+		t.Fatalf("DeckState: %v", err)
+	}
+
+	bottom, remaining, err := wp.DrawCardsFrom(deckId, "bottom", 2)
+	if err != nil {
+		t.Fatalf("DrawCardsFrom bottom: %v", err)
+	}
+	if remaining != 50 || !slices.Equal(bottom, []string{before.Cards[51], before.Cards[50]}) {
+		t.Errorf("bottom draw = %v (%d remaining)", bottom, remaining)
+	}
+
+	middle := []string{before.Cards[10], before.Cards[20]}
+	if _, remaining, err = wp.DrawSpecificFromDeck(deckId, middle); err != nil || remaining != 48 {
+		t.Fatalf("DrawSpecificFromDeck = %d, %v", remaining, err)
+	}
+	// Une carte absente annule tout le tirage
+	if _, _, err := wp.DrawSpecificFromDeck(deckId, []string{before.Cards[0], middle[0]}); !errors.Is(err, ErrCardNotInDeck) {
+		t.Errorf("drawing an already drawn card error = %v, want ErrCardNotInDeck", err)
+	}
+
+	random, _, err := wp.DrawCardsFrom(deckId, "random", 3)
+	if err != nil || len(random) != 3 {
+		t.Fatalf("DrawCardsFrom random = %v, %v", random, err)
+	}
+	if _, _, err := wp.DrawCardsFrom(deckId, "sideways", 1); !errors.Is(err, ErrInvalidMethod) {
+		t.Errorf("invalid method error = %v", err)
+	}
+
+	// La chaine reste coherente avec l'inventaire
+	after, err := wp.DeckState(deckId, true)
+	if err != nil {
+		t.Fatalf("DeckState: %v", err)
+	}
+	drawn := append(append(bottom, middle...), random...)
+	want := slices.DeleteFunc(slices.Clone(before.Cards), func(c string) bool { return slices.Contains(drawn, c) })
+	if !slices.Equal(after.Cards, want) {
+		t.Errorf("remaining order = %v, want %v", after.Cards, want)
+	}
+	inDeck := 0
+	for _, e := range after.Entries {
+		inDeck += e.InDeck
+	}
+	if after.Remaining != 45 || inDeck != 45 || after.Drawn != 7 {
+		t.Errorf("remaining %d, inDeck %d, drawn %d", after.Remaining, inDeck, after.Drawn)
+	}
+
+	// Un code repete tire plusieurs exemplaires d'un deck de deux paquets, pas plus
+	doubleId, err := wp.InsertDeck(models.NewMultiDeck(2, false))
+	if err != nil {
+		t.Fatalf("InsertDeck: %v", err)
+	}
+	if cards, remaining, err := wp.DrawSpecificFromDeck(doubleId, []string{"AS", "AS"}); err != nil || remaining != 102 || !slices.Equal(cards, []string{"AS", "AS"}) {
+		t.Errorf("drawing AS twice = %v (%d remaining), %v", cards, remaining, err)
+	}
+	if _, _, err := wp.DrawSpecificFromDeck(doubleId, []string{"KH", "AS"}); !errors.Is(err, ErrCardNotInDeck) {
+		t.Errorf("drawing a third AS error = %v, want ErrCardNotInDeck", err)
+	}
+}
+
+func TestInsertDeckAndDraw(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deck := models.NewMultiDeck(1, false)
+	deckId, cards, remaining, err := wp.InsertDeckAndDraw(deck, 3)
+	if err != nil {
+		t.Fatalf("InsertDeckAndDraw: %v", err)
+	}
+	if remaining != 49 || !slices.Equal(cards, deck.Cards[:3]) {
+		t.Errorf("drawn %v (%d remaining), want the 3 top cards", cards, remaining)
+	}
+	// Le tirage est une operation du deck, annulable comme un tirage separe
+	if op, err := wp.Undo(deckId); err != nil || op != "draw" {
+		t.Fatalf("Undo = %q, %v", op, err)
+	}
+	if n, err := wp.CardsInDeck(deckId); err != nil || n != 52 {
+		t.Errorf("CardsInDeck after undo = %d, %v; want 52", n, err)
+	}
+	if countRows(t, handler, `SELECT COUNT(*) FROM Deck WHERE deckId = ?`, deckId) != 1 {
+		t.Error("deck not stored")
+	}
+}
+
+func TestReturnPositions(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	drawn, _, err := wp.DrawCards(deckId, 6)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	order := func() []string {
+		t.Helper()
+		state, err := wp.DeckState(deckId, true)
+		if err != nil {
+			t.Fatalf("DeckState: %v", err)
+		}
+		return state.Cards
+	}
+
+	if _, err := wp.ReturnSpecificDrawn(deckId, drawn[0], PositionBottom); err != nil {
+		t.Fatalf("return bottom: %v", err)
+	}
+	if cards := order(); cards[len(cards)-1] != drawn[0] {
+		t.Errorf("bottom card = %s, want %s", cards[len(cards)-1], drawn[0])
+	}
+	if _, err := wp.ReturnSpecificDrawn(deckId, drawn[1], Position(3)); err != nil {
+		t.Fatalf("return at 3: %v", err)
+	}
+	if cards := order(); cards[3] != drawn[1] {
+		t.Errorf("card at 3 = %s, want %s", cards[3], drawn[1])
+	}
+	if _, err := wp.ReturnSpecificDrawn(deckId, drawn[2], Position(1000)); err != nil {
+		t.Fatalf("return past the bottom: %v", err)
+	}
+	if cards := order(); cards[len(cards)-1] != drawn[2] {
+		t.Errorf("out of range index should insert at the bottom, got %s", cards[len(cards)-1])
+	}
+	if _, err := wp.ReturnSpecificDrawn(deckId, drawn[3], PositionRandom); err != nil {
+		t.Fatalf("return random: %v", err)
+	}
+
+	// Les cartes remises ensemble gardent leur ordre
+	if _, err := wp.InsertIntoPile("discard", deckId, drawn[4:]); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+	pile, _, _ := wp.GetPileCards(deckId, "discard")
+	if err := wp.ReturnAllFromPile(deckId, "discard", Position(2)); err != nil {
+		t.Fatalf("ReturnAllFromPile: %v", err)
+	}
+	cards := order()
+	if !slices.Equal(cards[2:4], pile) {
+		t.Errorf("cards at 2..3 = %v, want pile order %v", cards[2:4], pile)
+	}
+
+	state, err := wp.DeckState(deckId, false)
+	if err != nil {
+		t.Fatalf("DeckState: %v", err)
+	}
+	if state.Remaining != 52 || state.Drawn != 0 || state.Piles["discard"] != 0 {
+		t.Errorf("state after returns = %+v", state)
+	}
+	sorted := slices.Clone(cards)
+	slices.Sort(sorted)
+	if len(slices.Compact(sorted)) != 52 {
+		t.Errorf("deck has duplicate or missing cards: %v", cards)
+	}
+}
+
+func TestMovePileCards(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	drawn, _, err := wp.DrawCards(deckId, 5)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+	hand, _, _ := wp.GetPileCards(deckId, "hand")
+	entriesBefore, _ := wp.DeckState(deckId, false)
+
+	moved, err := wp.MovePileCards(deckId, "hand", "discard", []string{hand[2]}, 0, false)
+	if err != nil || !slices.Equal(moved, hand[2:3]) {
+		t.Fatalf("move specific = %v, %v", moved, err)
+	}
+	moved, err = wp.MovePileCards(deckId, "hand", "discard", nil, 2, true)
+	if err != nil || !slices.Equal(moved, []string{hand[4], hand[3]}) {
+		t.Fatalf("move from bottom = %v, %v", moved, err)
+	}
+
+	gotHand, _, _ := wp.GetPileCards(deckId, "hand")
+	discard, _, _ := wp.GetPileCards(deckId, "discard")
+	if !slices.Equal(gotHand, hand[:2]) {
+		t.Errorf("hand = %v, want %v", gotHand, hand[:2])
+	}
+	// Chaque carte deplacee est posee sur le dessus de la destination
+	if !slices.Equal(discard, []string{hand[3], hand[4], hand[2]}) {
+		t.Errorf("discard = %v", discard)
+	}
+
+	after, _ := wp.DeckState(deckId, false)
+	for code, e := range entriesBefore.Entries {
+		if after.Entries[code] != e {
+			t.Errorf("DeckEntry %s changed: %+v -> %+v", code, e, after.Entries[code])
+		}
+	}
+
+	// Une carte absente annule tout le deplacement
+	if _, err := wp.MovePileCards(deckId, "hand", "discard", []string{hand[0], hand[2]}, 0, false); !errors.Is(err, ErrCardNotInPile) {
+		t.Errorf("move missing card error = %v", err)
+	}
+	if gotHand, _, _ := wp.GetPileCards(deckId, "hand"); !slices.Equal(gotHand, hand[:2]) {
+		t.Errorf("failed move changed the hand: %v", gotHand)
+	}
+	if _, err := wp.MovePileCards(deckId, "hand", "hand", nil, 1, false); !errors.Is(err, ErrSamePile) {
+		t.Errorf("same pile error = %v", err)
+	}
+	if _, err := wp.MovePileCards(deckId, "nope", "hand", nil, 1, false); !errors.Is(err, ErrPileNotFound) {
+		t.Errorf("missing pile error = %v", err)
+	}
+}
+
+func TestDeal(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	top, _, _ := wp.PeekDeck(deckId, 6)
+
+	dealt, remaining, err := wp.Deal(deckId, []string{"p1", "p2"}, 3, "roundrobin")
+	if err != nil {
+		t.Fatalf("Deal roundrobin: %v", err)
+	}
+	if remaining != 46 {
+		t.Errorf("remaining = %d, want 46", remaining)
+	}
+	if !slices.Equal(dealt["p1"], []string{top[0], top[2], top[4]}) || !slices.Equal(dealt["p2"], []string{top[1], top[3], top[5]}) {
+		t.Errorf("roundrobin dealt %v from %v", dealt, top)
+	}
+
+	top, _, _ = wp.PeekDeck(deckId, 4)
+	dealt, _, err = wp.Deal(deckId, []string{"p1", "p3"}, 2, "block")
+	if err != nil {
+		t.Fatalf("Deal block: %v", err)
+	}
+	if !slices.Equal(dealt["p1"], top[:2]) || !slices.Equal(dealt["p3"], top[2:]) {
+		t.Errorf("block dealt %v from %v", dealt, top)
+	}
+
+	state, _ := wp.DeckState(deckId, false)
+	if state.Piles["p1"] != 5 || state.Piles["p2"] != 3 || state.Piles["p3"] != 2 || state.Drawn != 0 {
+		t.Errorf("state after deal = %+v", state)
+	}
+
+	if _, _, err := wp.Deal(deckId, []string{"p1", "p2"}, 30, "roundrobin"); !errors.Is(err, ErrNotEnoughCards) {
+		t.Errorf("deal too many error = %v", err)
+	}
+	if after, _ := wp.DeckState(deckId, false); after.Remaining != state.Remaining {
+		t.Errorf("failed deal drew cards: %d -> %d", state.Remaining, after.Remaining)
+	}
+	if _, _, err := wp.Deal(deckId, []string{"p1"}, 1, "shuffled"); !errors.Is(err, ErrInvalidMethod) {
+		t.Errorf("invalid mode error = %v", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	top, _, _ := wp.PeekDeck(deckId, 3)
+
+	results, remaining, err := wp.Batch(deckId, []BatchOp{
+		{Op: "draw", Count: 3, Method: "top"},
+		{Op: "addToPile", Pile: "hand", Cards: top},
+		{Op: "drawPile", Pile: "hand", Count: 1, Method: "bottom"},
+		{Op: "return", Position: PositionBottom},
+		{Op: "shuffle", Pile: "hand"},
+	})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+	if len(results) != 5 || !slices.Equal(results[0].Cards, top) || !slices.Equal(results[2].Cards, top[:1]) {
+		t.Errorf("results = %+v", results)
+	}
+	if remaining != 50 {
+		t.Errorf("remaining = %d, want 50", remaining)
+	}
+	before, _ := wp.DeckState(deckId, true)
+	if before.Cards[len(before.Cards)-1] != top[0] || before.Piles["hand"] != 2 || before.Drawn != 0 {
+		t.Errorf("state after batch = %+v", before)
+	}
+
+	// La troisieme operation echoue: les deux premieres sont annulees
+	_, _, err = wp.Batch(deckId, []BatchOp{
+		{Op: "draw", Count: 5, Method: "top"},
+		{Op: "shuffle"},
+		{Op: "drawPile", Pile: "missing", Count: 1},
+	})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 2 || !errors.Is(err, ErrPileNotFound) {
+		t.Fatalf("Batch error = %v, want BatchError at 2 wrapping ErrPileNotFound", err)
+	}
+	after, _ := wp.DeckState(deckId, true)
+	if !slices.Equal(after.Cards, before.Cards) || after.Piles["hand"] != 2 {
+		t.Errorf("failed batch was not rolled back")
+	}
+}
+
+func TestManyVariants_AllOrNothing(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	drawn, _, err := wp.DrawCards(deckId, 6)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn[:4]); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+	snapshot := func() DeckState {
+		t.Helper()
+		state, err := wp.DeckState(deckId, true)
+		if err != nil {
+			t.Fatalf("DeckState: %v", err)
+		}
+		return *state
+	}
+	before := snapshot()
+
+	// La derniere carte n'est pas dans la pile: rien ne doit etre tire
+	err = wp.DrawSpecificFromPileMany(deckId, "hand", []string{drawn[0], drawn[1], drawn[5]})
+	if !errors.Is(err, ErrCardNotInPile) {
+		t.Fatalf("DrawSpecificFromPileMany err = %v, want ErrCardNotInPile", err)
+	}
+	// Une carte demandee deux fois alors qu'un seul exemplaire est dans la pile
+	err = wp.ReturnSpecificFromPileMany(deckId, "hand", []string{drawn[0], drawn[0]}, PositionTop)
+	if !errors.Is(err, ErrCardNotInPile) {
+		t.Fatalf("ReturnSpecificFromPileMany err = %v, want ErrCardNotInPile", err)
+	}
+	// drawn[0] est dans une pile, pas seulement tiree
+	err = wp.ReturnSpecificDrawnMany(deckId, []string{drawn[4], drawn[0]}, PositionTop)
+	if !errors.Is(err, ErrCardNotDrawn) {
+		t.Fatalf("ReturnSpecificDrawnMany err = %v, want ErrCardNotDrawn", err)
+	}
+	if after := snapshot(); !slices.Equal(after.Cards, before.Cards) || after.Piles["hand"] != 4 || after.Drawn != before.Drawn {
+		t.Fatalf("failed calls modified the deck: before %+v, after %+v", before, after)
+	}
+
+	// Les cartes remises ensemble gardent l'ordre donne
+	if err := wp.ReturnSpecificDrawnMany(deckId, drawn[4:], PositionTop); err != nil {
+		t.Fatalf("ReturnSpecificDrawnMany: %v", err)
+	}
+	if cards := snapshot().Cards; !slices.Equal(cards[:2], drawn[4:]) {
+		t.Errorf("top cards = %v, want %v", cards[:2], drawn[4:])
+	}
+
+	got, err := wp.DrawFromPileN(deckId, "hand", "top", 10)
+	if err != nil {
+		t.Fatalf("DrawFromPileN: %v", err)
+	}
+	if len(got) != 4 {
+		t.Errorf("DrawFromPileN drew %d cards, want the 4 in the pile", len(got))
+	}
+	if _, err := wp.DrawFromPileN(deckId, "hand", "top", 1); !errors.Is(err, ErrPileEmpty) {
+		t.Errorf("DrawFromPileN on empty pile err = %v, want ErrPileEmpty", err)
+	}
+}
+
+func TestEvents_PublishedAfterCommit(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	events, cancel := wp.Subscribe(deckId)
+	defer cancel()
+
+	drawn, _, err := wp.DrawCards(deckId, 2)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	inDeck, _, err := wp.PeekDeck(deckId, 1)
+	if err != nil {
+		t.Fatalf("PeekDeck: %v", err)
+	}
+	// Echec apres une premiere modification: la transaction est annulee, rien n'est publie
+	if _, err := wp.InsertIntoPile("hand", deckId, []string{drawn[0], inDeck[0]}); err == nil {
+		t.Fatal("InsertIntoPile with a card still in the deck succeeded")
+	}
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+	if _, err := wp.ShufflePile(deckId, "hand"); err != nil {
+		t.Fatalf("ShufflePile: %v", err)
+	}
+	if _, err := wp.DeletePile(deckId, "hand"); err != nil {
+		t.Fatalf("DeletePile: %v", err)
+	}
+
+	want := []string{EventDrawn, EventPileAdded, EventShuffled, EventPileDeleted}
+	var got []Event
+	for range want {
+		select {
+		case ev := <-events:
+			got = append(got, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d events, want %d", len(got), len(want))
+		}
+	}
+	for i, ev := range got {
+		if ev.Type != want[i] {
+			t.Errorf("event %d type = %s, want %s", i, ev.Type, want[i])
+		}
+	}
+	if !slices.Equal(got[0].Cards, drawn) || got[1].Pile != "hand" {
+		t.Errorf("events = %+v, want drawn %v then added to hand", got, drawn)
+	}
+
+	// La sequence persistee permet de reprendre apres le premier evenement
+	replay, err := wp.Events(deckId, got[0].Id, 10)
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+	if len(replay) != len(want)-1 || replay[0].Id != got[1].Id || !slices.Equal(replay[0].Cards, got[1].Cards) {
+		t.Errorf("Events after %d = %+v, want %+v", got[0].Id, replay, got[1:])
+	}
+	if page, err := wp.Events(deckId, got[0].Id, 1); err != nil || len(page) != 1 || page[0].Id != got[1].Id {
+		t.Errorf("Events limited to 1 = %+v, %v; want event %d", page, err, got[1].Id)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	snapshot := func() DeckState {
+		t.Helper()
+		state, err := wp.DeckState(deckId, true)
+		if err != nil {
+			t.Fatalf("DeckState: %v", err)
+		}
+		state.LastEvent = 0
+		return *state
+	}
+	same := func(a, b DeckState) bool {
+		return slices.Equal(a.Cards, b.Cards) && a.Drawn == b.Drawn && a.Shuffled == b.Shuffled &&
+			len(a.Piles) == len(b.Piles) && a.Piles["hand"] == b.Piles["hand"] && a.Entries["AS"] == b.Entries["AS"]
+	}
+
+	states := []DeckState{snapshot()}
+	drawn, _, err := wp.DrawCards(deckId, 3)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	states = append(states, snapshot())
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn[:2]); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+	states = append(states, snapshot())
+	if _, err := wp.ShuffleDeckSeeded(deckId, 7); err != nil {
+		t.Fatalf("ShuffleDeckSeeded: %v", err)
+	}
+	states = append(states, snapshot())
+	if err := wp.ReturnSpecificDrawnMany(deckId, drawn[2:], PositionRandom); err != nil {
+		t.Fatalf("ReturnSpecificDrawnMany: %v", err)
+	}
+	states = append(states, snapshot())
+	if _, err := wp.DrawFromPile(deckId, "hand", "bottom"); err != nil {
+		t.Fatalf("DrawFromPile: %v", err)
+	}
+	states = append(states, snapshot())
+	if _, err := wp.DeletePile(deckId, "hand"); err != nil {
+		t.Fatalf("DeletePile: %v", err)
+	}
+	states = append(states, snapshot())
+
+	// Chaque annulation revient a l'etat precedent, melange compris
+	for i := len(states) - 2; i >= 0; i-- {
+		if _, err := wp.Undo(deckId); err != nil {
+			t.Fatalf("Undo: %v", err)
+		}
+		if got := snapshot(); !same(got, states[i]) {
+			t.Fatalf("after undo state = %+v, want %+v", got, states[i])
+		}
+	}
+	if _, err := wp.Undo(deckId); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("Undo with empty history err = %v, want ErrNothingToUndo", err)
+	}
+
+	for i := 1; i < len(states); i++ {
+		op, err := wp.Redo(deckId)
+		if err != nil {
+			t.Fatalf("Redo: %v", err)
+		}
+		if got := snapshot(); !same(got, states[i]) {
+			t.Fatalf("after redo of %s state = %+v, want %+v", op, got, states[i])
+		}
+	}
+
+	// Une nouvelle operation apres une annulation efface les retablissements possibles
+	if _, err := wp.Undo(deckId); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if err := wp.ReturnAllFromPile(deckId, "hand", PositionTop); err != nil {
+		t.Fatalf("ReturnAllFromPile: %v", err)
+	}
+	if _, err := wp.Redo(deckId); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Redo after a new operation err = %v, want ErrNothingToRedo", err)
+	}
+	if _, _, err := wp.DrawCards(deckId, 1); err != nil {
+		t.Errorf("DrawCards on a restored deck: %v", err)
+	}
+}
+
+func TestActionLog_Replay(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	current := func() GameState {
+		t.Helper()
+		cards, err := deckChain(handler.db, deckId)
+		if err != nil {
+			t.Fatalf("deckChain: %v", err)
+		}
+		piles, err := listPiles(handler.db, deckId)
+		if err != nil {
+			t.Fatalf("listPiles: %v", err)
+		}
+		state := GameState{Cards: chainCodes(cards), Piles: map[string][]string{}}
+		for name := range piles {
+			pileId, _ := pileID(handler.db, deckId, name)
+			chain, err := pileChain(handler.db, pileId)
+			if err != nil {
+				t.Fatalf("pileChain: %v", err)
+			}
+			state.Piles[name] = chainCodes(chain)
+		}
+		return state
+	}
+	check := func(got *GameState, want GameState) {
+		t.Helper()
+		if !slices.Equal(got.Cards, want.Cards) || len(got.Piles) != len(want.Piles) {
+			t.Fatalf("replay = %v %v, want %v %v", got.Cards, got.Piles, want.Cards, want.Piles)
+		}
+		for name, cards := range want.Piles {
+			if !slices.Equal(got.Piles[name], cards) {
+				t.Fatalf("replayed pile %s = %v, want %v", name, got.Piles[name], cards)
+			}
+		}
+	}
+
+	drawn, _, err := wp.DrawCardsFrom(deckId, "random", 6)
+	if err != nil {
+		t.Fatalf("DrawCardsFrom: %v", err)
+	}
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn[:4]); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+	if err := wp.ReturnSpecificDrawnMany(deckId, drawn[4:], PositionRandom); err != nil {
+		t.Fatalf("ReturnSpecificDrawnMany: %v", err)
+	}
+	if _, err := wp.ShufflePile(deckId, "hand"); err != nil {
+		t.Fatalf("ShufflePile: %v", err)
+	}
+	middle := current()
+	log, err := wp.ActionLog(deckId, 0, 100)
+	if err != nil {
+		t.Fatalf("ActionLog: %v", err)
+	}
+	middleId := log[len(log)-1].Id
+
+	if _, err := wp.MovePileCards(deckId, "hand", "table", nil, 2, true); err != nil {
+		t.Fatalf("MovePileCards: %v", err)
+	}
+	if _, _, err := wp.Deal(deckId, []string{"p1", "p2"}, 2, "roundrobin"); err != nil {
+		t.Fatalf("Deal: %v", err)
+	}
+	if _, err := wp.ShuffleDeckSeeded(deckId, 3); err != nil {
+		t.Fatalf("ShuffleDeckSeeded: %v", err)
+	}
+	if err := wp.ReturnAllFromPile(deckId, "p1", PositionRandom); err != nil {
+		t.Fatalf("ReturnAllFromPile: %v", err)
+	}
+	if _, err := wp.DeletePile(deckId, "p2"); err != nil {
+		t.Fatalf("DeletePile: %v", err)
+	}
+	if _, err := wp.Undo(deckId); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if _, _, err := wp.BatchAs(deckId, "alice", []BatchOp{{Op: "drawPile", Pile: "table", Count: 1, Method: "random"}}); err != nil {
+		t.Fatalf("BatchAs: %v", err)
+	}
+
+	state, err := wp.Replay(deckId, 0)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	check(state, current())
+	state, err = wp.Replay(deckId, middleId)
+	if err != nil {
+		t.Fatalf("Replay(%d): %v", middleId, err)
+	}
+	check(state, middle)
+
+	log, err = wp.ActionLog(deckId, middleId, 100)
+	if err != nil {
+		t.Fatalf("ActionLog: %v", err)
+	}
+	if last := log[len(log)-1]; last.Action != ActionPileDraw || last.Actor != "alice" || last.Pile != "table" {
+		t.Errorf("last action = %+v, want a pile_draw on table by alice", last)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	handler, wp, _ := setupConcurrencyTestDB(t)
+	defer handler.db.Close()
+	defer wp.Close()
+
+	deckId := createConcurrencyTestDeck(t, wp)
+	if _, err := wp.ShuffleDeckSeeded(deckId, 11); err != nil {
+		t.Fatalf("ShuffleDeckSeeded: %v", err)
+	}
+	drawn, _, err := wp.DrawCards(deckId, 5)
+	if err != nil {
+		t.Fatalf("DrawCards: %v", err)
+	}
+	if _, err := wp.InsertIntoPile("hand", deckId, drawn[:3]); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+
+	snap, err := wp.Snapshot(deckId)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	forkId, err := wp.RestoreSnapshot(snap)
+	if err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	if forkId == deckId {
+		t.Fatalf("RestoreSnapshot reused deck id %s", deckId)
+	}
+
+	fork, err := wp.Snapshot(forkId)
+	if err != nil {
+		t.Fatalf("Snapshot(fork): %v", err)
+	}
+	if !slices.Equal(fork.Cards, snap.Cards) || !slices.Equal(fork.Piles["hand"], snap.Piles["hand"]) ||
+		fork.ShuffleCount != snap.ShuffleCount || *fork.Seed != 11 || len(fork.Entries) != len(snap.Entries) {
+		t.Fatalf("fork = %+v, want %+v", fork, snap)
+	}
+	for code, entry := range snap.Entries {
+		if fork.Entries[code] != entry {
+			t.Errorf("fork entry %s = %+v, want %+v", code, fork.Entries[code], entry)
+		}
+	}
+	if state, err := wp.DeckState(forkId, false); err != nil || state.Drawn != 2 {
+		t.Errorf("fork DeckState = %+v, %v; want 2 drawn cards", state, err)
+	}
+
+	// Le deck d'origine et la copie evoluent separement
+	if _, _, err := wp.DrawCards(forkId, 1); err != nil {
+		t.Fatalf("DrawCards(fork): %v", err)
+	}
+	if n, _ := wp.CardsInDeck(deckId); int(n) != len(snap.Cards) {
+		t.Errorf("original deck has %d cards after drawing from the fork, want %d", n, len(snap.Cards))
+	}
+
+	snap.Entries[drawn[0]] = SnapshotEntry{Total: 1, InDeck: 1}
+	if _, err := wp.RestoreSnapshot(snap); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("RestoreSnapshot with inconsistent entries = %v, want ErrInvalidSnapshot", err)
+	}
+}
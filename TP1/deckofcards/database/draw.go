@@ -0,0 +1,152 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// drawResult cartes tirees de la pioche et nombre de cartes restantes
+type drawResult struct {
+	codes     []string
+	remaining int
+}
+
+// DrawCardsFrom Pige jusqu'a count cartes du dessus ("top"), du dessous ("bottom") ou au
+// hasard ("random") de la pioche et retourne les codes et le nombre de cartes restantes
+func (w *WorkerPool) DrawCardsFrom(deckId, method string, count int) ([]string, int, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "draw"); err != nil {
+			return nil, err
+		}
+		return w.drawCardsTx(tx, deckId, method, count)
+	})
+	if resp.Err != nil {
+		return nil, 0, resp.Err
+	}
+	res := resp.Data.(drawResult)
+	return res.codes, res.remaining, nil
+}
+
+// drawCardsTx tire jusqu'a count cartes de la pioche selon method
+func (w *WorkerPool) drawCardsTx(q querier, deckId, method string, count int) (drawResult, error) {
+	var pick func(cards []chainCard) int
+	switch method {
+	case "top":
+		return w.drawTopTx(q, deckId, count)
+	case "bottom":
+		pick = func(cards []chainCard) int { return len(cards) - 1 }
+	case "random":
+		shuffler, err := w.deckShuffler(q, deckId)
+		if err != nil {
+			return drawResult{}, err
+		}
+		pick = func(cards []chainCard) int { return shuffler.Intn(len(cards)) }
+	default:
+		return drawResult{}, fmt.Errorf("%q: %w", method, ErrInvalidMethod)
+	}
+
+	cards, err := deckChain(q, deckId)
+	if err != nil {
+		return drawResult{}, err
+	}
+	codes := []string{}
+	var positions []int
+	for len(codes) < count && len(cards) > 0 {
+		i := pick(cards)
+		codes = append(codes, cards[i].code)
+		positions = append(positions, i)
+		if cards, err = unlinkDeckCard(q, deckId, cards, i); err != nil {
+			return drawResult{}, err
+		}
+	}
+	if err := w.logAction(q, deckId, Action{Action: ActionDraw, Cards: codes, Positions: positions}); err != nil {
+		return drawResult{}, err
+	}
+	if err := w.emit(q, deckId, EventDrawn, "", codes); err != nil {
+		return drawResult{}, err
+	}
+	return drawResult{codes: codes, remaining: len(cards)}, nil
+}
+
+// drawTopTx tire jusqu'a count cartes du dessus en suivant topCardId puis nextId,
+// sans lire le reste de la pioche
+func (w *WorkerPool) drawTopTx(q querier, deckId string, count int) (drawResult, error) {
+	codes := []string{}
+	var positions []int
+	for len(codes) < count {
+		var id int64
+		var code string
+		var next sql.NullInt64
+		err := q.QueryRow(`SELECT DeckCard.id, DeckCard.code, DeckCard.nextId FROM DeckCard INNER JOIN Deck ON DeckCard.id = Deck.topCardId WHERE Deck.deckId = ?`, deckId).
+			Scan(&id, &code, &next)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return drawResult{}, fmt.Errorf("echec de lecture de la carte du dessus: %w", err)
+		}
+		top := []chainCard{{id: id, code: code}}
+		if next.Valid {
+			top = append(top, chainCard{id: next.Int64})
+		}
+		if _, err := unlinkDeckCard(q, deckId, top, 0); err != nil {
+			return drawResult{}, err
+		}
+		codes = append(codes, code)
+		positions = append(positions, 0)
+	}
+
+	var remaining int
+	if err := q.QueryRow(`SELECT COALESCE(SUM(inDeck), 0) FROM DeckEntry WHERE deckId = ?`, deckId).Scan(&remaining); err != nil {
+		return drawResult{}, fmt.Errorf("echec de lecture de DeckEntry: %w", err)
+	}
+	if err := w.logAction(q, deckId, Action{Action: ActionDraw, Cards: codes, Positions: positions}); err != nil {
+		return drawResult{}, err
+	}
+	if err := w.emit(q, deckId, EventDrawn, "", codes); err != nil {
+		return drawResult{}, err
+	}
+	return drawResult{codes: codes, remaining: remaining}, nil
+}
+
+// DrawSpecificFromDeck Pige les cartes de codes donnes ou qu'elles soient dans la pioche
+// Aucune carte n'est tiree si l'une d'elles n'est pas dans la pioche
+func (w *WorkerPool) DrawSpecificFromDeck(deckId string, codes []string) ([]string, int, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "draw"); err != nil {
+			return nil, err
+		}
+		return w.drawSpecificFromDeckTx(tx, deckId, codes)
+	})
+	if resp.Err != nil {
+		return nil, 0, resp.Err
+	}
+	res := resp.Data.(drawResult)
+	return res.codes, res.remaining, nil
+}
+
+// drawSpecificFromDeckTx tire les cartes de codes donnes de la pioche
+func (w *WorkerPool) drawSpecificFromDeckTx(q querier, deckId string, codes []string) (drawResult, error) {
+	cards, err := deckChain(q, deckId)
+	if err != nil {
+		return drawResult{}, err
+	}
+	positions := make([]int, len(codes))
+	for k, code := range codes {
+		i := chainIndex(cards, code)
+		if i < 0 {
+			return drawResult{}, fmt.Errorf("carte %s: %w", code, ErrCardNotInDeck)
+		}
+		positions[k] = i
+		if cards, err = unlinkDeckCard(q, deckId, cards, i); err != nil {
+			return drawResult{}, err
+		}
+	}
+	if err := w.logAction(q, deckId, Action{Action: ActionDraw, Cards: codes, Positions: positions}); err != nil {
+		return drawResult{}, err
+	}
+	if err := w.emit(q, deckId, EventDrawn, "", codes); err != nil {
+		return drawResult{}, err
+	}
+	return drawResult{codes: codes, remaining: len(cards)}, nil
+}
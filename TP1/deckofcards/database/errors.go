@@ -0,0 +1,28 @@
+package database
+
+import "errors"
+
+// Erreurs retournees par les operations du WorkerPool, enveloppees avec %w
+// et a comparer avec errors.Is
+var (
+	ErrDeckNotFound = errors.New("deck not found")
+	ErrDeckExpired  = errors.New("deck expired")
+
+	ErrPileNotFound = errors.New("pile not found")
+	ErrPileEmpty    = errors.New("pile is empty")
+	ErrSamePile     = errors.New("source and destination piles are the same")
+
+	ErrCardNotInDeck = errors.New("card not found in deck")
+	ErrCardNotInPile = errors.New("card not found in pile")
+	ErrCardNotDrawn  = errors.New("card not drawn")
+
+	ErrNotEnoughCards  = errors.New("not enough cards remaining")
+	ErrInvalidMethod   = errors.New("invalid draw method")
+	ErrInvalidPosition = errors.New("invalid return position")
+
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+	ErrLogIncomplete = errors.New("action log incomplete")
+
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+)
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types d'evenements d'un deck
+const (
+	EventDrawn       = "drawn"        //< cartes tirees de la pioche
+	EventShuffled    = "shuffled"     //< pioche, ou pile Pile, melangee
+	EventPileAdded   = "pile_added"   //< cartes posees sur la pile Pile
+	EventPileDrawn   = "pile_drawn"   //< cartes retirees de la pile Pile
+	EventPileDeleted = "pile_deleted" //< pile Pile supprimee, ses cartes deviennent tirees
+	EventReturned    = "returned"     //< cartes remises dans la pioche, depuis la pile Pile si definie
+	EventUndone      = "undone"       //< derniere operation annulee, l'etat du deck doit etre relu
+	EventRedone      = "redone"       //< operation annulee retablie, l'etat du deck doit etre relu
+	EventDeckDeleted = "deck_deleted" //< deck supprime, dernier evenement du flux
+)
+
+// subscriberBuffer nombre d'evenements en attente d'un abonne avant qu'il soit deconnecte
+const subscriberBuffer = 64
+
+// Event modification d'un deck, enregistree dans la meme transaction que la modification
+// Id croit avec chaque evenement, il sert a reprendre un flux interrompu
+type Event struct {
+	Id     int64     `json:"id"`
+	DeckId string    `json:"deck_id"`
+	Type   string    `json:"type"`
+	Pile   string    `json:"pile,omitempty"`
+	Cards  []string  `json:"cards,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// eventBus diffuse les evenements valides aux abonnes de chaque deck
+type eventBus struct {
+	mu     sync.Mutex
+	subs   map[string]map[chan Event]struct{}
+	closed bool
+}
+
+// emit enregistre un evenement dans la transaction q, il sera diffuse apres le commit
+// Doit etre appele depuis une fonction passee a w.transaction
+func (w *WorkerPool) emit(q querier, deckId, typ, pile string, cards []string) error {
+	if !emitted(typ, cards) {
+		return nil
+	}
+	ev := Event{DeckId: deckId, Type: typ, Pile: pile, Cards: cards, At: w.now().UTC()}
+	res, err := q.Exec(`INSERT INTO DeckEvent (deckId, type, pile, cards, createdAt) VALUES (?, ?, ?, ?, ?)`,
+		deckId, typ, pile, strings.Join(cards, ","), ev.At.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("echec d'enregistrement d'evenement: %w", err)
+	}
+	if ev.Id, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("echec de lecture de LastInsertId: %w", err)
+	}
+	// Le verrou d'ecriture est tenu pendant toute la transaction
+	w.pending = append(w.pending, ev)
+	return nil
+}
+
+// emitted indique si un evenement est emis: sans carte, seuls les melanges, suppressions
+// de pile ou de deck, annulations et retablissements en produisent un
+func emitted(typ string, cards []string) bool {
+	switch typ {
+	case EventShuffled, EventPileDeleted, EventUndone, EventRedone, EventDeckDeleted:
+		return true
+	}
+	return len(cards) > 0
+}
+
+// Events retourne au plus limit evenements d'un deck d'id superieur a afterId, du plus
+// ancien au plus recent. Un long historique se lit par pages en reprenant apres le dernier id
+func (w *WorkerPool) Events(deckId string, afterId int64, limit int) ([]Event, error) {
+	resp := w.read(func(q querier) (interface{}, error) {
+		if err := w.checkDeck(q, deckId); err != nil {
+			return nil, err
+		}
+		rows, err := q.Query(`
+			SELECT id, type, pile, cards, createdAt FROM DeckEvent
+			WHERE deckId = ? AND id > ? ORDER BY id LIMIT ?`, deckId, afterId, limit)
+		if err != nil {
+			return nil, fmt.Errorf("echec de lecture des evenements: %w", err)
+		}
+		defer rows.Close()
+
+		events := []Event{}
+		for rows.Next() {
+			ev := Event{DeckId: deckId}
+			var cards string
+			var at int64
+			if err := rows.Scan(&ev.Id, &ev.Type, &ev.Pile, &cards, &at); err != nil {
+				return nil, fmt.Errorf("echec de lecture de resultat de requete: %w", err)
+			}
+			if cards != "" {
+				ev.Cards = strings.Split(cards, ",")
+			}
+			ev.At = time.UnixMilli(at).UTC()
+			events = append(events, ev)
+		}
+		return events, rows.Err()
+	})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.Data.([]Event), nil
+}
+
+// Subscribe abonne aux evenements valides d'un deck a partir de maintenant
+// Le canal est ferme par cancel, par CloseSubscriptions, apres EventDeckDeleted, ou si
+// l'abonne prend trop de retard: il doit alors reprendre depuis le dernier id recu avec Events
+func (w *WorkerPool) Subscribe(deckId string) (<-chan Event, func()) {
+	return w.bus.subscribe(deckId)
+}
+
+// CloseSubscriptions ferme les abonnements en cours et refuse les suivants, pour
+// que les flux d'evenements se terminent a l'arret du serveur
+func (w *WorkerPool) CloseSubscriptions() {
+	w.bus.close()
+}
+
+// subscribe abonne aux evenements d'un deck, le canal est ferme par cancel ou par close
+func (b *eventBus) subscribe(deckId string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subs == nil {
+		b.subs = make(map[string]map[chan Event]struct{})
+	}
+	if b.subs[deckId] == nil {
+		b.subs[deckId] = make(map[chan Event]struct{})
+	}
+	b.subs[deckId][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(deckId, ch)
+	}
+}
+
+// close ferme les abonnements en cours et refuse les suivants
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for deckId, subs := range b.subs {
+		for ch := range subs {
+			b.remove(deckId, ch)
+		}
+	}
+}
+
+// publish diffuse des evenements valides sans bloquer, un abonne dont le tampon est
+// plein est deconnecte. Apres EventDeckDeleted, les abonnes du deck sont fermes
+func (b *eventBus) publish(events []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ev := range events {
+		for ch := range b.subs[ev.DeckId] {
+			select {
+			case ch <- ev:
+			default:
+				b.remove(ev.DeckId, ch)
+			}
+			if ev.Type == EventDeckDeleted {
+				b.remove(ev.DeckId, ch)
+			}
+		}
+	}
+}
+
+// remove ferme et retire un abonne, b.mu doit etre tenu
+func (b *eventBus) remove(deckId string, ch chan Event) {
+	if _, ok := b.subs[deckId][ch]; !ok {
+		return
+	}
+	delete(b.subs[deckId], ch)
+	if len(b.subs[deckId]) == 0 {
+		delete(b.subs, deckId)
+	}
+	close(ch)
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// querier requetes communes a *sql.DB et *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// checkDeck verifie qu'un deck existe et n'est pas expire, sans ecrire dans la base:
+// elle est aussi appelee sous le seul verrou de lecture
+// Les lectures prolongent le deck en memoire, dans w.touched; le janitor reporte ces
+// acces dans lastAccessedAt sous le verrou d'ecriture avant chaque purge
+func (w *WorkerPool) checkDeck(q querier, deckId string) error {
+	var lastAccessedAt int64
+	err := q.QueryRow(`SELECT lastAccessedAt FROM Deck WHERE deckId = ?`, deckId).Scan(&lastAccessedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("deck %s: %w", deckId, ErrDeckNotFound)
+		}
+		return fmt.Errorf("echec de lecture du deck: %w", err)
+	}
+	if w.ttl <= 0 {
+		return nil
+	}
+	now := w.now()
+	w.touchMu.Lock()
+	defer w.touchMu.Unlock()
+	last := time.Unix(lastAccessedAt, 0)
+	if touched, ok := w.touched[deckId]; ok && touched.After(last) {
+		last = touched
+	}
+	if last.Add(w.ttl).Before(now) {
+		return fmt.Errorf("deck %s: %w", deckId, ErrDeckExpired)
+	}
+	if w.touched == nil {
+		w.touched = make(map[string]time.Time)
+	}
+	w.touched[deckId] = now
+	return nil
+}
+
+// flushTouches ecrit dans lastAccessedAt les acces retenus par checkDeck et les retourne
+// doit etre appele sous le verrou d'ecriture
+func (w *WorkerPool) flushTouches(tx *sql.Tx) (map[string]time.Time, error) {
+	w.touchMu.Lock()
+	touched := w.touched
+	w.touched = nil
+	w.touchMu.Unlock()
+
+	for deckId, at := range touched {
+		if _, err := tx.Exec(`UPDATE Deck SET lastAccessedAt = MAX(lastAccessedAt, ?) WHERE deckId = ?`, at.Unix(), deckId); err != nil {
+			return touched, fmt.Errorf("echec de mise a jour de lastAccessedAt: %w", err)
+		}
+	}
+	return touched, nil
+}
+
+// untouch rend a w.touched des acces dont l'ecriture a ete annulee
+func (w *WorkerPool) untouch(touched map[string]time.Time) {
+	w.touchMu.Lock()
+	defer w.touchMu.Unlock()
+	if w.touched == nil {
+		w.touched = make(map[string]time.Time, len(touched))
+	}
+	for deckId, at := range touched {
+		if at.After(w.touched[deckId]) {
+			w.touched[deckId] = at
+		}
+	}
+}
+
+// TouchDeck Prolonge la duree de vie d'un deck comme une lecture, pour les flux
+// d'evenements et les tables qui l'observent sans le lire
+func (w *WorkerPool) TouchDeck(deckId string) error {
+	resp := w.read(func(q querier) (interface{}, error) {
+		return nil, w.checkDeck(q, deckId)
+	})
+	return resp.Err
+}
+
+// touchDeck verifie un deck comme checkDeck puis met a jour sa date de dernier acces
+// doit etre appele sous le verrou d'ecriture
+func (w *WorkerPool) touchDeck(q querier, deckId string) error {
+	if err := w.checkDeck(q, deckId); err != nil {
+		return err
+	}
+	if _, err := q.Exec(`UPDATE Deck SET lastAccessedAt = ? WHERE deckId = ?`, w.now().Unix(), deckId); err != nil {
+		return fmt.Errorf("echec de mise a jour de lastAccessedAt: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpired supprime au plus limit decks expires, les plus anciens en premier
+// Les acces retenus depuis la purge precedente sont d'abord ecrits dans la base
+// Retourne le nombre de decks supprimes
+func (w *WorkerPool) PurgeExpired(limit int) (int, error) {
+	if w.ttl <= 0 || limit <= 0 {
+		return 0, nil
+	}
+	var touched map[string]time.Time
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		var err error
+		if touched, err = w.flushTouches(tx); err != nil {
+			return nil, err
+		}
+		cutoff := w.now().Add(-w.ttl).Unix()
+		res, err := tx.Exec(`
+			DELETE FROM Deck WHERE deckId IN (
+				SELECT deckId FROM Deck WHERE lastAccessedAt < ? ORDER BY lastAccessedAt LIMIT ?
+			)`, cutoff, limit)
+		if err != nil {
+			return nil, fmt.Errorf("echec de purge des decks expires: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("echec de lecture de RowsAffected: %w", err)
+		}
+		return int(n), nil
+	})
+	if resp.Err != nil {
+		// Les acces non ecrits seront repris a la purge suivante
+		w.untouch(touched)
+		return 0, resp.Err
+	}
+	return resp.Data.(int), nil
+}
+
+// StartJanitor demarre une goroutine qui purge les decks expires toutes les interval,
+// par lots d'au plus batchSize decks, jusqu'a l'annulation de ctx
+// Ne fait rien si aucune duree de vie n'est configuree
+func (w *WorkerPool) StartJanitor(ctx context.Context, interval time.Duration, batchSize int) {
+	if w.ttl <= 0 {
+		return
+	}
+	startJanitor(ctx, interval, batchSize, w.PurgeExpired)
+}
+
+// startJanitor appelle purge toutes les interval jusqu'a l'annulation de ctx, par lots
+// d'au plus batchSize decks tant qu'un lot est plein
+func startJanitor(ctx context.Context, interval time.Duration, batchSize int, purge func(limit int) (int, error)) {
+	if interval <= 0 || batchSize <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// Un lot par transaction pour laisser passer les autres operations entre deux lots
+			for ctx.Err() == nil {
+				n, err := purge(batchSize)
+				if err != nil {
+					if !errors.Is(err, ErrPoolClosed) {
+						log.Printf("purge des decks expires: %v", err)
+					}
+					break
+				}
+				if n < batchSize {
+					break
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,394 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// historyLimit nombre d'operations annulables conservees par deck
+const historyLimit = 50
+
+// historyState etat d'un deck que les actions du journal ne decrivent pas: melanges et
+// noms des piles. Les cartes deplacees sont retrouvees dans les actions de l'operation
+type historyState struct {
+	Shuffled     bool     `json:"shuffled"`
+	Seed         *int64   `json:"seed,omitempty"`
+	ShuffleCount int64    `json:"shuffle_count"`
+	Piles        []string `json:"piles"`
+}
+
+// change prepare une modification annulable d'un deck: le deck est touche comme
+// par touchDeck et une entree est ajoutee a DeckHistory sous le nom op
+// Les actions journalisees ensuite dans la transaction forment l'operation, elles
+// donnent les cartes, positions et piles a reprendre; un melange garde sa permutation
+// Les operations annulees ne peuvent plus etre retablies
+func (w *WorkerPool) change(q querier, deckId, op string) error {
+	if err := w.touchDeck(q, deckId); err != nil {
+		return err
+	}
+	state, err := readHistoryState(q, deckId)
+	if err != nil {
+		return err
+	}
+	if _, err := q.Exec(`DELETE FROM DeckHistory WHERE deckId = ? AND undone = 1`, deckId); err != nil {
+		return fmt.Errorf("echec de mise a jour de l'historique: %w", err)
+	}
+	res, err := q.Exec(`INSERT INTO DeckHistory (deckId, op, undo, createdAt) VALUES (?, ?, ?, ?)`,
+		deckId, op, state, w.now().Unix())
+	if err != nil {
+		return fmt.Errorf("echec d'enregistrement de l'historique: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("echec de lecture de LastInsertId: %w", err)
+	}
+	if w.changes == nil {
+		w.changes = make(map[string]int64)
+	}
+	w.changes[deckId] = id
+	if _, err := q.Exec(`
+		DELETE FROM DeckHistory WHERE deckId = ? AND id <= (
+			SELECT id FROM DeckHistory WHERE deckId = ? ORDER BY id DESC LIMIT 1 OFFSET ?)`,
+		deckId, deckId, historyLimit); err != nil {
+		return fmt.Errorf("echec de mise a jour de l'historique: %w", err)
+	}
+	return nil
+}
+
+// recordChange rattache l'action actionId a l'operation en cours du deck, s'il y en a une
+func (w *WorkerPool) recordChange(q querier, deckId string, actionId int64) error {
+	id, ok := w.changes[deckId]
+	if !ok {
+		return nil
+	}
+	if _, err := q.Exec(`UPDATE DeckHistory SET firstAction = COALESCE(firstAction, ?), lastAction = ? WHERE id = ?`,
+		actionId, actionId, id); err != nil {
+		return fmt.Errorf("echec de mise a jour de l'historique: %w", err)
+	}
+	return nil
+}
+
+// Undo Annule la derniere operation non annulee d'un deck et retourne son nom
+func (w *WorkerPool) Undo(deckId string) (string, error) {
+	return w.travel(deckId, true)
+}
+
+// Redo Retablit la derniere operation annulee d'un deck et retourne son nom
+func (w *WorkerPool) Redo(deckId string) (string, error) {
+	return w.travel(deckId, false)
+}
+
+// travel annule (undo) une operation en appliquant l'inverse de ses actions, de la
+// derniere a la premiere, ou la retablit en rejouant ses actions. L'etat des melanges
+// courant est garde pour l'operation inverse
+func (w *WorkerPool) travel(deckId string, undo bool) (string, error) {
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.touchDeck(tx, deckId); err != nil {
+			return nil, err
+		}
+
+		var id int64
+		var op string
+		var state sql.NullString
+		var first, last sql.NullInt64
+		var err error
+		if undo {
+			err = tx.QueryRow(`
+				SELECT id, op, undo, firstAction, lastAction FROM DeckHistory
+				WHERE deckId = ? AND undone = 0 ORDER BY id DESC LIMIT 1`, deckId).Scan(&id, &op, &state, &first, &last)
+		} else {
+			err = tx.QueryRow(`
+				SELECT id, op, redo, firstAction, lastAction FROM DeckHistory
+				WHERE deckId = ? AND undone = 1 ORDER BY id LIMIT 1`, deckId).Scan(&id, &op, &state, &first, &last)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			if undo {
+				return nil, fmt.Errorf("deck %s: %w", deckId, ErrNothingToUndo)
+			}
+			return nil, fmt.Errorf("deck %s: %w", deckId, ErrNothingToRedo)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("echec de lecture de l'historique: %w", err)
+		}
+
+		var target historyState
+		if err := json.Unmarshal([]byte(state.String), &target); err != nil {
+			return nil, fmt.Errorf("historique %d illisible: %w", id, err)
+		}
+		current, err := readHistoryState(tx, deckId)
+		if err != nil {
+			return nil, err
+		}
+		actions := []Action{}
+		if first.Valid {
+			if actions, err = readActions(tx, deckId, `id BETWEEN ? AND ? ORDER BY id`, first.Int64, last.Int64); err != nil {
+				return nil, err
+			}
+		}
+		if undo {
+			for i := len(actions) - 1; i >= 0; i-- {
+				for _, a := range inverseActions(actions[i]) {
+					if err := w.applyAction(tx, deckId, a); err != nil {
+						return nil, fmt.Errorf("historique %d: %w", id, err)
+					}
+				}
+			}
+		} else {
+			for _, a := range actions {
+				if err := w.applyAction(tx, deckId, a); err != nil {
+					return nil, fmt.Errorf("historique %d: %w", id, err)
+				}
+			}
+		}
+		if err := w.restoreHistoryState(tx, deckId, &target); err != nil {
+			return nil, err
+		}
+
+		event := EventRedone
+		query := `UPDATE DeckHistory SET undone = 0, undo = ? WHERE id = ?`
+		if undo {
+			event = EventUndone
+			query = `UPDATE DeckHistory SET undone = 1, redo = ? WHERE id = ?`
+		}
+		if _, err := tx.Exec(query, current, id); err != nil {
+			return nil, fmt.Errorf("echec de mise a jour de l'historique: %w", err)
+		}
+		return op, w.emit(tx, deckId, event, "", nil)
+	})
+	if resp.Err != nil {
+		return "", resp.Err
+	}
+	return resp.Data.(string), nil
+}
+
+// readHistoryState lit l'etat des melanges et les piles d'un deck, encode en json
+func readHistoryState(q querier, deckId string) (string, error) {
+	var state historyState
+	err := q.QueryRow(`SELECT shuffled, seed, shuffleCount FROM Deck WHERE deckId = ?`, deckId).
+		Scan(&state.Shuffled, &state.Seed, &state.ShuffleCount)
+	if err != nil {
+		return "", fmt.Errorf("echec de lecture du deck: %w", err)
+	}
+	piles, err := listPiles(q, deckId)
+	if err != nil {
+		return "", err
+	}
+	state.Piles = make([]string, 0, len(piles))
+	for name := range piles {
+		state.Piles = append(state.Piles, name)
+	}
+	slices.Sort(state.Piles)
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// restoreHistoryState remet l'etat des melanges d'un deck et supprime les piles absentes
+// de state, que les actions inverses ont videes
+func (w *WorkerPool) restoreHistoryState(q querier, deckId string, state *historyState) error {
+	if _, err := q.Exec(`UPDATE Deck SET shuffled = ?, seed = ?, shuffleCount = ? WHERE deckId = ?`,
+		state.Shuffled, state.Seed, state.ShuffleCount, deckId); err != nil {
+		return fmt.Errorf("echec de mise a jour du deck: %w", err)
+	}
+	piles, err := listPiles(q, deckId)
+	if err != nil {
+		return err
+	}
+	for name := range piles {
+		if slices.Contains(state.Piles, name) {
+			continue
+		}
+		if err := w.applyAction(q, deckId, Action{Action: ActionPileDelete, Pile: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inverseActions retourne les actions qui annulent a, a appliquer dans l'ordre
+func inverseActions(a Action) []Action {
+	cards := slices.Clone(a.Cards)
+	slices.Reverse(cards)
+	positions := slices.Clone(a.Positions)
+	slices.Reverse(positions)
+
+	switch a.Action {
+	case ActionDraw:
+		return []Action{{Action: ActionReturn, Cards: cards, Positions: positions}}
+
+	case ActionReturn:
+		drawn := Action{Action: ActionDraw, Cards: cards, Positions: positions}
+		if a.Pile == "" {
+			return []Action{drawn}
+		}
+		from := slices.Clone(a.From)
+		slices.Reverse(from)
+		return []Action{drawn, {Action: ActionPileInsert, Pile: a.Pile, Cards: cards, Positions: from}}
+
+	case ActionPileInsert:
+		if positions == nil {
+			positions = make([]int, len(cards))
+		}
+		return []Action{{Action: ActionPileDraw, Pile: a.Pile, Cards: cards, Positions: positions}}
+
+	case ActionPileDraw, ActionPileDelete:
+		return []Action{{Action: ActionPileInsert, Pile: a.Pile, Cards: cards, Positions: positions}}
+
+	case ActionShuffle:
+		inverse := make([]int, len(a.Permutation))
+		for i, j := range a.Permutation {
+			inverse[j] = i
+		}
+		return []Action{{Action: ActionShuffle, Pile: a.Pile, Permutation: inverse}}
+	}
+	return []Action{a}
+}
+
+// applyAction applique une action du journal a la pioche et aux piles d'un deck, comme
+// replay le fait en memoire, puis la journalise. Les codes de chaque position sont verifies
+func (w *WorkerPool) applyAction(q querier, deckId string, a Action) error {
+	if !wellFormed(a) {
+		return fmt.Errorf("action %s: positions incompletes: %w", a.Action, ErrLogIncomplete)
+	}
+	// at verifie que la carte i de chain porte le code attendu
+	at := func(chain []chainCard, i int, code string) error {
+		if i < 0 || i >= len(chain) || chain[i].code != code {
+			return fmt.Errorf("action %s: carte %s absente de la position %d: %w", a.Action, code, i, ErrLogIncomplete)
+		}
+		return nil
+	}
+
+	switch a.Action {
+	case ActionDraw, ActionReturn:
+		if a.Action == ActionReturn && a.Pile != "" {
+			if err := w.takeFromPile(q, deckId, a.Pile, a.Cards, a.From, false); err != nil {
+				return err
+			}
+		}
+		cards, err := deckChain(q, deckId)
+		if err != nil {
+			return err
+		}
+		for k, code := range a.Cards {
+			if a.Action == ActionDraw {
+				if err := at(cards, a.Positions[k], code); err != nil {
+					return err
+				}
+				cards, err = unlinkDeckCard(q, deckId, cards, a.Positions[k])
+			} else {
+				if a.Positions[k] < 0 || a.Positions[k] > len(cards) {
+					return fmt.Errorf("action %s: position %d hors de la pioche: %w", a.Action, a.Positions[k], ErrLogIncomplete)
+				}
+				cards, err = spliceDeckCard(q, deckId, cards, a.Positions[k], code)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+	case ActionPileInsert:
+		pileId, err := ensurePile(q, deckId, a.Pile)
+		if err != nil {
+			return err
+		}
+		cards, err := pileChain(q, pileId)
+		if err != nil {
+			return err
+		}
+		for k, code := range a.Cards {
+			i := 0
+			if a.Positions != nil {
+				i = a.Positions[k]
+			}
+			if i < 0 || i > len(cards) {
+				return fmt.Errorf("action %s: position %d hors de la pile %s: %w", a.Action, i, a.Pile, ErrLogIncomplete)
+			}
+			if cards, err = splicePileCard(q, deckId, pileId, cards, i, code); err != nil {
+				return err
+			}
+		}
+
+	case ActionPileDraw, ActionPileDelete:
+		if err := w.takeFromPile(q, deckId, a.Pile, a.Cards, a.Positions, a.Action == ActionPileDelete); err != nil {
+			return err
+		}
+
+	case ActionShuffle:
+		var cards []chainCard
+		var err error
+		var pileId int64
+		if a.Pile == "" {
+			cards, err = deckChain(q, deckId)
+		} else if pileId, err = historyPile(q, deckId, a.Pile); err == nil {
+			cards, err = pileChain(q, pileId)
+		}
+		if err != nil {
+			return err
+		}
+		if len(a.Permutation) != len(cards) {
+			return fmt.Errorf("action %s: permutation de %d cartes pour %d: %w", a.Action, len(a.Permutation), len(cards), ErrLogIncomplete)
+		}
+		shuffled := make([]chainCard, len(cards))
+		for i, j := range a.Permutation {
+			shuffled[i] = cards[j]
+		}
+		if a.Pile == "" {
+			err = relinkDeck(q, deckId, shuffled)
+		} else {
+			err = relinkPile(q, shuffled)
+		}
+		if err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("action %q non annulable: %w", a.Action, ErrLogIncomplete)
+	}
+	return w.logAction(q, deckId, a)
+}
+
+// historyPile retourne l'id d'une pile citee par l'historique, son absence est ErrLogIncomplete
+func historyPile(q querier, deckId, pileName string) (int64, error) {
+	pileId, err := pileID(q, deckId, pileName)
+	if errors.Is(err, ErrPileNotFound) {
+		return 0, fmt.Errorf("pile %s absente: %w", pileName, ErrLogIncomplete)
+	}
+	return pileId, err
+}
+
+// takeFromPile retire d'une pile les cartes codes aux positions successives, qui deviennent
+// tirees; la pile est supprimee si remove
+func (w *WorkerPool) takeFromPile(q querier, deckId, pileName string, codes []string, positions []int, remove bool) error {
+	pileId, err := historyPile(q, deckId, pileName)
+	if err != nil {
+		return err
+	}
+	cards, err := pileChain(q, pileId)
+	if err != nil {
+		return err
+	}
+	for k, code := range codes {
+		i := positions[k]
+		if i < 0 || i >= len(cards) || cards[i].code != code {
+			return fmt.Errorf("carte %s absente de la position %d de la pile %s: %w", code, i, pileName, ErrLogIncomplete)
+		}
+		if cards, err = takePileCard(q, deckId, cards, i); err != nil {
+			return err
+		}
+	}
+	if remove {
+		if len(cards) > 0 {
+			return fmt.Errorf("pile %s encore non vide: %w", pileName, ErrLogIncomplete)
+		}
+		if _, err := q.Exec(`DELETE FROM Pile WHERE id = ?`, pileId); err != nil {
+			return fmt.Errorf("echec de suppression de la pile: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1431 @@
+package database
+
+import (
+	"context"
+	"deckofcards/models"
+	"deckofcards/utils"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore implementation de Backend entierement en memoire, pour les tests rapides et
+// les serveurs ephemeres. Une operation modifie une copie du deck action par action avec
+// GameState.apply, comme replay, et la copie remplace le deck seulement si l'operation
+// reussit. Journal, historique, evenements et duree de vie se comportent comme le WorkerPool
+// Les vues retournees par As partagent les decks et ne different que par l'auteur de leurs actions
+type MemoryStore struct {
+	*memoryStore
+	author string //< auteur inscrit au journal pour les operations de cette vue, vide si inconnu
+}
+
+// memoryStore etat partage par un MemoryStore et ses vues
+type memoryStore struct {
+	mu         sync.Mutex
+	decks      map[string]*memoryDeck
+	ttl        time.Duration    //< duree d'inactivite avant expiration d'un deck, 0 = jamais
+	now        func() time.Time //< horloge, remplacable dans les tests
+	shuffler   models.Shuffler  //< aleatoire des decks sans graine
+	bus        eventBus         //< abonnes aux evenements des decks
+	lastAction int64            //< id de la derniere action journalisee, tous decks confondus
+	lastEvent  int64            //< id du dernier evenement emis, tous decks confondus
+	closed     bool             //< operations refusees apres Drain
+}
+
+// memoryDeck deck d'un MemoryStore, les cartes sont rangees du dessus vers le dessous
+type memoryDeck struct {
+	cards        []string
+	piles        map[string][]string
+	pileOrder    []string //< noms des piles par ordre de creation, comme Pile.id
+	entries      map[string]*memoryEntry
+	shuffled     bool
+	seed         *int64
+	shuffleCount int64 //< melanges faits avec la graine, comme Deck.shuffleCount
+	nPackets     int
+	lastAccessed time.Time
+	log          []Action       //< journal du deck, comme ActionLog
+	events       []Event        //< evenements du deck, comme DeckEvent
+	history      []memoryChange //< operations annulables de la plus ancienne a la plus recente
+}
+
+// memoryChange operation annulable d'un deck, comme une entree de DeckHistory
+type memoryChange struct {
+	op      string
+	state   historyState //< etat a remettre: avant l'operation, ou apres si elle est annulee
+	actions []Action
+	undone  bool
+}
+
+// memoryEntry inventaire d'un code, comme DeckEntry
+type memoryEntry struct {
+	total, inDeck, inPile int
+}
+
+// drawn exemplaires tires et places nulle part
+func (e *memoryEntry) drawn() int {
+	return e.total - e.inDeck - e.inPile
+}
+
+// NewMemoryStore retourne un MemoryStore vide dont les decks expirent apres cfg.DeckTTL
+func NewMemoryStore(cfg *utils.Config) *MemoryStore {
+	return &MemoryStore{memoryStore: &memoryStore{
+		decks:    make(map[string]*memoryDeck),
+		ttl:      cfg.DeckTTL.Duration,
+		now:      time.Now,
+		shuffler: models.DefaultShuffler,
+	}}
+}
+
+// As retourne une vue du MemoryStore dont les operations inscrivent actor comme
+// auteur de leurs actions, comme WorkerPool.As
+func (m *MemoryStore) As(actor string) Backend {
+	return &MemoryStore{memoryStore: m.memoryStore, author: actor}
+}
+
+// SetShuffler remplace la source d'aleatoire utilisee pour les decks sans graine
+func (m *MemoryStore) SetShuffler(s models.Shuffler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shuffler = s
+}
+
+// Drain refuse les nouvelles operations. Elles s'executent sous m.mu: celles en cours
+// sont terminees des que le verrou est obtenu
+func (m *MemoryStore) Drain(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// Close refuse les operations suivantes, les decks sont perdus avec le MemoryStore
+func (m *MemoryStore) Close() {
+	_ = m.Drain(context.Background())
+}
+
+// Subscribe abonne aux evenements valides d'un deck a partir de maintenant, comme
+// WorkerPool.Subscribe
+func (m *MemoryStore) Subscribe(deckId string) (<-chan Event, func()) {
+	return m.bus.subscribe(deckId)
+}
+
+// CloseSubscriptions ferme les abonnements en cours et refuse les suivants
+func (m *MemoryStore) CloseSubscriptions() {
+	m.bus.close()
+}
+
+// deck retourne un deck existant et non expire et le prolonge, comme checkDeck
+// doit etre appele sous m.mu
+func (m *MemoryStore) deck(deckId string) (*memoryDeck, error) {
+	if m.closed {
+		return nil, ErrPoolClosed
+	}
+	d, ok := m.decks[deckId]
+	if !ok {
+		return nil, fmt.Errorf("deck %s: %w", deckId, ErrDeckNotFound)
+	}
+	now := m.now()
+	if m.ttl > 0 && d.lastAccessed.Add(m.ttl).Before(now) {
+		return nil, fmt.Errorf("deck %s: %w", deckId, ErrDeckExpired)
+	}
+	d.lastAccessed = now
+	return d, nil
+}
+
+// TouchDeck Prolonge la duree de vie d'un deck comme une lecture
+func (m *MemoryStore) TouchDeck(deckId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.deck(deckId)
+	return err
+}
+
+// PurgeExpired supprime au plus limit decks expires, les plus anciens en premier
+// Retourne le nombre de decks supprimes
+func (m *MemoryStore) PurgeExpired(limit int) (int, error) {
+	if m.ttl <= 0 || limit <= 0 {
+		return 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, ErrPoolClosed
+	}
+	cutoff := m.now().Add(-m.ttl)
+	var expired []string
+	for deckId, d := range m.decks {
+		if d.lastAccessed.Before(cutoff) {
+			expired = append(expired, deckId)
+		}
+	}
+	slices.SortFunc(expired, func(a, b string) int {
+		return m.decks[a].lastAccessed.Compare(m.decks[b].lastAccessed)
+	})
+	expired = expired[:min(limit, len(expired))]
+	for _, deckId := range expired {
+		delete(m.decks, deckId)
+	}
+	return len(expired), nil
+}
+
+// StartJanitor demarre une goroutine qui purge les decks expires toutes les interval,
+// comme WorkerPool.StartJanitor
+func (m *MemoryStore) StartJanitor(ctx context.Context, interval time.Duration, batchSize int) {
+	if m.ttl <= 0 {
+		return
+	}
+	startJanitor(ctx, interval, batchSize, m.PurgeExpired)
+}
+
+// memoryTx operation en cours d'un MemoryStore sur la copie d d'un deck
+type memoryTx struct {
+	m      *MemoryStore
+	deckId string
+	d      *memoryDeck
+	actor  string        //< auteur des actions journalisees, vide si inconnu
+	op     *memoryChange //< operation annulable en cours, nil si aucune
+	events []Event       //< evenements diffuses si l'operation reussit
+}
+
+// transaction execute fn sur une copie du deck deckId, ou sans deck si deckId est vide
+// pour une creation. La copie remplace le deck et les evenements emis sont diffuses
+// seulement si fn ne retourne pas d'erreur, comme WorkerPool.transaction
+func (m *MemoryStore) transaction(deckId string, fn func(t *memoryTx) (interface{}, error)) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrPoolClosed
+	}
+	t := &memoryTx{m: m, deckId: deckId, actor: m.author}
+	if deckId != "" {
+		d, err := m.deck(deckId)
+		if err != nil {
+			return nil, err
+		}
+		t.d = d.clone()
+	}
+
+	data, err := fn(t)
+	if err != nil {
+		return nil, err
+	}
+	if t.d != nil {
+		m.decks[t.deckId] = t.d
+	}
+	m.bus.publish(t.events)
+	return data, nil
+}
+
+// clone copie un deck pour une transaction. Le journal et les evenements ne font que
+// s'allonger: la copie partage leurs elements, ceux ajoutes par une transaction annulee
+// restent au-dela de la longueur du deck d'origine et seront ecrases
+func (d *memoryDeck) clone() *memoryDeck {
+	c := *d
+	c.cards = slices.Clone(d.cards)
+	c.piles = make(map[string][]string, len(d.piles))
+	for name, pile := range d.piles {
+		c.piles[name] = slices.Clone(pile)
+	}
+	c.pileOrder = slices.Clone(d.pileOrder)
+	c.entries = make(map[string]*memoryEntry, len(d.entries))
+	for code, entry := range d.entries {
+		e := *entry
+		c.entries[code] = &e
+	}
+	c.history = slices.Clone(d.history)
+	return &c
+}
+
+// historyState retourne l'etat des melanges et les noms des piles d'un deck
+func (d *memoryDeck) historyState() historyState {
+	return historyState{
+		Shuffled:     d.shuffled,
+		Seed:         d.seed,
+		ShuffleCount: d.shuffleCount,
+		Piles:        slices.Sorted(maps.Keys(d.piles)),
+	}
+}
+
+// pile retourne les cartes d'une pile
+func (d *memoryDeck) pile(pileName string) ([]string, error) {
+	pile, ok := d.piles[pileName]
+	if !ok {
+		return nil, fmt.Errorf("pile %s: %w", pileName, ErrPileNotFound)
+	}
+	return pile, nil
+}
+
+// insert cree un deck sous un nouvel identifiant et en fait le deck de la transaction
+func (t *memoryTx) insert(deck *models.Deck) (string, error) {
+	var deckId string
+	for tries := 0; tries < 30 && deckId == ""; tries++ {
+		id, err := randomBase62(12)
+		if err != nil {
+			return "", fmt.Errorf("randomBase62: %w", err)
+		}
+		if _, exists := t.m.decks[id]; !exists {
+			deckId = id
+		}
+	}
+	if deckId == "" {
+		return "", fmt.Errorf("Impossible de generer un id unique pour le deck")
+	}
+
+	t.deckId = deckId
+	t.d = &memoryDeck{
+		piles:        make(map[string][]string),
+		entries:      make(map[string]*memoryEntry),
+		shuffled:     deck.Shuffled,
+		nPackets:     deck.NPackets,
+		lastAccessed: t.m.now(),
+	}
+	if deck.Seed != nil {
+		seed := *deck.Seed
+		t.d.seed = &seed
+		// Le melange initial d'un deck avec graine correspond au tour 0
+		if deck.Shuffled {
+			t.d.shuffleCount = 1
+		}
+	}
+	return deckId, t.do(Action{Action: ActionCreate, Cards: deck.Cards})
+}
+
+// change commence une operation annulable op, comme WorkerPool.change: les operations
+// annulees ne peuvent plus etre retablies et seules les historyLimit dernieres sont gardees
+func (t *memoryTx) change(op string) {
+	history := slices.DeleteFunc(t.d.history, func(c memoryChange) bool { return c.undone })
+	history = append(history, memoryChange{op: op, state: t.d.historyState()})
+	if len(history) > historyLimit {
+		history = slices.Delete(history, 0, len(history)-historyLimit)
+	}
+	t.d.history = history
+	t.op = &history[len(history)-1]
+}
+
+// do applique une action au deck avec GameState.apply, met a jour l'inventaire et la
+// journalise, ainsi que dans l'operation annulable en cours
+func (t *memoryTx) do(a Action) error {
+	// Les poses sur une pile sont gardees meme vides: elles peuvent creer la pile
+	switch a.Action {
+	case ActionDraw, ActionPileDraw, ActionReturn:
+		if len(a.Cards) == 0 {
+			return nil
+		}
+	}
+	d := t.d
+	t.m.lastAction++
+	a.Id = t.m.lastAction
+	a.Actor = t.actor
+	a.At = t.m.now().UTC()
+	a.Cards = slices.Clone(a.Cards)
+
+	_, existed := d.piles[a.Pile]
+	state := GameState{DeckId: t.deckId, Cards: d.cards, Piles: d.piles}
+	if err := state.apply(a); err != nil {
+		return err
+	}
+	d.cards, d.piles = state.Cards, state.Piles
+
+	switch a.Action {
+	case ActionPileInsert:
+		if !existed {
+			d.pileOrder = append(d.pileOrder, a.Pile)
+		}
+		if d.piles[a.Pile] == nil {
+			d.piles[a.Pile] = []string{}
+		}
+	case ActionPileDelete:
+		d.pileOrder = slices.DeleteFunc(d.pileOrder, func(name string) bool { return name == a.Pile })
+	case ActionRestore:
+		d.pileOrder = slices.Sorted(maps.Keys(d.piles))
+	}
+	for _, code := range a.Cards {
+		entry := d.entries[code]
+		switch a.Action {
+		case ActionCreate:
+			if entry == nil {
+				entry = &memoryEntry{}
+				d.entries[code] = entry
+			}
+			entry.total++
+			entry.inDeck++
+		case ActionDraw:
+			entry.inDeck--
+		case ActionReturn:
+			entry.inDeck++
+			if a.Pile != "" {
+				entry.inPile--
+			}
+		case ActionPileInsert:
+			entry.inPile++
+		case ActionPileDraw, ActionPileDelete:
+			entry.inPile--
+		}
+	}
+
+	d.log = append(d.log, a)
+	if t.op != nil {
+		t.op.actions = append(t.op.actions, a)
+	}
+	return nil
+}
+
+// emit enregistre un evenement du deck, diffuse si la transaction reussit
+func (t *memoryTx) emit(typ, pile string, cards []string) {
+	if !emitted(typ, cards) {
+		return
+	}
+	t.m.lastEvent++
+	ev := Event{Id: t.m.lastEvent, DeckId: t.deckId, Type: typ, Pile: pile, Cards: slices.Clone(cards), At: t.m.now().UTC()}
+	t.d.events = append(t.d.events, ev)
+	t.events = append(t.events, ev)
+}
+
+// shuffler retourne le Shuffler d'une operation aleatoire, comme WorkerPool.deckShuffler
+func (t *memoryTx) shuffler() models.Shuffler {
+	if t.d.seed == nil {
+		return t.m.shuffler
+	}
+	round := t.d.shuffleCount
+	t.d.shuffleCount++
+	return models.NewSeededShuffler(*t.d.seed, uint64(round))
+}
+
+// pick retire de chain jusqu'a count cartes choisies une a une par index parmi les n
+// restantes, et retourne leurs codes et leurs positions successives
+func pick(chain []string, count int, index func(n int) int) ([]string, []int) {
+	rest := slices.Clone(chain)
+	codes := []string{}
+	var positions []int
+	for len(codes) < count && len(rest) > 0 {
+		i := index(len(rest))
+		codes = append(codes, rest[i])
+		positions = append(positions, i)
+		rest = slices.Delete(rest, i, i+1)
+	}
+	return codes, positions
+}
+
+// locate retourne les positions successives des cartes codes retirees une a une de chain,
+// chacune la plus proche du dessus, et l'index dans codes de la premiere absente, -1 sinon
+func locate(chain, codes []string) ([]int, int) {
+	rest := slices.Clone(chain)
+	positions := make([]int, len(codes))
+	for k, code := range codes {
+		i := slices.Index(rest, code)
+		if i < 0 {
+			return nil, k
+		}
+		positions[k] = i
+		rest = slices.Delete(rest, i, i+1)
+	}
+	return positions, -1
+}
+
+// permutation melange les index d'une chaine de n cartes avec shuffler: la carte i apres
+// le melange etait a l'index perm[i], comme chainPermutation
+func permutation(n int, shuffler models.Shuffler) []int {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	shuffler.Shuffle(n, func(i, j int) {
+		perm[i], perm[j] = perm[j], perm[i]
+	})
+	return perm
+}
+
+// InsertDeck Insert un deck
+func (m *MemoryStore) InsertDeck(deck *models.Deck) (string, error) {
+	data, err := m.transaction("", func(t *memoryTx) (interface{}, error) {
+		return t.insert(deck)
+	})
+	if err != nil {
+		return "", err
+	}
+	return data.(string), nil
+}
+
+// InsertDeckAndDraw Insert un deck et en pige jusqu'a count cartes du dessus dans la meme operation
+func (m *MemoryStore) InsertDeckAndDraw(deck *models.Deck, count int) (string, []string, int, error) {
+	var deckId string
+	data, err := m.transaction("", func(t *memoryTx) (interface{}, error) {
+		var err error
+		if deckId, err = t.insert(deck); err != nil {
+			return nil, err
+		}
+		t.change("draw")
+		return t.drawCards("top", count)
+	})
+	if err != nil {
+		return "", nil, 0, err
+	}
+	res := data.(drawResult)
+	return deckId, res.codes, res.remaining, nil
+}
+
+// DeleteDeck Supprime un deck et toutes ses piles, meme expire
+// Les abonnes du deck recoivent EventDeckDeleted puis leur canal est ferme
+func (m *MemoryStore) DeleteDeck(deckId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrPoolClosed
+	}
+	if _, ok := m.decks[deckId]; !ok {
+		return fmt.Errorf("deck %s: %w", deckId, ErrDeckNotFound)
+	}
+	delete(m.decks, deckId)
+	m.lastEvent++
+	m.bus.publish([]Event{{Id: m.lastEvent, DeckId: deckId, Type: EventDeckDeleted, At: m.now().UTC()}})
+	return nil
+}
+
+// CardsInDeck retourne le nombre de cartes de la pioche
+func (m *MemoryStore) CardsInDeck(deckId string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(d.cards)), nil
+}
+
+// PeekDeck retourne les count cartes du dessus de la pioche sans les tirer, ainsi que le
+// nombre de cartes restantes
+func (m *MemoryStore) PeekDeck(deckId string, count int) ([]string, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append([]string{}, d.cards[:min(count, len(d.cards))]...), len(d.cards), nil
+}
+
+// DeckState retourne l'etat d'un deck sans le modifier, la pioche seulement si reveal
+func (m *MemoryStore) DeckState(deckId string, reveal bool) (*DeckState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &DeckState{
+		DeckId:    deckId,
+		Remaining: len(d.cards),
+		Shuffled:  d.shuffled,
+		Seed:      d.seed,
+		Piles:     make(map[string]int, len(d.piles)),
+		Entries:   make(map[string]DeckEntry, len(d.entries)),
+	}
+	for name, pile := range d.piles {
+		state.Piles[name] = len(pile)
+	}
+	for code, entry := range d.entries {
+		state.Entries[code] = DeckEntry{Total: entry.total, InDeck: entry.inDeck, InPile: entry.inPile, Drawn: entry.drawn()}
+		state.Drawn += entry.drawn()
+	}
+	if n := len(d.events); n > 0 {
+		state.LastEvent = d.events[n-1].Id
+	}
+	if reveal {
+		state.Cards = append([]string{}, d.cards...)
+	}
+	return state, nil
+}
+
+// DrawCards Pige jusqu'a amount cartes du dessus et retourne les codes et le nombre de cartes restantes
+func (m *MemoryStore) DrawCards(deckId string, amount int) ([]string, int, error) {
+	return m.DrawCardsFrom(deckId, "top", amount)
+}
+
+// DrawCardsFrom Pige jusqu'a count cartes du dessus ("top"), du dessous ("bottom") ou au
+// hasard ("random") de la pioche et retourne les codes et le nombre de cartes restantes
+func (m *MemoryStore) DrawCardsFrom(deckId, method string, count int) ([]string, int, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("draw")
+		return t.drawCards(method, count)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	res := data.(drawResult)
+	return res.codes, res.remaining, nil
+}
+
+// drawCards tire jusqu'a count cartes de la pioche selon method
+func (t *memoryTx) drawCards(method string, count int) (drawResult, error) {
+	var index func(n int) int
+	switch method {
+	case "top":
+		index = func(int) int { return 0 }
+	case "bottom":
+		index = func(n int) int { return n - 1 }
+	case "random":
+		index = t.shuffler().Intn
+	default:
+		return drawResult{}, fmt.Errorf("%q: %w", method, ErrInvalidMethod)
+	}
+	codes, positions := pick(t.d.cards, count, index)
+	if err := t.do(Action{Action: ActionDraw, Cards: codes, Positions: positions}); err != nil {
+		return drawResult{}, err
+	}
+	t.emit(EventDrawn, "", codes)
+	return drawResult{codes: codes, remaining: len(t.d.cards)}, nil
+}
+
+// DrawSpecificFromDeck Pige les cartes de codes donnes ou qu'elles soient dans la pioche
+// Aucune carte n'est tiree si l'une d'elles n'est pas dans la pioche
+func (m *MemoryStore) DrawSpecificFromDeck(deckId string, codes []string) ([]string, int, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("draw")
+		return t.drawSpecificFromDeck(codes)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	res := data.(drawResult)
+	return res.codes, res.remaining, nil
+}
+
+// drawSpecificFromDeck tire les cartes de codes donnes de la pioche
+func (t *memoryTx) drawSpecificFromDeck(codes []string) (drawResult, error) {
+	positions, missing := locate(t.d.cards, codes)
+	if missing >= 0 {
+		return drawResult{}, fmt.Errorf("carte %s: %w", codes[missing], ErrCardNotInDeck)
+	}
+	if err := t.do(Action{Action: ActionDraw, Cards: codes, Positions: positions}); err != nil {
+		return drawResult{}, err
+	}
+	t.emit(EventDrawn, "", codes)
+	return drawResult{codes: codes, remaining: len(t.d.cards)}, nil
+}
+
+// ShuffleDeck Melange les cartes restantes d'un deck, avec la graine du deck si elle existe
+func (m *MemoryStore) ShuffleDeck(deckId string) (*models.Deck, error) {
+	return m.shuffleDeck(deckId, nil)
+}
+
+// ShuffleDeckSeeded Remplace la graine d'un deck puis le melange
+func (m *MemoryStore) ShuffleDeckSeeded(deckId string, seed int64) (*models.Deck, error) {
+	return m.shuffleDeck(deckId, &seed)
+}
+
+// ShuffleDeckAndPiles Melange la pioche puis toutes les piles d'un deck dans une seule
+// transaction, annulee d'un seul Undo, comme WorkerPool.ShuffleDeckAndPiles
+func (m *MemoryStore) ShuffleDeckAndPiles(deckId string, seed *int64) (*models.Deck, map[string]int, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("shuffle")
+		deck, err := t.shuffleDeck(seed)
+		if err != nil {
+			return nil, err
+		}
+		piles, err := t.shuffleAllPiles()
+		return shuffleResult{deck: deck, piles: piles}, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	res := data.(shuffleResult)
+	return res.deck, res.piles, nil
+}
+
+func (m *MemoryStore) shuffleDeck(deckId string, seed *int64) (*models.Deck, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("shuffle")
+		return t.shuffleDeck(seed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.(*models.Deck), nil
+}
+
+// shuffleDeck melange la pioche, apres avoir remplace la graine du deck si seed est fourni
+func (t *memoryTx) shuffleDeck(seed *int64) (*models.Deck, error) {
+	if seed != nil {
+		s := *seed
+		t.d.seed, t.d.shuffleCount = &s, 0
+	}
+	perm := permutation(len(t.d.cards), t.shuffler())
+	if err := t.do(Action{Action: ActionShuffle, Permutation: perm}); err != nil {
+		return nil, err
+	}
+	t.d.shuffled = true
+	t.emit(EventShuffled, "", nil)
+	return &models.Deck{Cards: append([]string{}, t.d.cards...), Id: t.deckId, Shuffled: true, Seed: t.d.seed}, nil
+}
+
+// Deal Distribue count cartes du dessus de la pioche a chacune des piles, creees au besoin,
+// en mode "roundrobin" ou "block" comme WorkerPool.Deal
+func (m *MemoryStore) Deal(deckId string, piles []string, count int, mode string) (map[string][]string, int, error) {
+	if mode != "roundrobin" && mode != "block" {
+		return nil, 0, fmt.Errorf("%q: %w", mode, ErrInvalidMethod)
+	}
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("deal")
+		if len(t.d.cards) < count*len(piles) {
+			return nil, fmt.Errorf("%d cartes pour %d piles de %d: %w", len(t.d.cards), len(piles), count, ErrNotEnoughCards)
+		}
+
+		dealt := make(map[string][]string, len(piles))
+		n := 0
+		deal := func(i int) {
+			dealt[piles[i]] = append(dealt[piles[i]], t.d.cards[n])
+			n++
+		}
+		if mode == "roundrobin" {
+			for round := 0; round < count; round++ {
+				for i := range piles {
+					deal(i)
+				}
+			}
+		} else {
+			for i := range piles {
+				for k := 0; k < count; k++ {
+					deal(i)
+				}
+			}
+		}
+		// Toutes les cartes sont prises sur le dessus, l'ordre entre les piles n'importe pas
+		if err := t.do(Action{Action: ActionDraw, Cards: t.d.cards[:n], Positions: make([]int, n)}); err != nil {
+			return nil, err
+		}
+		for _, name := range piles {
+			if err := t.do(Action{Action: ActionPileInsert, Pile: name, Cards: dealt[name]}); err != nil {
+				return nil, err
+			}
+			t.emit(EventPileAdded, name, dealt[name])
+		}
+		return dealResult{piles: dealt, remaining: len(t.d.cards)}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	res := data.(dealResult)
+	return res.piles, res.remaining, nil
+}
+
+// BatchAs Execute un lot d'operations sur un deck en une seule operation, comme
+// WorkerPool.BatchAs: la premiere en echec annule tout le lot
+func (m *MemoryStore) BatchAs(deckId, actor string, ops []BatchOp) ([]BatchResult, int, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.actor = actor
+		t.change("batch")
+		results := make([]BatchResult, len(ops))
+		for i, op := range ops {
+			res, err := t.batchOp(op)
+			if err != nil {
+				return nil, &BatchError{Index: i, Op: op.Op, Err: err}
+			}
+			results[i] = res
+		}
+		return batchResult{results: results, remaining: len(t.d.cards)}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	res := data.(batchResult)
+	return res.results, res.remaining, nil
+}
+
+// batchOp applique une operation d'un lot, comme WorkerPool.batchOp
+func (t *memoryTx) batchOp(op BatchOp) (BatchResult, error) {
+	method := op.Method
+	if method == "" {
+		method = "top"
+	}
+
+	switch op.Op {
+	case "draw":
+		if len(op.Cards) > 0 {
+			res, err := t.drawSpecificFromDeck(op.Cards)
+			return BatchResult{Cards: res.codes}, err
+		}
+		res, err := t.drawCards(method, op.Count)
+		return BatchResult{Cards: res.codes}, err
+
+	case "addToPile":
+		return BatchResult{Cards: op.Cards}, t.insertIntoPile(op.Pile, op.Cards)
+
+	case "drawPile":
+		if len(op.Cards) > 0 {
+			return BatchResult{Cards: op.Cards}, t.drawSpecificFromPile(op.Pile, op.Cards)
+		}
+		drawn, err := t.drawFromPile(op.Pile, method, op.Count)
+		return BatchResult{Cards: drawn}, err
+
+	case "return":
+		if err := op.Position.check(); err != nil {
+			return BatchResult{}, err
+		}
+		if len(op.Cards) > 0 {
+			if op.Pile == "" {
+				return BatchResult{Cards: op.Cards}, t.returnSpecificDrawn(op.Cards, op.Position)
+			}
+			return BatchResult{Cards: op.Cards}, t.returnSpecificFromPile(op.Pile, op.Cards, op.Position)
+		}
+		if op.Pile == "" {
+			return BatchResult{}, t.returnAllDrawn(op.Position)
+		}
+		return BatchResult{}, t.returnAllFromPile(op.Pile, op.Position)
+
+	case "shuffle":
+		if op.Pile == "" {
+			_, err := t.shuffleDeck(op.Seed)
+			return BatchResult{}, err
+		}
+		_, err := t.shufflePileByName(op.Pile)
+		return BatchResult{}, err
+
+	default:
+		return BatchResult{}, fmt.Errorf("operation %q: %w", op.Op, ErrInvalidMethod)
+	}
+}
+
+// InsertIntoPile Rajoute des cartes tirees sur le dessus d'une pile, si la pile n'existe pas elle est creee
+func (m *MemoryStore) InsertIntoPile(name string, deckId string, codes []string) (models.Deck, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("addToPile")
+		if err := t.insertIntoPile(name, codes); err != nil {
+			return nil, err
+		}
+		return models.Deck{
+			Remaining: len(t.d.cards),
+			Piles:     map[string]*models.Pile{name: {Remaining: len(t.d.piles[name])}},
+			Id:        deckId,
+		}, nil
+	})
+	if err != nil {
+		return models.Deck{}, err
+	}
+	return data.(models.Deck), nil
+}
+
+// insertIntoPile pose des cartes tirees sur le dessus d'une pile, creee au besoin
+// La derniere carte de codes se retrouve sur le dessus
+func (t *memoryTx) insertIntoPile(name string, codes []string) error {
+	placed := make(map[string]int)
+	for _, code := range codes {
+		entry, ok := t.d.entries[code]
+		if !ok {
+			return fmt.Errorf("carte %s: %w", code, ErrCardNotInDeck)
+		}
+		if entry.drawn() <= placed[code] {
+			return fmt.Errorf("carte %s non pigée, non présente dans le deck, ou déjà dans les piles: %w", code, ErrCardNotDrawn)
+		}
+		placed[code]++
+	}
+	if err := t.do(Action{Action: ActionPileInsert, Pile: name, Cards: codes}); err != nil {
+		return err
+	}
+	t.emit(EventPileAdded, name, codes)
+	return nil
+}
+
+// GetPileCards retourne les cartes d'une pile du dessus vers le dessous
+func (m *MemoryStore) GetPileCards(deckId, pileName string) ([]string, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return nil, 0, err
+	}
+	pile, err := d.pile(pileName)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append([]string{}, pile...), len(pile), nil
+}
+
+// PeekPile retourne les count cartes du dessus (ou du dessous si fromBottom) d'une pile
+// sans les tirer, ainsi que le nombre de cartes de la pile
+func (m *MemoryStore) PeekPile(deckId, pileName string, count int, fromBottom bool) ([]string, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return nil, 0, err
+	}
+	pile, err := d.pile(pileName)
+	if err != nil {
+		return nil, 0, err
+	}
+	cards := slices.Clone(pile)
+	if fromBottom {
+		slices.Reverse(cards)
+	}
+	return append([]string{}, cards[:min(count, len(cards))]...), len(cards), nil
+}
+
+// CardsInPile retourne le nombre de cartes d'une pile, 0 si elle n'existe pas
+func (m *MemoryStore) CardsInPile(deckId string, pileName string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(d.piles[pileName])), nil
+}
+
+// ListPiles retourne le nombre de cartes de chaque pile d'un deck
+func (m *MemoryStore) ListPiles(deckId string) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return nil, err
+	}
+	piles := make(map[string]int, len(d.piles))
+	for name, pile := range d.piles {
+		piles[name] = len(pile)
+	}
+	return piles, nil
+}
+
+// ShufflePile Melange une pile et retourne ses cartes du dessus vers le dessous
+func (m *MemoryStore) ShufflePile(deckId, pileName string) ([]string, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("shufflePile")
+		return t.shufflePileByName(pileName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]string), nil
+}
+
+// ShuffleAllPiles Melange toutes les piles d'un deck et retourne le nombre de cartes de chacune
+// Sans pile, rien n'est melange ni inscrit dans l'historique
+func (m *MemoryStore) ShuffleAllPiles(deckId string) (map[string]int, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		if len(t.d.piles) == 0 {
+			return map[string]int{}, nil
+		}
+		t.change("shufflePiles")
+		return t.shuffleAllPiles()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.(map[string]int), nil
+}
+
+// shuffleAllPiles melange toutes les piles avec un meme Shuffler, dans leur ordre de creation
+// Sans pile, le Shuffler d'un deck avec graine n'est pas avance
+func (t *memoryTx) shuffleAllPiles() (map[string]int, error) {
+	results := make(map[string]int, len(t.d.piles))
+	if len(t.d.piles) == 0 {
+		return results, nil
+	}
+	shuffler := t.shuffler()
+	for _, name := range slices.Clone(t.d.pileOrder) {
+		cards, err := t.shufflePile(name, shuffler)
+		if err != nil {
+			return nil, err
+		}
+		results[name] = len(cards)
+	}
+	return results, nil
+}
+
+// shufflePileByName melange une pile avec le Shuffler du deck
+func (t *memoryTx) shufflePileByName(pileName string) ([]string, error) {
+	if _, err := t.d.pile(pileName); err != nil {
+		return nil, err
+	}
+	return t.shufflePile(pileName, t.shuffler())
+}
+
+// shufflePile melange les cartes d'une pile a partir de leur ordre actuel
+func (t *memoryTx) shufflePile(pileName string, shuffler models.Shuffler) ([]string, error) {
+	perm := permutation(len(t.d.piles[pileName]), shuffler)
+	if err := t.do(Action{Action: ActionShuffle, Pile: pileName, Permutation: perm}); err != nil {
+		return nil, err
+	}
+	t.emit(EventShuffled, pileName, nil)
+	return append([]string{}, t.d.piles[pileName]...), nil
+}
+
+// DrawFromPile Pige une carte du dessus ("top"), du dessous ("bottom") ou au hasard ("random") d'une pile
+func (m *MemoryStore) DrawFromPile(deckId, pileName, method string) (string, error) {
+	codes, err := m.DrawFromPileN(deckId, pileName, method, 1)
+	if err != nil {
+		return "", err
+	}
+	return codes[0], nil
+}
+
+// DrawFromPileN Pige jusqu'a count cartes du dessus, du dessous ou au hasard d'une pile
+// ErrPileEmpty si la pile est vide
+func (m *MemoryStore) DrawFromPileN(deckId, pileName, method string, count int) ([]string, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("drawPile")
+		return t.drawFromPile(pileName, method, count)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]string), nil
+}
+
+// drawFromPile tire jusqu'a count cartes d'une pile selon method
+func (t *memoryTx) drawFromPile(pileName, method string, count int) ([]string, error) {
+	if method != "top" && method != "bottom" && method != "random" {
+		return nil, fmt.Errorf("%q: %w", method, ErrInvalidMethod)
+	}
+	pile, err := t.d.pile(pileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(pile) == 0 {
+		return nil, fmt.Errorf("pile %s: %w", pileName, ErrPileEmpty)
+	}
+
+	index := func(int) int { return 0 }
+	switch method {
+	case "bottom":
+		index = func(n int) int { return n - 1 }
+	case "random":
+		index = t.shuffler().Intn
+	}
+	drawn, positions := pick(pile, count, index)
+	if err := t.do(Action{Action: ActionPileDraw, Pile: pileName, Cards: drawn, Positions: positions}); err != nil {
+		return nil, err
+	}
+	t.emit(EventPileDrawn, pileName, drawn)
+	return drawn, nil
+}
+
+// DrawSpecificFromPileMany Pige les cartes de codes donnes d'une pile
+// Rien n'est tire si l'une des cartes n'est pas dans la pile
+func (m *MemoryStore) DrawSpecificFromPileMany(deckId, pileName string, codes []string) error {
+	_, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("drawPile")
+		return nil, t.drawSpecificFromPile(pileName, codes)
+	})
+	return err
+}
+
+// drawSpecificFromPile tire d'une pile les cartes de codes donnes, les plus proches du dessus
+func (t *memoryTx) drawSpecificFromPile(pileName string, codes []string) error {
+	pile, err := t.d.pile(pileName)
+	if err != nil {
+		return err
+	}
+	if err := checkInPile(pile, pileName, codes); err != nil {
+		return err
+	}
+	positions, _ := locate(pile, codes)
+	if err := t.do(Action{Action: ActionPileDraw, Pile: pileName, Cards: codes, Positions: positions}); err != nil {
+		return err
+	}
+	t.emit(EventPileDrawn, pileName, codes)
+	return nil
+}
+
+// MovePileCards Deplace des cartes d'une pile vers une autre, comme WorkerPool.MovePileCards
+func (m *MemoryStore) MovePileCards(deckId, fromPile, toPile string, codes []string, count int, fromBottom bool) ([]string, error) {
+	if fromPile == toPile {
+		return nil, fmt.Errorf("pile %s: %w", fromPile, ErrSamePile)
+	}
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("move")
+		src, err := t.d.pile(fromPile)
+		if err != nil {
+			return nil, err
+		}
+
+		moved := codes
+		var positions []int
+		if len(codes) > 0 {
+			var missing int
+			if positions, missing = locate(src, codes); missing >= 0 {
+				return nil, fmt.Errorf("card %s in pile %s: %w", codes[missing], fromPile, ErrCardNotInPile)
+			}
+		} else {
+			if len(src) == 0 {
+				return nil, fmt.Errorf("pile %s: %w", fromPile, ErrPileEmpty)
+			}
+			moved, positions = pick(src, count, func(n int) int {
+				if fromBottom {
+					return n - 1
+				}
+				return 0
+			})
+		}
+
+		if err := t.do(Action{Action: ActionPileDraw, Pile: fromPile, Cards: moved, Positions: positions}); err != nil {
+			return nil, err
+		}
+		if err := t.do(Action{Action: ActionPileInsert, Pile: toPile, Cards: moved}); err != nil {
+			return nil, err
+		}
+		t.emit(EventPileDrawn, fromPile, moved)
+		t.emit(EventPileAdded, toPile, moved)
+		return moved, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]string), nil
+}
+
+// DeletePile Supprime une pile, ses cartes redeviennent pigees. Retourne le nombre de cartes liberees
+func (m *MemoryStore) DeletePile(deckId, pileName string) (int, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("deletePile")
+		pile, err := t.d.pile(pileName)
+		if err != nil {
+			return nil, err
+		}
+		codes := slices.Clone(pile)
+		deleted := Action{Action: ActionPileDelete, Pile: pileName, Cards: codes, Positions: make([]int, len(codes))}
+		if err := t.do(deleted); err != nil {
+			return nil, err
+		}
+		t.emit(EventPileDeleted, pileName, codes)
+		return len(codes), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return data.(int), nil
+}
+
+// ReturnSpecificDrawn Remet une carte tiree dans la pioche a la position pos
+func (m *MemoryStore) ReturnSpecificDrawn(deckId, code string, pos Position) (string, error) {
+	if err := m.ReturnSpecificDrawnMany(deckId, []string{code}, pos); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ReturnSpecificDrawnMany Remet des cartes tirees dans la pioche a la position pos, dans
+// l'ordre donne. Rien n'est remis si l'une n'est pas tiree
+func (m *MemoryStore) ReturnSpecificDrawnMany(deckId string, codes []string, pos Position) error {
+	if err := pos.check(); err != nil {
+		return err
+	}
+	_, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("return")
+		return nil, t.returnSpecificDrawn(codes, pos)
+	})
+	return err
+}
+
+// returnSpecificDrawn remet des cartes tirees et placees nulle part dans la pioche
+func (t *memoryTx) returnSpecificDrawn(codes []string, pos Position) error {
+	returned := make(map[string]int)
+	for _, code := range codes {
+		entry, ok := t.d.entries[code]
+		if !ok {
+			return fmt.Errorf("card %s: %w", code, ErrCardNotInDeck)
+		}
+		if entry.drawn() <= returned[code] {
+			return fmt.Errorf("card %s (total=%d, inDeck=%d, inPile=%d): %w",
+				code, entry.total, entry.inDeck, entry.inPile, ErrCardNotDrawn)
+		}
+		returned[code]++
+	}
+	return t.returnToDeck("", nil, codes, pos)
+}
+
+// ReturnAllDrawn Remet toutes les cartes tirees qui ne sont dans aucune pile dans la pioche
+func (m *MemoryStore) ReturnAllDrawn(deckId string, pos Position) error {
+	if err := pos.check(); err != nil {
+		return err
+	}
+	_, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("return")
+		return nil, t.returnAllDrawn(pos)
+	})
+	return err
+}
+
+// returnAllDrawn remet toutes les cartes tirees et placees nulle part dans la pioche
+func (t *memoryTx) returnAllDrawn(pos Position) error {
+	var codes []string
+	for _, code := range slices.Sorted(maps.Keys(t.d.entries)) {
+		for n := t.d.entries[code].drawn(); n > 0; n-- {
+			codes = append(codes, code)
+		}
+	}
+	return t.returnToDeck("", nil, codes, pos)
+}
+
+// ReturnSpecificFromPile Remet une carte d'une pile dans la pioche a la position pos
+func (m *MemoryStore) ReturnSpecificFromPile(deckId, pileName, code string, pos Position) (string, error) {
+	if err := m.ReturnSpecificFromPileMany(deckId, pileName, []string{code}, pos); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ReturnSpecificFromPileMany Remet des cartes d'une pile, les plus proches du dessus, dans la
+// pioche a la position pos. Rien n'est remis si l'une n'est pas dans la pile
+func (m *MemoryStore) ReturnSpecificFromPileMany(deckId, pileName string, codes []string, pos Position) error {
+	if err := pos.check(); err != nil {
+		return err
+	}
+	_, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("return")
+		return nil, t.returnSpecificFromPile(pileName, codes, pos)
+	})
+	return err
+}
+
+// returnSpecificFromPile remet des cartes d'une pile, les plus proches du dessus, dans la pioche
+func (t *memoryTx) returnSpecificFromPile(pileName string, codes []string, pos Position) error {
+	pile, err := t.d.pile(pileName)
+	if err != nil {
+		return err
+	}
+	if err := checkInPile(pile, pileName, codes); err != nil {
+		return err
+	}
+	from, _ := locate(pile, codes)
+	return t.returnToDeck(pileName, from, codes, pos)
+}
+
+// ReturnAllFromPile Remet toutes les cartes d'une pile dans la pioche a la position pos,
+// dans l'ordre de la pile
+func (m *MemoryStore) ReturnAllFromPile(deckId, pileName string, pos Position) error {
+	if err := pos.check(); err != nil {
+		return err
+	}
+	_, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		t.change("return")
+		return nil, t.returnAllFromPile(pileName, pos)
+	})
+	return err
+}
+
+// returnAllFromPile vide une pile dans la pioche en gardant l'ordre de la pile
+func (t *memoryTx) returnAllFromPile(pileName string, pos Position) error {
+	pile, err := t.d.pile(pileName)
+	if err != nil {
+		return err
+	}
+	codes := slices.Clone(pile)
+	return t.returnToDeck(pileName, make([]int, len(codes)), codes, pos)
+}
+
+// returnToDeck insere codes, venant de la pile pile aux index successifs from ou des cartes
+// tirees si pile est vide, dans la pioche a la position pos en gardant leur ordre
+func (t *memoryTx) returnToDeck(pile string, from []int, codes []string, pos Position) error {
+	var shuffler models.Shuffler
+	if pos == PositionRandom {
+		shuffler = t.shuffler()
+	}
+	positions := make([]int, len(codes))
+	for n := range codes {
+		positions[n] = pos.index(n, len(t.d.cards)+n, shuffler)
+	}
+	returned := Action{Action: ActionReturn, Pile: pile, Cards: codes, Positions: positions, From: from}
+	if err := t.do(returned); err != nil {
+		return err
+	}
+	t.emit(EventReturned, pile, codes)
+	return nil
+}
+
+// Undo Annule la derniere operation non annulee d'un deck et retourne son nom
+func (m *MemoryStore) Undo(deckId string) (string, error) {
+	return m.travel(deckId, true)
+}
+
+// Redo Retablit la derniere operation annulee d'un deck et retourne son nom
+func (m *MemoryStore) Redo(deckId string) (string, error) {
+	return m.travel(deckId, false)
+}
+
+// travel annule (undo) une operation en appliquant l'inverse de ses actions, de la
+// derniere a la premiere, ou la retablit en rejouant ses actions, comme WorkerPool.travel
+func (m *MemoryStore) travel(deckId string, undo bool) (string, error) {
+	data, err := m.transaction(deckId, func(t *memoryTx) (interface{}, error) {
+		// Les operations annulees suivent toujours celles qui ne le sont pas
+		history := t.d.history
+		i := slices.IndexFunc(history, func(c memoryChange) bool { return c.undone })
+		if i < 0 {
+			i = len(history)
+		}
+		if undo {
+			i--
+		}
+		if i < 0 || i >= len(history) {
+			if undo {
+				return nil, fmt.Errorf("deck %s: %w", deckId, ErrNothingToUndo)
+			}
+			return nil, fmt.Errorf("deck %s: %w", deckId, ErrNothingToRedo)
+		}
+
+		c := &history[i]
+		current := t.d.historyState()
+		if undo {
+			for k := len(c.actions) - 1; k >= 0; k-- {
+				for _, a := range inverseActions(c.actions[k]) {
+					if err := t.do(a); err != nil {
+						return nil, fmt.Errorf("historique %s: %w", c.op, err)
+					}
+				}
+			}
+		} else {
+			for _, a := range c.actions {
+				if err := t.do(a); err != nil {
+					return nil, fmt.Errorf("historique %s: %w", c.op, err)
+				}
+			}
+		}
+		if err := t.restoreHistoryState(c.state); err != nil {
+			return nil, err
+		}
+		c.state, c.undone = current, undo
+
+		if undo {
+			t.emit(EventUndone, "", nil)
+		} else {
+			t.emit(EventRedone, "", nil)
+		}
+		return c.op, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return data.(string), nil
+}
+
+// restoreHistoryState remet l'etat des melanges d'un deck et supprime les piles absentes
+// de state, que les actions inverses ont videes
+func (t *memoryTx) restoreHistoryState(state historyState) error {
+	t.d.shuffled, t.d.seed, t.d.shuffleCount = state.Shuffled, state.Seed, state.ShuffleCount
+	for _, name := range slices.Clone(t.d.pileOrder) {
+		if slices.Contains(state.Piles, name) {
+			continue
+		}
+		if err := t.do(Action{Action: ActionPileDelete, Pile: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ActionLog retourne les actions d'un deck d'id superieur a afterId, au plus limit
+func (m *MemoryStore) ActionLog(deckId string, afterId int64, limit int) ([]Action, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return nil, err
+	}
+	actions := []Action{}
+	for _, a := range d.log {
+		if len(actions) == limit {
+			break
+		}
+		if a.Id > afterId {
+			actions = append(actions, a)
+		}
+	}
+	return actions, nil
+}
+
+// Replay Rejoue le journal d'un deck jusqu'a l'action untilId incluse (toutes si 0)
+func (m *MemoryStore) Replay(deckId string, untilId int64) (*GameState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return nil, err
+	}
+	actions := d.log
+	if n := slices.IndexFunc(d.log, func(a Action) bool { return untilId > 0 && a.Id > untilId }); n >= 0 {
+		actions = d.log[:n]
+	}
+	return replay(deckId, actions)
+}
+
+// Events retourne au plus limit evenements d'un deck d'id superieur a afterId, du plus
+// ancien au plus recent
+func (m *MemoryStore) Events(deckId string, afterId int64, limit int) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return nil, err
+	}
+	events := []Event{}
+	for _, ev := range d.events {
+		if len(events) == limit {
+			break
+		}
+		if ev.Id > afterId {
+			events = append(events, ev)
+		}
+	}
+	return events, nil
+}
+
+// Snapshot Retourne la position de jeu actuelle d'un deck sans le modifier
+func (m *MemoryStore) Snapshot(deckId string) (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, err := m.deck(deckId)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{
+		Version:      SnapshotVersion,
+		DeckId:       deckId,
+		TakenAt:      m.now().UTC(),
+		Shuffled:     d.shuffled,
+		Seed:         d.seed,
+		ShuffleCount: d.shuffleCount,
+		NPackets:     d.nPackets,
+		Cards:        append([]string{}, d.cards...),
+		Piles:        make(map[string][]string, len(d.piles)),
+		Entries:      make(map[string]SnapshotEntry, len(d.entries)),
+	}
+	for name, pile := range d.piles {
+		snap.Piles[name] = append([]string{}, pile...)
+	}
+	for code, entry := range d.entries {
+		snap.Entries[code] = SnapshotEntry{Total: entry.total, InDeck: entry.inDeck, InPile: entry.inPile}
+	}
+	return snap, nil
+}
+
+// RestoreSnapshot Recree une position de jeu sous un nouveau deck et retourne son identifiant
+func (m *MemoryStore) RestoreSnapshot(snap *Snapshot) (string, error) {
+	if err := snap.Validate(); err != nil {
+		return "", err
+	}
+	data, err := m.transaction("", func(t *memoryTx) (interface{}, error) {
+		deckId, err := t.insert(&models.Deck{Cards: snap.Cards, NPackets: snap.NPackets, Shuffled: snap.Shuffled, Seed: snap.Seed})
+		if err != nil {
+			return nil, err
+		}
+		t.d.shuffleCount = snap.ShuffleCount
+
+		t.d.entries = make(map[string]*memoryEntry, len(snap.Entries))
+		for code, entry := range snap.Entries {
+			t.d.entries[code] = &memoryEntry{total: entry.Total, inDeck: entry.InDeck, inPile: entry.InPile}
+		}
+		piles := make(map[string][]string, len(snap.Piles))
+		for name, cards := range snap.Piles {
+			piles[name] = slices.Clone(cards)
+		}
+		return deckId, t.do(Action{Action: ActionRestore, Cards: snap.Cards, Piles: piles})
+	})
+	if err != nil {
+		return "", err
+	}
+	return data.(string), nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// MovePileCards Deplace des cartes d'une pile vers une autre en une seule transaction
+// Les cartes codes sont prises ou qu'elles soient dans la pile source; si codes est vide,
+// count cartes sont prises du dessus (ou du dessous si fromBottom). Chaque carte est
+// posee sur le dessus de la pile destination, creee si elle n'existe pas
+// Les cartes restent dans une pile: DeckEntry n'est pas modifie
+func (w *WorkerPool) MovePileCards(deckId, fromPile, toPile string, codes []string, count int, fromBottom bool) ([]string, error) {
+	if fromPile == toPile {
+		return nil, fmt.Errorf("pile %s: %w", fromPile, ErrSamePile)
+	}
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		if err := w.change(tx, deckId, "move"); err != nil {
+			return nil, err
+		}
+		srcId, err := pileID(tx, deckId, fromPile)
+		if err != nil {
+			return nil, err
+		}
+		src, err := pileChain(tx, srcId)
+		if err != nil {
+			return nil, err
+		}
+		dstId, err := ensurePile(tx, deckId, toPile)
+		if err != nil {
+			return nil, err
+		}
+		dst, err := pileChain(tx, dstId)
+		if err != nil {
+			return nil, err
+		}
+
+		var positions []int
+		move := func(i int) error {
+			positions = append(positions, i)
+			card := src[i]
+			if src, err = detachPileCard(tx, src, i); err != nil {
+				return err
+			}
+			dst, err = pushPileCard(tx, dstId, dst, card)
+			return err
+		}
+
+		var moved []string
+		if len(codes) > 0 {
+			for _, code := range codes {
+				i := chainIndex(src, code)
+				if i < 0 {
+					return nil, fmt.Errorf("card %s in pile %s: %w", code, fromPile, ErrCardNotInPile)
+				}
+				if err := move(i); err != nil {
+					return nil, err
+				}
+				moved = append(moved, code)
+			}
+			return moved, w.recordMove(tx, deckId, fromPile, toPile, moved, positions)
+		}
+
+		if len(src) == 0 {
+			return nil, fmt.Errorf("pile %s: %w", fromPile, ErrPileEmpty)
+		}
+		for len(moved) < count && len(src) > 0 {
+			i := 0
+			if fromBottom {
+				i = len(src) - 1
+			}
+			moved = append(moved, src[i].code)
+			if err := move(i); err != nil {
+				return nil, err
+			}
+		}
+		return moved, w.recordMove(tx, deckId, fromPile, toPile, moved, positions)
+	})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.Data.([]string), nil
+}
+
+// recordMove journalise le deplacement de cartes d'une pile vers une autre, prises aux
+// index positions de la pile source, et emet ses evenements
+func (w *WorkerPool) recordMove(q querier, deckId, fromPile, toPile string, moved []string, positions []int) error {
+	if err := w.logAction(q, deckId, Action{Action: ActionPileDraw, Pile: fromPile, Cards: moved, Positions: positions}); err != nil {
+		return err
+	}
+	if err := w.logAction(q, deckId, Action{Action: ActionPileInsert, Pile: toPile, Cards: moved}); err != nil {
+		return err
+	}
+	if err := w.emit(q, deckId, EventPileDrawn, fromPile, moved); err != nil {
+		return err
+	}
+	return w.emit(q, deckId, EventPileAdded, toPile, moved)
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"slices"
+)
+
+// PeekDeck retourne les count cartes du dessus de la pioche sans les tirer,
+// dans l'ordre ou elles seraient tirees, ainsi que le nombre de cartes restantes
+func (w *WorkerPool) PeekDeck(deckId string, count int) ([]string, int, error) {
+	resp := w.read(func(q querier) (interface{}, error) {
+		if err := w.checkDeck(q, deckId); err != nil {
+			return nil, err
+		}
+		return deckChain(q, deckId)
+	})
+	if resp.Err != nil {
+		return nil, 0, resp.Err
+	}
+	cards := resp.Data.([]chainCard)
+	return chainCodes(cards[:min(count, len(cards))]), len(cards), nil
+}
+
+// PeekPile retourne les count cartes du dessus (ou du dessous si fromBottom) d'une pile
+// sans les tirer, dans l'ordre ou elles seraient tirees, ainsi que le nombre de cartes de la pile
+func (w *WorkerPool) PeekPile(deckId, pileName string, count int, fromBottom bool) ([]string, int, error) {
+	resp := w.read(func(q querier) (interface{}, error) {
+		if err := w.checkDeck(q, deckId); err != nil {
+			return nil, err
+		}
+		pileId, err := pileID(q, deckId, pileName)
+		if err != nil {
+			return nil, err
+		}
+		return pileChain(q, pileId)
+	})
+	if resp.Err != nil {
+		return nil, 0, resp.Err
+	}
+	cards := resp.Data.([]chainCard)
+	if fromBottom {
+		slices.Reverse(cards)
+	}
+	return chainCodes(cards[:min(count, len(cards))]), len(cards), nil
+}
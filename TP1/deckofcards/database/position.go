@@ -0,0 +1,48 @@
+package database
+
+import (
+	"deckofcards/models"
+	"fmt"
+)
+
+// Position emplacement ou inserer les cartes remises dans la pioche: un index depuis
+// le dessus (0 = dessus) ou l'une des constantes PositionBottom et PositionRandom
+// Un index plus grand que la pioche place les cartes au dessous, les autres valeurs
+// negatives sont refusees avec ErrInvalidPosition
+type Position int
+
+const (
+	PositionTop    Position = 0
+	PositionBottom Position = -1
+	PositionRandom Position = -2
+)
+
+// check retourne ErrInvalidPosition pour un index negatif autre que PositionBottom et PositionRandom
+func (p Position) check() error {
+	if p < PositionRandom {
+		return fmt.Errorf("position %d: %w", p, ErrInvalidPosition)
+	}
+	return nil
+}
+
+// index retourne l'index d'insertion de la n-ieme carte remise (a partir de 0) dans une
+// pioche de size cartes. Les cartes remises ensemble gardent leur ordre, sauf au hasard
+func (p Position) index(n, size int, shuffler models.Shuffler) int {
+	switch p {
+	case PositionBottom:
+		return size
+	case PositionRandom:
+		return shuffler.Intn(size + 1)
+	default:
+		return min(int(p)+n, size)
+	}
+}
+
+// positionShuffler retourne le Shuffler du deck si p est PositionRandom, nil sinon
+// afin de ne pas avancer le compteur de melanges d'un deck avec graine inutilement
+func (w *WorkerPool) positionShuffler(q querier, deckId string, p Position) (models.Shuffler, error) {
+	if p != PositionRandom {
+		return nil, nil
+	}
+	return w.deckShuffler(q, deckId)
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"database/sql"
+	"deckofcards/models"
+	"fmt"
+)
+
+// deckSeed retourne la graine d'un deck, nil s'il n'en a pas
+func deckSeed(q querier, deckId string) (*int64, error) {
+	var seed sql.NullInt64
+	if err := q.QueryRow(`SELECT seed FROM Deck WHERE deckId = ?`, deckId).Scan(&seed); err != nil {
+		return nil, fmt.Errorf("echec de lecture de la graine: %w", err)
+	}
+	if !seed.Valid {
+		return nil, nil
+	}
+	return &seed.Int64, nil
+}
+
+// deckShuffler retourne le Shuffler a utiliser pour une operation aleatoire sur un deck
+// Pour un deck avec graine, chaque appel avance le compteur de melanges afin qu'une
+// meme suite d'operations rejoue toujours les memes tirages
+// doit etre appele sous le verrou d'ecriture
+func (w *WorkerPool) deckShuffler(q querier, deckId string) (models.Shuffler, error) {
+	var seed sql.NullInt64
+	var round uint64
+	err := q.QueryRow(`SELECT seed, shuffleCount FROM Deck WHERE deckId = ?`, deckId).Scan(&seed, &round)
+	if err != nil {
+		return nil, fmt.Errorf("echec de lecture de la graine: %w", err)
+	}
+	if !seed.Valid {
+		return w.shuffler, nil
+	}
+	if _, err := q.Exec(`UPDATE Deck SET shuffleCount = shuffleCount + 1 WHERE deckId = ?`, deckId); err != nil {
+		return nil, fmt.Errorf("echec de mise a jour de shuffleCount: %w", err)
+	}
+	return models.NewSeededShuffler(seed.Int64, round), nil
+}
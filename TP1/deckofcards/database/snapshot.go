@@ -0,0 +1,180 @@
+package database
+
+import (
+	"database/sql"
+	"deckofcards/models"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SnapshotVersion version du format de Snapshot produit par ce serveur
+const SnapshotVersion = 1
+
+// Snapshot document json d'une position de jeu: pioche, piles et inventaire d'un deck
+// Il peut etre restaure plus tard sous un nouvel identifiant
+type Snapshot struct {
+	Version      int                      `json:"version"`
+	DeckId       string                   `json:"deck_id"` //< deck d'origine
+	TakenAt      time.Time                `json:"taken_at"`
+	Shuffled     bool                     `json:"shuffled"`
+	Seed         *int64                   `json:"seed,omitempty"`
+	ShuffleCount int64                    `json:"shuffle_count"`
+	NPackets     int                      `json:"n_packets,omitempty"` //< 0 pour un deck personnalise
+	Cards        []string                 `json:"cards"`               //< pioche du dessus vers le dessous
+	Piles        map[string][]string      `json:"piles"`               //< cartes de chaque pile du dessus vers le dessous
+	Entries      map[string]SnapshotEntry `json:"entries"`
+}
+
+// SnapshotEntry compteurs DeckEntry d'un code dans un Snapshot
+type SnapshotEntry struct {
+	Total  int `json:"total"`
+	InDeck int `json:"in_deck"`
+	InPile int `json:"in_pile"`
+}
+
+// Snapshot Retourne la position de jeu actuelle d'un deck sans le modifier
+func (w *WorkerPool) Snapshot(deckId string) (*Snapshot, error) {
+	resp := w.read(func(q querier) (interface{}, error) {
+		if err := w.checkDeck(q, deckId); err != nil {
+			return nil, err
+		}
+
+		snap := &Snapshot{Version: SnapshotVersion, DeckId: deckId, TakenAt: w.now().UTC(), Piles: map[string][]string{}}
+		err := q.QueryRow(`SELECT shuffled, seed, shuffleCount, nPackets FROM Deck WHERE deckId = ?`, deckId).
+			Scan(&snap.Shuffled, &snap.Seed, &snap.ShuffleCount, &snap.NPackets)
+		if err != nil {
+			return nil, fmt.Errorf("echec de lecture du deck: %w", err)
+		}
+		cards, err := deckChain(q, deckId)
+		if err != nil {
+			return nil, err
+		}
+		snap.Cards = chainCodes(cards)
+
+		piles, err := listPiles(q, deckId)
+		if err != nil {
+			return nil, err
+		}
+		for name := range piles {
+			pileId, err := pileID(q, deckId, name)
+			if err != nil {
+				return nil, err
+			}
+			cards, err := pileChain(q, pileId)
+			if err != nil {
+				return nil, err
+			}
+			snap.Piles[name] = chainCodes(cards)
+		}
+
+		entries, err := deckEntries(q, deckId)
+		if err != nil {
+			return nil, err
+		}
+		snap.Entries = make(map[string]SnapshotEntry, len(entries))
+		for code, entry := range entries {
+			snap.Entries[code] = SnapshotEntry{Total: entry.Total, InDeck: entry.InDeck, InPile: entry.InPile}
+		}
+		return snap, nil
+	})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.Data.(*Snapshot), nil
+}
+
+// Validate verifie qu'un snapshot est coherent: version connue, codes valides et
+// compteurs DeckEntry egaux aux cartes de la pioche et des piles
+func (s *Snapshot) Validate() error {
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("version %d: %w", s.Version, ErrInvalidSnapshot)
+	}
+	if s.NPackets < 0 {
+		return fmt.Errorf("n_packets %d: %w", s.NPackets, ErrInvalidSnapshot)
+	}
+	inDeck := make(map[string]int)
+	inPile := make(map[string]int)
+	for _, code := range s.Cards {
+		inDeck[code]++
+	}
+	for name, cards := range s.Piles {
+		if name == "" {
+			return fmt.Errorf("pile sans nom: %w", ErrInvalidSnapshot)
+		}
+		for _, code := range cards {
+			inPile[code]++
+		}
+	}
+	for code := range inDeck {
+		if _, ok := s.Entries[code]; !ok {
+			return fmt.Errorf("carte %s sans inventaire: %w", code, ErrInvalidSnapshot)
+		}
+	}
+	for code := range inPile {
+		if _, ok := s.Entries[code]; !ok {
+			return fmt.Errorf("carte %s sans inventaire: %w", code, ErrInvalidSnapshot)
+		}
+	}
+	for code, entry := range s.Entries {
+		if !models.CodeValid(code) {
+			return fmt.Errorf("carte %s: %w", code, ErrInvalidSnapshot)
+		}
+		if entry.InDeck != inDeck[code] || entry.InPile != inPile[code] || entry.Total < entry.InDeck+entry.InPile || entry.Total <= 0 {
+			return fmt.Errorf("inventaire de %s incoherent: %w", code, ErrInvalidSnapshot)
+		}
+	}
+	return nil
+}
+
+// RestoreSnapshot Recree une position de jeu sous un nouveau deck et retourne son identifiant
+// La pioche est inseree comme par InsertDeck, puis les piles et l'inventaire sont repris
+func (w *WorkerPool) RestoreSnapshot(snap *Snapshot) (string, error) {
+	if err := snap.Validate(); err != nil {
+		return "", err
+	}
+	resp := w.transaction(func(tx *sql.Tx) (interface{}, error) {
+		deckId, err := w.insertDeckTx(tx, &models.Deck{Cards: snap.Cards, NPackets: snap.NPackets, Shuffled: snap.Shuffled, Seed: snap.Seed})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`UPDATE Deck SET shuffleCount = ? WHERE deckId = ?`, snap.ShuffleCount, deckId); err != nil {
+			return nil, fmt.Errorf("echec de mise a jour du deck: %w", err)
+		}
+
+		// Les compteurs sont ecrits avant les piles, insertPileCard incremente inPile
+		for code, entry := range snap.Entries {
+			if _, err := tx.Exec(`
+				INSERT INTO DeckEntry (deckId, code, total, inDeck, inPile) VALUES (?, ?, ?, ?, 0)
+				ON CONFLICT(deckId, code) DO UPDATE SET total = excluded.total, inDeck = excluded.inDeck, inPile = 0`,
+				deckId, code, entry.Total, entry.InDeck); err != nil {
+				return nil, fmt.Errorf("echec d'insertion de DeckEntry: %w", err)
+			}
+		}
+		names := make([]string, 0, len(snap.Piles))
+		for name := range snap.Piles {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			pileId, err := ensurePile(tx, deckId, name)
+			if err != nil {
+				return nil, err
+			}
+			var cards []chainCard
+			codes := snap.Piles[name]
+			for i := len(codes) - 1; i >= 0; i-- {
+				if cards, err = insertPileCard(tx, deckId, pileId, cards, codes[i]); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		restored := Action{Action: ActionRestore, Cards: snap.Cards, Piles: snap.Piles}
+		return deckId, w.logAction(tx, deckId, restored)
+	})
+	if resp.Err != nil {
+		return "", resp.Err
+	}
+	return resp.Data.(string), nil
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"fmt"
+)
+
+// DeckEntry inventaire d'un code de carte dans un deck
+type DeckEntry struct {
+	Total  int //< nombre d'exemplaires du code dans le deck
+	InDeck int //< exemplaires encore dans la pioche
+	InPile int //< exemplaires places dans une pile
+	Drawn  int //< exemplaires tires et places nulle part
+}
+
+// DeckState etat d'un deck a un instant donne
+type DeckState struct {
+	DeckId    string
+	Remaining int                  //< cartes dans la pioche
+	Shuffled  bool                 //< si le deck a deja ete melange
+	Seed      *int64               //< graine des melanges, nil si imprevisible
+	Piles     map[string]int       //< nombre de cartes par pile
+	Drawn     int                  //< cartes tirees et placees dans aucune pile
+	Entries   map[string]DeckEntry //< inventaire par code
+	Cards     []string             //< pioche du dessus vers le dessous, seulement si demandee
+	LastEvent int64                //< id du dernier evenement du deck, 0 si aucun
+}
+
+// DeckState retourne l'etat d'un deck sans le modifier
+// reveal ajoute l'ordre des cartes restantes en parcourant la chaine DeckCard.nextId
+func (w *WorkerPool) DeckState(deckId string, reveal bool) (*DeckState, error) {
+	resp := w.read(func(q querier) (interface{}, error) {
+		if err := w.checkDeck(q, deckId); err != nil {
+			return nil, err
+		}
+
+		state := &DeckState{DeckId: deckId}
+		if err := q.QueryRow(`SELECT COUNT(*) FROM DeckCard WHERE deckId = ?`, deckId).Scan(&state.Remaining); err != nil {
+			return nil, fmt.Errorf("echec de lecture du deck: %w", err)
+		}
+		if err := q.QueryRow(`SELECT shuffled FROM Deck WHERE deckId = ?`, deckId).Scan(&state.Shuffled); err != nil {
+			return nil, fmt.Errorf("echec de lecture du deck: %w", err)
+		}
+		var err error
+		if state.Seed, err = deckSeed(q, deckId); err != nil {
+			return nil, err
+		}
+		if state.Piles, err = listPiles(q, deckId); err != nil {
+			return nil, err
+		}
+		if state.Entries, err = deckEntries(q, deckId); err != nil {
+			return nil, err
+		}
+		for _, entry := range state.Entries {
+			state.Drawn += entry.Drawn
+		}
+		if err := q.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM DeckEvent WHERE deckId = ?`, deckId).Scan(&state.LastEvent); err != nil {
+			return nil, fmt.Errorf("echec de lecture des evenements: %w", err)
+		}
+
+		if reveal {
+			cards, err := deckChain(q, deckId)
+			if err != nil {
+				return nil, err
+			}
+			state.Cards = chainCodes(cards)
+		}
+		return state, nil
+	})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.Data.(*DeckState), nil
+}
+
+// deckEntries retourne l'inventaire DeckEntry d'un deck par code
+func deckEntries(q querier, deckId string) (map[string]DeckEntry, error) {
+	rows, err := q.Query(`SELECT code, total, inDeck, inPile FROM DeckEntry WHERE deckId = ?`, deckId)
+	if err != nil {
+		return nil, fmt.Errorf("echec de lecture de DeckEntry: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make(map[string]DeckEntry)
+	for rows.Next() {
+		var code string
+		var entry DeckEntry
+		if err := rows.Scan(&code, &entry.Total, &entry.InDeck, &entry.InPile); err != nil {
+			return nil, fmt.Errorf("echec de lecture de DeckEntry: %w", err)
+		}
+		entry.Drawn = entry.Total - entry.InDeck - entry.InPile
+		entries[code] = entry
+	}
+	return entries, rows.Err()
+}
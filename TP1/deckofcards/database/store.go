@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"deckofcards/models"
+	"time"
+)
+
+// Store stockage des decks, de leurs piles et de leurs cartes tirees
+// Le WorkerPool l'implemente sur SQLite et MemoryStore entierement en memoire; les deux
+// passent les memes tests de conformite. Chaque methode est atomique
+type Store interface {
+	InsertDeck(deck *models.Deck) (string, error)
+	DeleteDeck(deckId string) error
+	CardsInDeck(deckId string) (uint64, error)
+	DrawCards(deckId string, amount int) ([]string, int, error)
+	ShuffleDeck(deckId string) (*models.Deck, error)
+
+	InsertIntoPile(name string, deckId string, codes []string) (models.Deck, error)
+	GetPileCards(deckId, pileName string) ([]string, int, error)
+	CardsInPile(deckId string, pileName string) (uint64, error)
+	ListPiles(deckId string) (map[string]int, error)
+	DrawFromPile(deckId, pileName, method string) (string, error)
+	DeletePile(deckId, pileName string) (int, error)
+
+	ReturnSpecificDrawn(deckId, code string, pos Position) (string, error)
+	ReturnSpecificDrawnMany(deckId string, codes []string, pos Position) error
+	ReturnAllDrawn(deckId string, pos Position) error
+	ReturnSpecificFromPile(deckId, pileName, code string, pos Position) (string, error)
+	ReturnSpecificFromPileMany(deckId, pileName string, codes []string, pos Position) error
+	ReturnAllFromPile(deckId, pileName string, pos Position) error
+
+	Close()
+}
+
+// Backend Store complet dont dependent l'api et le serveur: tirages par methode,
+// deplacements, lots, historique annulable, journal, evenements, snapshots et duree
+// de vie des decks. Le WorkerPool et MemoryStore l'implementent tous les deux
+type Backend interface {
+	Store
+
+	InsertDeckAndDraw(deck *models.Deck, count int) (string, []string, int, error)
+	DrawCardsFrom(deckId, method string, count int) ([]string, int, error)
+	DrawSpecificFromDeck(deckId string, codes []string) ([]string, int, error)
+	ShuffleDeckSeeded(deckId string, seed int64) (*models.Deck, error)
+	ShuffleDeckAndPiles(deckId string, seed *int64) (*models.Deck, map[string]int, error)
+	PeekDeck(deckId string, count int) ([]string, int, error)
+	DeckState(deckId string, reveal bool) (*DeckState, error)
+	Deal(deckId string, piles []string, count int, mode string) (map[string][]string, int, error)
+	BatchAs(deckId, actor string, ops []BatchOp) ([]BatchResult, int, error)
+	As(actor string) Backend
+
+	DrawFromPileN(deckId, pileName, method string, count int) ([]string, error)
+	DrawSpecificFromPileMany(deckId, pileName string, codes []string) error
+	PeekPile(deckId, pileName string, count int, fromBottom bool) ([]string, int, error)
+	ShufflePile(deckId, pileName string) ([]string, error)
+	ShuffleAllPiles(deckId string) (map[string]int, error)
+	MovePileCards(deckId, fromPile, toPile string, codes []string, count int, fromBottom bool) ([]string, error)
+
+	Undo(deckId string) (string, error)
+	Redo(deckId string) (string, error)
+	ActionLog(deckId string, afterId int64, limit int) ([]Action, error)
+	Replay(deckId string, untilId int64) (*GameState, error)
+	Snapshot(deckId string) (*Snapshot, error)
+	RestoreSnapshot(snap *Snapshot) (string, error)
+
+	Events(deckId string, afterId int64, limit int) ([]Event, error)
+	Subscribe(deckId string) (<-chan Event, func())
+	CloseSubscriptions()
+
+	TouchDeck(deckId string) error
+	StartJanitor(ctx context.Context, interval time.Duration, batchSize int)
+	Drain(ctx context.Context) error
+}
+
+var (
+	_ Backend = (*WorkerPool)(nil)
+	_ Backend = (*MemoryStore)(nil)
+)
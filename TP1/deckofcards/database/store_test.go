@@ -0,0 +1,512 @@
+package database
+
+import (
+	"context"
+	"deckofcards/models"
+	"deckofcards/utils"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stores implementations de Backend soumises aux tests de conformite
+var stores = map[string]func(t *testing.T) Backend{
+	"sqlite": func(t *testing.T) Backend {
+		handler, wp, _ := setupConcurrencyTestDB(t)
+		t.Cleanup(func() {
+			wp.Close()
+			handler.db.Close()
+		})
+		return wp
+	},
+	"memory": func(t *testing.T) Backend {
+		return NewMemoryStore(utils.DefaultConfig())
+	},
+}
+
+func TestStoreConformance(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("DrawAndPiles", func(t *testing.T) { testStoreDrawAndPiles(t, newStore(t)) })
+			t.Run("Returns", func(t *testing.T) { testStoreReturns(t, newStore(t)) })
+			t.Run("Errors", func(t *testing.T) { testStoreErrors(t, newStore(t)) })
+			t.Run("ConcurrentDraws", func(t *testing.T) { testStoreConcurrentDraws(t, newStore(t)) })
+		})
+	}
+}
+
+// TestStoreConformance_SeededSameResults les decks avec graine donnent les memes cartes
+// dans toutes les implementations
+func TestStoreConformance_SeededSameResults(t *testing.T) {
+	run := func(s Store) []string {
+		seed := int64(2024)
+		deckId, err := s.InsertDeck(&models.Deck{Cards: models.NewMultiDeck(1, true).Cards, Seed: &seed})
+		if err != nil {
+			t.Fatalf("InsertDeck: %v", err)
+		}
+		shuffled, err := s.ShuffleDeck(deckId)
+		if err != nil {
+			t.Fatalf("ShuffleDeck: %v", err)
+		}
+		drawn, _, _ := s.DrawCards(deckId, 10)
+		_, _ = s.InsertIntoPile("hand", deckId, drawn)
+		picked, err := s.DrawFromPile(deckId, "hand", "random")
+		if err != nil {
+			t.Fatalf("DrawFromPile: %v", err)
+		}
+		if err := s.ReturnAllFromPile(deckId, "hand", PositionRandom); err != nil {
+			t.Fatalf("ReturnAllFromPile: %v", err)
+		}
+		cards, _, _ := s.DrawCards(deckId, 60)
+		return slices.Concat(shuffled.Cards, []string{picked}, cards)
+	}
+
+	var want []string
+	for name, newStore := range stores {
+		got := run(newStore(t))
+		if want == nil {
+			want = got
+		} else if !slices.Equal(got, want) {
+			t.Errorf("%s: seeded game = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// TestBackendConformance_SeededGame une meme partie avec graine donne le meme etat,
+// le meme journal et les memes evenements dans toutes les implementations, annulations comprises
+func TestBackendConformance_SeededGame(t *testing.T) {
+	run := func(t *testing.T, s Backend) []string {
+		var out []string
+		record := func(format string, args ...interface{}) { out = append(out, fmt.Sprintf(format, args...)) }
+		check := func(what string, err error) {
+			t.Helper()
+			if err != nil {
+				t.Fatalf("%s: %v", what, err)
+			}
+		}
+
+		seed := int64(7)
+		deckId, codes, remaining, err := s.InsertDeckAndDraw(&models.Deck{Cards: models.NewMultiDeck(1, false).Cards, Seed: &seed}, 3)
+		check("InsertDeckAndDraw", err)
+		record("created %v %d", codes, remaining)
+		shuffled, err := s.ShuffleDeck(deckId)
+		check("ShuffleDeck", err)
+		record("shuffle %v", shuffled.Cards)
+		drawn, _, err := s.DrawCardsFrom(deckId, "random", 4)
+		check("DrawCardsFrom", err)
+		record("draw %v", drawn)
+		dealt, _, err := s.Deal(deckId, []string{"north", "south"}, 3, "roundrobin")
+		check("Deal", err)
+		record("deal %v", dealt)
+		moved, err := s.MovePileCards(deckId, "north", "south", nil, 2, true)
+		check("MovePileCards", err)
+		record("move %v", moved)
+		_, err = s.InsertIntoPile("table", deckId, drawn[:2])
+		check("InsertIntoPile", err)
+		counts, err := s.ShuffleAllPiles(deckId)
+		check("ShuffleAllPiles", err)
+		south, _, _ := s.GetPileCards(deckId, "south")
+		record("piles %v south %v", counts, south)
+
+		bottom, _, err := s.DrawCardsFrom(deckId, "bottom", 2)
+		check("DrawCardsFrom", err)
+		results, _, err := s.BatchAs(deckId, "alice", []BatchOp{
+			{Op: "addToPile", Pile: "table", Cards: bottom},
+			{Op: "shuffle", Pile: "table"},
+			{Op: "drawPile", Pile: "table", Count: 2, Method: "random"},
+			{Op: "return", Pile: "north", Position: PositionRandom},
+		})
+		check("BatchAs", err)
+		record("batch %v", results)
+		picked, err := s.DrawFromPileN(deckId, "south", "random", 2)
+		check("DrawFromPileN", err)
+		record("pile draw %v", picked)
+		check("ReturnSpecificDrawnMany", s.ReturnSpecificDrawnMany(deckId, picked, PositionBottom))
+		_, err = s.DeletePile(deckId, "north")
+		check("DeletePile", err)
+
+		for _, undo := range []bool{true, true, true, false} {
+			travel := s.Redo
+			if undo {
+				travel = s.Undo
+			}
+			action, err := travel(deckId)
+			check("Undo/Redo", err)
+			record("undo=%v %s", undo, action)
+		}
+		_, err = s.ShuffleDeckSeeded(deckId, 99)
+		check("ShuffleDeckSeeded", err)
+		check("ReturnAllDrawn", s.ReturnAllDrawn(deckId, PositionRandom))
+		peek, _, err := s.PeekDeck(deckId, 3)
+		check("PeekDeck", err)
+		top, _, err := s.PeekPile(deckId, "south", 2, true)
+		check("PeekPile", err)
+		record("peek %v south %v", peek, top)
+
+		state, err := s.DeckState(deckId, true)
+		check("DeckState", err)
+		record("state %d %v %d %v %v %v", state.Remaining, *state.Seed, state.Drawn, state.Piles, state.Entries, state.Cards)
+		actions, err := s.ActionLog(deckId, 0, 1000)
+		check("ActionLog", err)
+		for _, a := range actions {
+			record("action %s %s %s %v %v %v %v %v", a.Action, a.Pile, a.Actor, a.Cards, a.Positions, a.From, a.Permutation, a.Piles)
+		}
+		events, err := s.Events(deckId, 0, 1000)
+		check("Events", err)
+		for _, e := range events {
+			record("event %s %s %v", e.Type, e.Pile, e.Cards)
+		}
+
+		// Le journal rejoue redonne la position actuelle
+		replayed, err := s.Replay(deckId, 0)
+		check("Replay", err)
+		if !slices.Equal(replayed.Cards, state.Cards) || len(replayed.Piles) != len(state.Piles) {
+			t.Errorf("Replay = %v %v, want %v %v", replayed.Cards, replayed.Piles, state.Cards, state.Piles)
+		}
+		for name, n := range state.Piles {
+			if len(replayed.Piles[name]) != n {
+				t.Errorf("Replay pile %s = %v, want %d cards", name, replayed.Piles[name], n)
+			}
+		}
+
+		// Une position restauree est identique a l'originale
+		snap, err := s.Snapshot(deckId)
+		check("Snapshot", err)
+		restoredId, err := s.RestoreSnapshot(snap)
+		check("RestoreSnapshot", err)
+		restored, err := s.Snapshot(restoredId)
+		check("Snapshot", err)
+		if !slices.Equal(restored.Cards, snap.Cards) || fmt.Sprint(restored.Piles, restored.Entries, restored.ShuffleCount) != fmt.Sprint(snap.Piles, snap.Entries, snap.ShuffleCount) {
+			t.Errorf("restored snapshot = %+v, want %+v", restored, snap)
+		}
+		record("snapshot %d %v", snap.ShuffleCount, snap.Piles)
+
+		// La suppression est le dernier evenement du deck, l'abonnement se ferme aussitot
+		sub, cancel := s.Subscribe(deckId)
+		defer cancel()
+		check("DeleteDeck", s.DeleteDeck(deckId))
+		deleted, ok := <-sub
+		if _, open := <-sub; !ok || open || deleted.Type != EventDeckDeleted || deleted.Id <= events[len(events)-1].Id {
+			t.Errorf("after DeleteDeck received %+v (ok=%v), then open=%v; want a last deck_deleted event", deleted, ok, open)
+		}
+		return out
+	}
+
+	var want []string
+	var wantName string
+	for name, newStore := range stores {
+		got := run(t, newStore(t))
+		if want == nil {
+			want, wantName = got, name
+			continue
+		}
+		for i := range max(len(got), len(want)) {
+			if i >= len(got) || i >= len(want) || got[i] != want[i] {
+				t.Fatalf("%s and %s diverge at step %d:\n%s: %v\n%s: %v", name, wantName, i, name, got[min(i, len(got)-1)], wantName, want[min(i, len(want)-1)])
+			}
+		}
+	}
+}
+
+// TestBackendConformance_ShuffleUndo un melange de la pioche et des piles est annule d'un seul Undo,
+// avec ou sans piles
+func TestBackendConformance_ShuffleUndo(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newStore(t)
+			for _, piles := range [][]string{nil, {"north", "south"}} {
+				deckId, err := s.InsertDeck(models.NewMultiDeck(1, false))
+				if err != nil {
+					t.Fatalf("InsertDeck: %v", err)
+				}
+				if len(piles) > 0 {
+					if _, _, err := s.Deal(deckId, piles, 3, "roundrobin"); err != nil {
+						t.Fatalf("Deal: %v", err)
+					}
+				}
+				before, err := s.Snapshot(deckId)
+				if err != nil {
+					t.Fatalf("Snapshot: %v", err)
+				}
+				seed := int64(5)
+				_, counts, err := s.ShuffleDeckAndPiles(deckId, &seed)
+				if err != nil || len(counts) != len(piles) {
+					t.Fatalf("ShuffleDeckAndPiles = %v, %v; want %d piles", counts, err, len(piles))
+				}
+				if action, err := s.Undo(deckId); err != nil || action != "shuffle" {
+					t.Fatalf("Undo = %q, %v; want shuffle", action, err)
+				}
+				after, err := s.Snapshot(deckId)
+				if err != nil {
+					t.Fatalf("Snapshot: %v", err)
+				}
+				if !slices.Equal(after.Cards, before.Cards) || after.Shuffled || fmt.Sprint(after.Piles) != fmt.Sprint(before.Piles) {
+					t.Errorf("piles %v: after Undo = %v %v, want %v %v", piles, after.Cards, after.Piles, before.Cards, before.Piles)
+				}
+			}
+		})
+	}
+}
+
+// TestBackendConformance_As les actions faites par une vue As, annulations comprises,
+// sont inscrites au nom de son acteur sans changer celles du backend
+func TestBackendConformance_As(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newStore(t)
+			deckId, err := s.As("alice").InsertDeck(models.NewMultiDeck(1, false))
+			if err != nil {
+				t.Fatalf("InsertDeck: %v", err)
+			}
+			if _, _, err := s.As("bob").DrawCards(deckId, 2); err != nil {
+				t.Fatalf("DrawCards: %v", err)
+			}
+			if _, err := s.As("carol").Undo(deckId); err != nil {
+				t.Fatalf("Undo: %v", err)
+			}
+			if _, _, err := s.DrawCards(deckId, 1); err != nil {
+				t.Fatalf("DrawCards: %v", err)
+			}
+			log, err := s.ActionLog(deckId, 0, 10)
+			if err != nil {
+				t.Fatalf("ActionLog: %v", err)
+			}
+			var actors []string
+			for _, a := range log {
+				actors = append(actors, a.Actor)
+			}
+			if want := []string{"alice", "bob", "carol", ""}; !slices.Equal(actors, want) {
+				t.Errorf("actors = %q, want %q", actors, want)
+			}
+		})
+	}
+}
+
+func TestMemoryStore_ExpiryAndDrain(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.DeckTTL = utils.Duration{Duration: time.Hour}
+	m := NewMemoryStore(cfg)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	expired, _ := m.InsertDeck(models.NewMultiDeck(1, false))
+	active, _ := m.InsertDeck(models.NewMultiDeck(1, false))
+
+	now = now.Add(50 * time.Minute)
+	if err := m.TouchDeck(active); err != nil {
+		t.Fatalf("TouchDeck: %v", err)
+	}
+	now = now.Add(20 * time.Minute)
+	if _, _, err := m.DrawCards(expired, 1); !errors.Is(err, ErrDeckExpired) {
+		t.Errorf("DrawCards on expired deck error = %v, want ErrDeckExpired", err)
+	}
+	if purged, err := m.PurgeExpired(10); err != nil || purged != 1 {
+		t.Errorf("PurgeExpired = %d, %v; want 1", purged, err)
+	}
+	if _, err := m.CardsInDeck(expired); !errors.Is(err, ErrDeckNotFound) {
+		t.Errorf("CardsInDeck on purged deck error = %v, want ErrDeckNotFound", err)
+	}
+
+	if err := m.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if _, _, err := m.DrawCards(active, 1); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("DrawCards after Drain error = %v, want ErrPoolClosed", err)
+	}
+}
+
+func testStoreDrawAndPiles(t *testing.T, s Store) {
+	deckId, err := s.InsertDeck(models.NewMultiDeck(1, false))
+	if err != nil {
+		t.Fatalf("InsertDeck: %v", err)
+	}
+	drawn, remaining, err := s.DrawCards(deckId, 5)
+	if err != nil || remaining != 47 || !slices.Equal(drawn, []string{"AS", "AH", "AD", "AC", "2S"}) {
+		t.Fatalf("DrawCards = %v, %d, %v; want the 5 top cards and 47 remaining", drawn, remaining, err)
+	}
+
+	deck, err := s.InsertIntoPile("hand", deckId, drawn[:3])
+	if err != nil || deck.Remaining != 47 || deck.Piles["hand"].Remaining != 3 {
+		t.Fatalf("InsertIntoPile = %+v, %v", deck, err)
+	}
+	// La derniere carte posee est sur le dessus
+	if cards, n, err := s.GetPileCards(deckId, "hand"); err != nil || n != 3 || !slices.Equal(cards, []string{"AD", "AH", "AS"}) {
+		t.Fatalf("GetPileCards = %v, %d, %v; want [AD AH AS]", cards, n, err)
+	}
+	if _, err := s.InsertIntoPile("empty", deckId, nil); err != nil {
+		t.Fatalf("InsertIntoPile without cards: %v", err)
+	}
+	if piles, err := s.ListPiles(deckId); err != nil || len(piles) != 2 || piles["hand"] != 3 || piles["empty"] != 0 {
+		t.Fatalf("ListPiles = %v, %v", piles, err)
+	}
+
+	if code, err := s.DrawFromPile(deckId, "hand", "bottom"); err != nil || code != "AS" {
+		t.Errorf("DrawFromPile bottom = %s, %v; want AS", code, err)
+	}
+	if code, err := s.DrawFromPile(deckId, "hand", "top"); err != nil || code != "AD" {
+		t.Errorf("DrawFromPile top = %s, %v; want AD", code, err)
+	}
+	if n, err := s.CardsInPile(deckId, "hand"); err != nil || n != 1 {
+		t.Errorf("CardsInPile = %d, %v; want 1", n, err)
+	}
+	if released, err := s.DeletePile(deckId, "hand"); err != nil || released != 1 {
+		t.Errorf("DeletePile = %d, %v; want 1", released, err)
+	}
+
+	shuffled, err := s.ShuffleDeck(deckId)
+	if err != nil || !shuffled.Shuffled || len(shuffled.Cards) != 47 {
+		t.Fatalf("ShuffleDeck = %+v, %v", shuffled, err)
+	}
+	if n, err := s.CardsInDeck(deckId); err != nil || n != 47 {
+		t.Errorf("CardsInDeck = %d, %v; want 47", n, err)
+	}
+	if _, remaining, err := s.DrawCards(deckId, 100); err != nil || remaining != 0 {
+		t.Errorf("DrawCards(100) = %d remaining, %v; want the whole deck", remaining, err)
+	}
+
+	if err := s.DeleteDeck(deckId); err != nil {
+		t.Fatalf("DeleteDeck: %v", err)
+	}
+	if _, err := s.CardsInDeck(deckId); !errors.Is(err, ErrDeckNotFound) {
+		t.Errorf("CardsInDeck after DeleteDeck = %v, want ErrDeckNotFound", err)
+	}
+}
+
+func testStoreReturns(t *testing.T, s Store) {
+	deckId, err := s.InsertDeck(models.NewMultiDeck(1, false))
+	if err != nil {
+		t.Fatalf("InsertDeck: %v", err)
+	}
+	drawn, _, _ := s.DrawCards(deckId, 6)
+
+	if code, err := s.ReturnSpecificDrawn(deckId, drawn[0], PositionBottom); err != nil || code != drawn[0] {
+		t.Fatalf("ReturnSpecificDrawn = %s, %v", code, err)
+	}
+	if err := s.ReturnSpecificDrawnMany(deckId, drawn[1:3], PositionTop); err != nil {
+		t.Fatalf("ReturnSpecificDrawnMany: %v", err)
+	}
+	cards, _, _ := s.DrawCards(deckId, 2)
+	if !slices.Equal(cards, drawn[1:3]) {
+		t.Errorf("top after returning %v = %v", drawn[1:3], cards)
+	}
+	if err := s.ReturnAllDrawn(deckId, PositionTop); err != nil {
+		t.Fatalf("ReturnAllDrawn: %v", err)
+	}
+	if n, _ := s.CardsInDeck(deckId); n != 52 {
+		t.Errorf("CardsInDeck after ReturnAllDrawn = %d, want 52", n)
+	}
+
+	drawn, _, _ = s.DrawCards(deckId, 4)
+	if _, err := s.InsertIntoPile("hand", deckId, drawn); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+	if code, err := s.ReturnSpecificFromPile(deckId, "hand", drawn[1], PositionTop); err != nil || code != drawn[1] {
+		t.Fatalf("ReturnSpecificFromPile = %s, %v", code, err)
+	}
+	if err := s.ReturnSpecificFromPileMany(deckId, "hand", []string{drawn[0]}, PositionRandom); err != nil {
+		t.Fatalf("ReturnSpecificFromPileMany: %v", err)
+	}
+	if err := s.ReturnAllFromPile(deckId, "hand", PositionBottom); err != nil {
+		t.Fatalf("ReturnAllFromPile: %v", err)
+	}
+	if n, _ := s.CardsInPile(deckId, "hand"); n != 0 {
+		t.Errorf("CardsInPile after ReturnAllFromPile = %d, want 0", n)
+	}
+	if n, _ := s.CardsInDeck(deckId); n != 52 {
+		t.Errorf("CardsInDeck after the returns = %d, want 52", n)
+	}
+}
+
+func testStoreErrors(t *testing.T, s Store) {
+	if _, _, err := s.DrawCards("missing", 1); !errors.Is(err, ErrDeckNotFound) {
+		t.Errorf("DrawCards on missing deck = %v, want ErrDeckNotFound", err)
+	}
+	if err := s.DeleteDeck("missing"); !errors.Is(err, ErrDeckNotFound) {
+		t.Errorf("DeleteDeck on missing deck = %v, want ErrDeckNotFound", err)
+	}
+
+	deckId, err := s.InsertDeck(models.NewMultiDeck(1, false))
+	if err != nil {
+		t.Fatalf("InsertDeck: %v", err)
+	}
+	if _, err := s.InsertIntoPile("hand", deckId, []string{"AS"}); !errors.Is(err, ErrCardNotDrawn) {
+		t.Errorf("InsertIntoPile of a card in the deck = %v, want ErrCardNotDrawn", err)
+	}
+	if _, err := s.InsertIntoPile("hand", deckId, []string{"ZR"}); !errors.Is(err, ErrCardNotInDeck) {
+		t.Errorf("InsertIntoPile of a foreign card = %v, want ErrCardNotInDeck", err)
+	}
+	if _, _, err := s.GetPileCards(deckId, "missing"); !errors.Is(err, ErrPileNotFound) {
+		t.Errorf("GetPileCards on missing pile = %v, want ErrPileNotFound", err)
+	}
+	if _, err := s.DeletePile(deckId, "missing"); !errors.Is(err, ErrPileNotFound) {
+		t.Errorf("DeletePile on missing pile = %v, want ErrPileNotFound", err)
+	}
+
+	drawn, _, _ := s.DrawCards(deckId, 2)
+	if _, err := s.InsertIntoPile("hand", deckId, drawn[:1]); err != nil {
+		t.Fatalf("InsertIntoPile: %v", err)
+	}
+	if _, err := s.DrawFromPile(deckId, "hand", "middle"); !errors.Is(err, ErrInvalidMethod) {
+		t.Errorf("DrawFromPile with unknown method = %v, want ErrInvalidMethod", err)
+	}
+	if _, err := s.ReturnSpecificFromPile(deckId, "hand", drawn[1], PositionTop); !errors.Is(err, ErrCardNotInPile) {
+		t.Errorf("ReturnSpecificFromPile of a card not in the pile = %v, want ErrCardNotInPile", err)
+	}
+	// Une erreur sur la deuxieme carte n'en remet aucune
+	if err := s.ReturnSpecificDrawnMany(deckId, []string{drawn[1], drawn[0]}, PositionTop); !errors.Is(err, ErrCardNotDrawn) {
+		t.Errorf("ReturnSpecificDrawnMany of a card in a pile = %v, want ErrCardNotDrawn", err)
+	}
+	for _, pos := range []Position{-3, -100} {
+		if err := s.ReturnSpecificDrawnMany(deckId, drawn[1:], pos); !errors.Is(err, ErrInvalidPosition) {
+			t.Errorf("ReturnSpecificDrawnMany at position %d = %v, want ErrInvalidPosition", pos, err)
+		}
+		if err := s.ReturnAllFromPile(deckId, "hand", pos); !errors.Is(err, ErrInvalidPosition) {
+			t.Errorf("ReturnAllFromPile at position %d = %v, want ErrInvalidPosition", pos, err)
+		}
+	}
+	if n, _ := s.CardsInDeck(deckId); n != 50 {
+		t.Errorf("CardsInDeck after a failed return = %d, want 50", n)
+	}
+	if _, err := s.DrawFromPile(deckId, "hand", "top"); err != nil {
+		t.Fatalf("DrawFromPile: %v", err)
+	}
+	if _, err := s.DrawFromPile(deckId, "hand", "top"); !errors.Is(err, ErrPileEmpty) {
+		t.Errorf("DrawFromPile on empty pile = %v, want ErrPileEmpty", err)
+	}
+}
+
+func testStoreConcurrentDraws(t *testing.T, s Store) {
+	deckId, err := s.InsertDeck(models.NewMultiDeck(1, false))
+	if err != nil {
+		t.Fatalf("InsertDeck: %v", err)
+	}
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 26; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cards, _, err := s.DrawCards(deckId, 2)
+			if err != nil {
+				t.Errorf("DrawCards: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, code := range cards {
+				if seen[code] {
+					t.Errorf("card %s drawn twice", code)
+				}
+				seen[code] = true
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 52 {
+		t.Errorf("%d distinct cards drawn, want 52", len(seen))
+	}
+}
@@ -1,8 +1,14 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"deckofcards/models"
 	"deckofcards/utils"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 )
 
 const (
@@ -10,6 +16,9 @@ const (
 	READ
 )
 
+// ErrPoolClosed retournee lorsqu'une operation est soumise a un pool ferme
+var ErrPoolClosed = errors.New("worker pool closed")
+
 // / Reponse d'une operation de base de donnees
 type DBResponse struct {
 	Data interface{}
@@ -26,12 +35,41 @@ type DBOperation struct {
 }
 
 // / Pool de worker
+// Les vues retournees par As partagent le pool et ne different que par l'auteur de leurs actions
 type WorkerPool struct {
+	*workerPool
+	author string //< auteur inscrit au journal pour les operations de cette vue, vide si inconnu
+}
+
+// workerPool etat partage par un WorkerPool et ses vues
+type workerPool struct {
 	operations chan DBOperation
 	handler    *DBHandler
+	ttl        time.Duration    //< duree d'inactivite avant expiration d'un deck, 0 = jamais
+	now        func() time.Time //< horloge, remplacable dans les tests
+	shuffler   models.Shuffler  //< aleatoire des decks sans graine
+	bus        eventBus         //< abonnes aux evenements des decks
+	pending    []Event          //< evenements de la transaction en cours, sous le verrou d'ecriture
+	actor      string           //< auteur des actions de la transaction en cours, sous le verrou d'ecriture
+	changes    map[string]int64 //< entree DeckHistory de l'operation en cours par deck, sous le verrou d'ecriture
+
+	touchMu sync.Mutex
+	touched map[string]time.Time //< derniers acces des decks lus, pas encore ecrits dans lastAccessedAt
+
+	mu        sync.Mutex
+	draining  bool
+	inflight  int
+	idle      chan struct{}
+	workers   sync.WaitGroup
+	closeOnce sync.Once
 }
 
 func (w *WorkerPool) Execute(op WorkerOperation) DBResponse {
+	if !w.acquire() {
+		return DBResponse{Err: ErrPoolClosed}
+	}
+	defer w.release()
+
 	resp := make(chan DBResponse, 1)
 	w.operations <- DBOperation{
 		response:  resp,
@@ -40,13 +78,89 @@ func (w *WorkerPool) Execute(op WorkerOperation) DBResponse {
 	return <-resp
 }
 
-func Init(db *DBHandler) *WorkerPool {
-	w := &WorkerPool{
+// transaction execute fn dans un worker, sous le verrou d'ecriture et dans une
+// transaction sql validee seulement si fn ne retourne pas d'erreur
+// Les evenements emis par fn sont diffuses apres le commit
+func (w *WorkerPool) transaction(fn func(tx *sql.Tx) (interface{}, error)) DBResponse {
+	return w.Execute(func() DBResponse {
+		w.handler.Lock()
+		defer w.handler.UnLock()
+
+		tx, err := w.handler.db.Begin()
+		if err != nil {
+			return DBResponse{Err: fmt.Errorf("echec de demarrage de transaction: %w", err)}
+		}
+		w.actor = w.author
+		defer func() {
+			_ = tx.Rollback()
+			w.pending = nil
+			w.actor = ""
+			w.changes = nil
+		}()
+
+		data, err := fn(tx)
+		if err != nil {
+			return DBResponse{Err: err}
+		}
+		if err := tx.Commit(); err != nil {
+			return DBResponse{Err: fmt.Errorf("echec de commit: %w", err)}
+		}
+		w.bus.publish(w.pending)
+		return DBResponse{Data: data}
+	})
+}
+
+// read execute fn dans un worker sous le verrou de lecture, les ecritures
+// etant bloquees, les requetes de fn voient un etat coherent de la base
+func (w *WorkerPool) read(fn func(q querier) (interface{}, error)) DBResponse {
+	return w.Execute(func() DBResponse {
+		w.handler.RLock()
+		defer w.handler.RUnLock()
+
+		data, err := fn(w.handler.db)
+		return DBResponse{Data: data, Err: err}
+	})
+}
+
+// acquire enregistre une operation en cours, echoue si le pool est en vidange
+func (w *WorkerPool) acquire() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.draining {
+		return false
+	}
+	w.inflight++
+	return true
+}
+
+// release termine une operation en cours et reveille Drain si c'etait la derniere
+func (w *WorkerPool) release() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inflight--
+	if w.draining && w.inflight == 0 && w.idle != nil {
+		close(w.idle)
+		w.idle = nil
+	}
+}
+
+// Init demarre un pool de cfg.WorkerAmount workers
+func Init(db *DBHandler, cfg *utils.Config) *WorkerPool {
+	workers := cfg.WorkerAmount
+	if workers <= 0 {
+		workers = utils.WORKER_AMOUNT
+	}
+	w := &WorkerPool{workerPool: &workerPool{
 		operations: make(chan DBOperation),
 		handler:    db,
-	}
-	for i := 0; i < utils.WORKER_AMOUNT; i++ {
+		ttl:        cfg.DeckTTL.Duration,
+		now:        time.Now,
+		shuffler:   models.DefaultShuffler,
+	}}
+	for i := 0; i < workers; i++ {
+		w.workers.Add(1)
 		go func() {
+			defer w.workers.Done()
 			for operation := range w.operations {
 				func() {
 					defer func() {
@@ -64,6 +178,45 @@ func Init(db *DBHandler) *WorkerPool {
 	return w
 }
 
+// As retourne une vue du pool dont les operations inscrivent actor comme auteur
+// de leurs actions dans le journal ActionLog
+func (w *WorkerPool) As(actor string) Backend {
+	return &WorkerPool{workerPool: w.workerPool, author: actor}
+}
+
+// Drain refuse les nouvelles operations et attend la fin de celles en cours
+func (w *WorkerPool) Drain(ctx context.Context) error {
+	w.mu.Lock()
+	w.draining = true
+	if w.inflight == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	if w.idle == nil {
+		w.idle = make(chan struct{})
+	}
+	idle := w.idle
+	w.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close vide le pool puis arrete les workers
 func (w *WorkerPool) Close() {
-	close(w.operations)
+	_ = w.Drain(context.Background())
+	w.closeOnce.Do(func() {
+		close(w.operations)
+	})
+	w.workers.Wait()
+}
+
+// SetShuffler remplace la source d'aleatoire utilisee pour les decks sans graine
+// doit etre appele avant de soumettre des operations
+func (w *WorkerPool) SetShuffler(s models.Shuffler) {
+	w.shuffler = s
 }
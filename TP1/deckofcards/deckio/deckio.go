@@ -0,0 +1,108 @@
+// Package deckio lit et ecrit des decks dans un fichier json portable, pour les
+// deplacer entre serveurs ou les garder comme jeux de test
+package deckio
+
+import (
+	"crypto/sha256"
+	"deckofcards/database"
+	"deckofcards/models"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+const (
+	Format  = "deckofcards/deck" //< valeur du champ format d'un fichier de deck
+	Version = 2                  //< version du schema ecrite par ce package, 2 = enveloppe d'un snapshot
+)
+
+// Erreurs de lecture d'un fichier de deck, a comparer avec errors.Is
+var (
+	ErrInvalidFile = errors.New("invalid deck file")
+	ErrChecksum    = errors.New("deck file checksum mismatch")
+	ErrInvalidCode = errors.New("invalid card code in deck file")
+)
+
+// File schema stable d'un fichier de deck: une enveloppe avec somme de controle autour
+// d'un database.Snapshot, la graine et le nombre de melanges compris
+// Les cartes sont listees du dessus vers le dessous, pioche comme piles
+type File struct {
+	Format   string            `json:"format"`
+	Version  int               `json:"version"`
+	Deck     database.Snapshot `json:"deck"`
+	Checksum string            `json:"checksum"` //< "sha256:" suivi du hash hexadecimal du reste du fichier
+}
+
+// New retourne le fichier d'un snapshot de deck avec sa somme de controle
+func New(snap *database.Snapshot) *File {
+	f := &File{Format: Format, Version: Version, Deck: *snap}
+	f.Checksum = f.Sum()
+	return f
+}
+
+// Sum calcule la somme de controle du fichier sans tenir compte du champ Checksum
+// L'encodage json trie les cles des piles et de l'inventaire, la somme ne depend donc que du contenu
+func (f *File) Sum() string {
+	c := *f
+	c.Checksum = ""
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Validate verifie le format, la version, la somme de controle, chaque code de carte
+// puis la coherence du snapshot
+func (f *File) Validate() error {
+	if f.Format != Format {
+		return fmt.Errorf("format %q: %w", f.Format, ErrInvalidFile)
+	}
+	if f.Version != Version {
+		return fmt.Errorf("version %d: %w", f.Version, ErrInvalidFile)
+	}
+	if f.Checksum != f.Sum() {
+		return ErrChecksum
+	}
+	codes := slices.Clone(f.Deck.Cards)
+	for _, cards := range f.Deck.Piles {
+		codes = append(codes, cards...)
+	}
+	for code := range f.Deck.Entries {
+		codes = append(codes, code)
+	}
+	for _, code := range codes {
+		if !models.CodeValid(code) {
+			return fmt.Errorf("%q: %w", code, ErrInvalidCode)
+		}
+	}
+	if err := f.Deck.Validate(); err != nil {
+		return fmt.Errorf("%v: %w", err, ErrInvalidFile)
+	}
+	return nil
+}
+
+// Encode ecrit un fichier en json indente
+func Encode(w io.Writer, f *File) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+// Decode lit un fichier de deck et le valide, les champs inconnus sont refuses
+func Decode(r io.Reader) (*File, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrInvalidFile)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("donnees apres le fichier: %w", ErrInvalidFile)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
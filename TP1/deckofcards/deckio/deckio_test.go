@@ -0,0 +1,92 @@
+package deckio
+
+import (
+	"bytes"
+	"deckofcards/database"
+	"deckofcards/models"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testSnapshot snapshot d'un deck melange avec une pile et des cartes tirees
+func testSnapshot(cards []string) *database.Snapshot {
+	seed := int64(42)
+	snap := &database.Snapshot{
+		Version:      database.SnapshotVersion,
+		DeckId:       "abc",
+		TakenAt:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Shuffled:     true,
+		Seed:         &seed,
+		ShuffleCount: 3,
+		NPackets:     1,
+		Cards:        cards[:40],
+		Piles:        map[string][]string{"hand": cards[40:45]},
+		Entries:      map[string]database.SnapshotEntry{},
+	}
+	for i, code := range cards {
+		entry := database.SnapshotEntry{Total: 1}
+		switch {
+		case i < 40:
+			entry.InDeck = 1
+		case i < 45:
+			entry.InPile = 1
+		}
+		snap.Entries[code] = entry
+	}
+	return snap
+}
+
+func TestEncodeDecode(t *testing.T) {
+	deck := models.NewMultiDeck(1, false)
+	deck.Shuffle()
+	file := New(testSnapshot(deck.Cards))
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, file); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	data := buf.Bytes()
+	got, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	snap := got.Deck
+	if !slices.Equal(snap.Cards, deck.Cards[:40]) || !slices.Equal(snap.Piles["hand"], deck.Cards[40:45]) ||
+		len(snap.Entries) != 52 || snap.NPackets != 1 || !snap.Shuffled {
+		t.Fatalf("Decode = %+v, want the encoded deck", snap)
+	}
+	// La graine et le nombre de melanges suivent le deck
+	if snap.Seed == nil || *snap.Seed != 42 || snap.ShuffleCount != 3 {
+		t.Errorf("seed %v, shuffle count %d; want 42 and 3", snap.Seed, snap.ShuffleCount)
+	}
+
+	tampered := bytes.Replace(data, []byte(`"shuffle_count": 3`), []byte(`"shuffle_count": 4`), 1)
+	if _, err := Decode(bytes.NewReader(tampered)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Decode of a modified file = %v, want ErrChecksum", err)
+	}
+
+	invalid := testSnapshot(deck.Cards)
+	invalid.Cards = append(slices.Clone(invalid.Cards[:39]), "1X")
+	buf.Reset()
+	_ = Encode(&buf, New(invalid))
+	if _, err := Decode(&buf); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Decode with card 1X = %v, want ErrInvalidCode", err)
+	}
+
+	// Un inventaire qui ne correspond pas aux cartes est refuse meme avec une somme juste
+	inconsistent := testSnapshot(deck.Cards)
+	inconsistent.Cards = inconsistent.Cards[1:]
+	buf.Reset()
+	_ = Encode(&buf, New(inconsistent))
+	if _, err := Decode(&buf); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("Decode with inconsistent entries = %v, want ErrInvalidFile", err)
+	}
+
+	for _, doc := range []string{`{"format":"other","version":2}`, `{"format":"deckofcards/deck","version":1}`, `{"cards":`} {
+		if _, err := Decode(bytes.NewReader([]byte(doc))); !errors.Is(err, ErrInvalidFile) {
+			t.Errorf("Decode(%s) = %v, want ErrInvalidFile", doc, err)
+		}
+	}
+}
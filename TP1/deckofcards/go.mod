@@ -3,3 +3,5 @@ module deckofcards
 go 1.24.6
 
 require github.com/mattn/go-sqlite3 v1.14.32
+
+require github.com/coder/websocket v1.8.14
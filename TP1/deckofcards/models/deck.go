@@ -2,9 +2,7 @@ package models
 
 import (
 	"errors"
-	"math/rand"
 	"strings"
-	"time"
 )
 
 type Pile struct {
@@ -18,6 +16,8 @@ type Deck struct {
 	Remaining int
 	NPackets  int //< nombre de packets
 	Id        string
+	Shuffled  bool   //< si le deck a ete melange
+	Seed      *int64 //< graine des melanges, nil pour un melange imprevisible
 }
 
 // NewMultiDeck /** Permet de generer un nouveau deck comportant un a plusieurs decks
@@ -57,12 +57,19 @@ func NewCustomDeck(codes []string) (*Deck, error) {
 	return deck, nil
 }
 
-// Shuffle /** Melange le deck
+// Shuffle /** Melange le deck avec sa graine si elle est definie, sinon avec DefaultShuffler
 func (d *Deck) Shuffle() {
-	rand.Seed(time.Now().UnixNano())
+	if d.Seed != nil {
+		d.ShuffleWith(NewSeededShuffler(*d.Seed, 0))
+		return
+	}
+	d.ShuffleWith(DefaultShuffler)
+}
 
-	for i := range d.Cards {
-		j := rand.Intn(i + 1)
+// ShuffleWith /** Melange le deck avec un Shuffler donne
+func (d *Deck) ShuffleWith(s Shuffler) {
+	s.Shuffle(len(d.Cards), func(i, j int) {
 		d.Cards[i], d.Cards[j] = d.Cards[j], d.Cards[i]
-	}
+	})
+	d.Shuffled = true
 }
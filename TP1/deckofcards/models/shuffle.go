@@ -0,0 +1,65 @@
+package models
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"math/rand/v2"
+)
+
+// Shuffler source d'aleatoire utilisee pour melanger et tirer des cartes
+type Shuffler interface {
+	// Shuffle permute aleatoirement n elements a l'aide de swap
+	Shuffle(n int, swap func(i, j int))
+	// Intn retourne un entier aleatoire dans [0, n)
+	Intn(n int) int
+}
+
+// DefaultShuffler Shuffler utilise lorsqu'aucune graine n'est fournie
+var DefaultShuffler Shuffler = CryptoShuffler{}
+
+// CryptoShuffler Shuffler imprevisible base sur crypto/rand, sur pour plusieurs goroutines
+type CryptoShuffler struct{}
+
+func (CryptoShuffler) Intn(n int) int {
+	if n <= 0 {
+		panic("CryptoShuffler.Intn: n <= 0")
+	}
+	// Rejet des valeurs hors du plus grand multiple de n pour eviter le biais du modulo
+	limit := ^uint64(0) - ^uint64(0)%uint64(n)
+	var b [8]byte
+	for {
+		if _, err := cryptorand.Read(b[:]); err != nil {
+			panic("crypto/rand: " + err.Error())
+		}
+		if v := binary.LittleEndian.Uint64(b[:]); v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+func (c CryptoShuffler) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, c.Intn(i+1))
+	}
+}
+
+// seededShuffler Shuffler deterministe, a utiliser depuis une seule goroutine
+type seededShuffler struct {
+	r *rand.Rand
+}
+
+// NewSeededShuffler retourne un Shuffler deterministe: une meme graine et un meme
+// tour produisent toujours les memes melanges
+// seed graine du deck
+// round numero du melange pour cette graine, pour que deux melanges successifs different
+func NewSeededShuffler(seed int64, round uint64) Shuffler {
+	return seededShuffler{r: rand.New(rand.NewPCG(uint64(seed), round))}
+}
+
+func (s seededShuffler) Intn(n int) int {
+	return s.r.IntN(n)
+}
+
+func (s seededShuffler) Shuffle(n int, swap func(i, j int)) {
+	s.r.Shuffle(n, swap)
+}
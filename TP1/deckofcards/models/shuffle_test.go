@@ -0,0 +1,65 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSeededShuffleDeterministic(t *testing.T) {
+	seed := int64(42)
+	a := NewMultiDeck(1, true)
+	a.Seed = &seed
+	a.Shuffle()
+	b := NewMultiDeck(1, true)
+	b.Seed = &seed
+	b.Shuffle()
+
+	if !slices.Equal(a.Cards, b.Cards) {
+		t.Fatalf("same seed produced different orders:\n%v\n%v", a.Cards, b.Cards)
+	}
+	if slices.Equal(a.Cards, NewMultiDeck(1, true).Cards) {
+		t.Fatalf("seeded shuffle left the deck unchanged")
+	}
+	if !a.Shuffled {
+		t.Errorf("Shuffled flag not set")
+	}
+
+	other := int64(43)
+	c := NewMultiDeck(1, true)
+	c.Seed = &other
+	c.Shuffle()
+	if slices.Equal(a.Cards, c.Cards) {
+		t.Errorf("different seeds produced the same order")
+	}
+}
+
+func TestSeededShufflerRounds(t *testing.T) {
+	first := NewMultiDeck(1, false)
+	first.ShuffleWith(NewSeededShuffler(7, 0))
+	second := NewMultiDeck(1, false)
+	second.ShuffleWith(NewSeededShuffler(7, 1))
+	if slices.Equal(first.Cards, second.Cards) {
+		t.Errorf("rounds 0 and 1 produced the same order")
+	}
+}
+
+func TestCryptoShufflerKeepsCards(t *testing.T) {
+	deck := NewMultiDeck(2, true)
+	deck.ShuffleWith(CryptoShuffler{})
+
+	got := slices.Clone(deck.Cards)
+	want := NewMultiDeck(2, true).Cards
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("shuffle changed the cards of the deck")
+	}
+
+	for _, n := range []int{1, 2, 54} {
+		for i := 0; i < 100; i++ {
+			if v := (CryptoShuffler{}).Intn(n); v < 0 || v >= n {
+				t.Fatalf("Intn(%d) = %d, out of range", n, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration time.Duration lue et ecrite en json sous forme de texte ("24h", "90s")
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// MemoryDBPath valeur de DBPath qui garde les decks en memoire, sans base sqlite
+const MemoryDBPath = ":memory:"
+
+// Config configuration d'execution du serveur
+type Config struct {
+	ListenAddr string `json:"listen_addr"` //< adresse d'ecoute du serveur http
+	DBPath     string `json:"db_path"`     //< chemin de la base sqlite, ou MemoryDBPath
+	StaticDir  string `json:"static_dir"`  //< dossier contenant img/
+	IndexPath  string `json:"index_path"`  //< page d'accueil
+	// PublicURL url publique utilisee pour les images des cartes,
+	// si vide elle est deduite de l'en-tete Host, et des en-tetes X-Forwarded-* si TrustProxy
+	PublicURL  string `json:"public_url"`
+	TrustProxy bool   `json:"trust_proxy"` //< le serveur est derriere un proxy qui fixe les en-tetes X-Forwarded-*
+	// AllowedOrigins origines des pages autorisees a ouvrir une table websocket en plus
+	// de celle du serveur, motifs path.Match sur l'hote ou sur scheme://hote
+	AllowedOrigins []string `json:"allowed_origins"`
+
+	MaxDecks             int `json:"max_decks"`               //< nombre maximal de paquets par deck
+	WorkerAmount         int `json:"worker_amount"`           //< nombre de workers de base de donnees
+	CustomDeckCardsLimit int `json:"custom_deck_cards_limit"` //< nombre maximal de cartes d'un deck personnalise
+
+	DeckTTL          Duration `json:"deck_ttl"`           //< inactivite avant expiration d'un deck, 0 = jamais
+	JanitorInterval  Duration `json:"janitor_interval"`   //< intervalle entre deux purges des decks expires
+	JanitorBatchSize int      `json:"janitor_batch_size"` //< nombre maximal de decks purges par transaction
+}
+
+// DefaultConfig retourne la configuration par defaut
+func DefaultConfig() *Config {
+	return &Config{
+		ListenAddr:           ":8080",
+		DBPath:               "DATABASE/cards.db",
+		StaticDir:            "static",
+		IndexPath:            "index.html",
+		MaxDecks:             MAX_DECKS,
+		WorkerAmount:         WORKER_AMOUNT,
+		CustomDeckCardsLimit: CUSTOM_DECK_CARDS_LIMIT,
+		JanitorInterval:      Duration{time.Minute},
+		JanitorBatchSize:     100,
+	}
+}
+
+// LoadConfig charge la configuration par defaut, puis le fichier json path s'il
+// est fourni, puis les variables d'environnement DECK_*
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("lecture de la configuration: %w", err)
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("configuration invalide %s: %w", path, err)
+		}
+	}
+	if err := cfg.ApplyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// ApplyEnv remplace les valeurs par celles des variables d'environnement definies
+func (c *Config) ApplyEnv() error {
+	strs := map[string]*string{
+		"DECK_ADDR":       &c.ListenAddr,
+		"DECK_DB":         &c.DBPath,
+		"DECK_STATIC":     &c.StaticDir,
+		"DECK_INDEX":      &c.IndexPath,
+		"DECK_PUBLIC_URL": &c.PublicURL,
+	}
+	for key, dst := range strs {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			*dst = v
+		}
+	}
+
+	ints := map[string]*int{
+		"DECK_MAX_DECKS":               &c.MaxDecks,
+		"DECK_WORKERS":                 &c.WorkerAmount,
+		"DECK_CUSTOM_DECK_CARDS_LIMIT": &c.CustomDeckCardsLimit,
+		"DECK_JANITOR_BATCH_SIZE":      &c.JanitorBatchSize,
+	}
+	for key, dst := range ints {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("valeur invalide pour %s: %q", key, v)
+			}
+			*dst = i
+		}
+	}
+
+	if v, ok := os.LookupEnv("DECK_ALLOWED_ORIGINS"); ok && v != "" {
+		c.AllowedOrigins = SplitList(v)
+	}
+
+	bools := map[string]*bool{
+		"DECK_TRUST_PROXY": &c.TrustProxy,
+	}
+	for key, dst := range bools {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("valeur invalide pour %s: %q", key, v)
+			}
+			*dst = b
+		}
+	}
+
+	durations := map[string]*Duration{
+		"DECK_TTL":              &c.DeckTTL,
+		"DECK_JANITOR_INTERVAL": &c.JanitorInterval,
+	}
+	for key, dst := range durations {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			if err := dst.UnmarshalText([]byte(v)); err != nil {
+				return fmt.Errorf("valeur invalide pour %s: %q", key, v)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate verifie la coherence de la configuration
+func (c *Config) Validate() error {
+	if c.MaxDecks <= 0 {
+		return errors.New("max_decks doit etre positif")
+	}
+	if c.WorkerAmount <= 0 {
+		return errors.New("worker_amount doit etre positif")
+	}
+	if c.CustomDeckCardsLimit <= 0 {
+		return errors.New("custom_deck_cards_limit doit etre positif")
+	}
+	if c.DeckTTL.Duration < 0 {
+		return errors.New("deck_ttl ne peut pas etre negatif")
+	}
+	if c.DeckTTL.Duration > 0 && (c.JanitorInterval.Duration <= 0 || c.JanitorBatchSize <= 0) {
+		return errors.New("janitor_interval et janitor_batch_size doivent etre positifs si deck_ttl est defini")
+	}
+	if c.PublicURL != "" && !strings.HasPrefix(c.PublicURL, "http://") && !strings.HasPrefix(c.PublicURL, "https://") {
+		return fmt.Errorf("public_url invalide: %q", c.PublicURL)
+	}
+	return nil
+}
+
+// SplitList decoupe une liste separee par des virgules en ignorant les elements vides
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"listen_addr": ":9090", "max_decks": 4, "public_url": "https://cards.example.com"}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("DECK_WORKERS", "3")
+	t.Setenv("DECK_MAX_DECKS", "6")
+	t.Setenv("DECK_TRUST_PROXY", "true")
+	t.Setenv("DECK_ALLOWED_ORIGINS", "cards.example.com, https://*.example.org,")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.ListenAddr != ":9090" {
+		t.Errorf("ListenAddr = %q, want %q", cfg.ListenAddr, ":9090")
+	}
+	if cfg.MaxDecks != 6 {
+		t.Errorf("MaxDecks = %d, want 6 (env overrides file)", cfg.MaxDecks)
+	}
+	if cfg.WorkerAmount != 3 {
+		t.Errorf("WorkerAmount = %d, want 3", cfg.WorkerAmount)
+	}
+	if cfg.CustomDeckCardsLimit != CUSTOM_DECK_CARDS_LIMIT {
+		t.Errorf("CustomDeckCardsLimit = %d, want default %d", cfg.CustomDeckCardsLimit, CUSTOM_DECK_CARDS_LIMIT)
+	}
+	if cfg.PublicURL != "https://cards.example.com" {
+		t.Errorf("PublicURL = %q", cfg.PublicURL)
+	}
+	if !cfg.TrustProxy {
+		t.Error("TrustProxy = false, want true from DECK_TRUST_PROXY")
+	}
+	if got := strings.Join(cfg.AllowedOrigins, " "); got != "cards.example.com https://*.example.org" {
+		t.Errorf("AllowedOrigins = %q", got)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	t.Setenv("DECK_WORKERS", "abc")
+	if _, err := LoadConfig(""); err == nil {
+		t.Fatal("expected error for invalid DECK_WORKERS")
+	}
+	t.Setenv("DECK_WORKERS", "0")
+	if _, err := LoadConfig(""); err == nil {
+		t.Fatal("expected error for zero DECK_WORKERS")
+	}
+}
@@ -1,6 +1,6 @@
 package utils
 
+// Valeurs par defaut de Config
 const MAX_DECKS = 15
 const WORKER_AMOUNT = 15
 const CUSTOM_DECK_CARDS_LIMIT = MAX_DECKS * 54
-const SERVER_PATH = "http://localhost:8080"
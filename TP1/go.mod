@@ -2,4 +2,6 @@ module tp1
 
 go 1.24.6
 
+require deckofcards v0.0.0
+
 replace deckofcards => ./deckofcards